@@ -0,0 +1,257 @@
+package audiobooker
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// report formats of a batch run, picked by the extension of the report file
+const (
+	ReportFormatCsv  = ".csv"
+	ReportFormatJson = ".json"
+)
+
+// defaultEncodingProfileName name reported for the default encoding profile
+const defaultEncodingProfileName = "default"
+
+// reportCsvHeader columns of the CSV batch report
+var reportCsvHeader = []string{"source_dir", "path_tags", "output_file", "chapter_count", "chapter_titles", "duration_seconds", "output_size", "encoding_profile", "loudness_integrated_lufs", "loudness_true_peak_dbtp", "loudness_range_lu", "loudness_target_lufs", "loudness_gain_db", "elapsed_seconds", "status", "reason", "error"}
+
+// BookReport outcome of a book of a batch run
+type BookReport struct {
+	// SourceDir absolute path of the book's source directory
+	SourceDir string `json:"source_dir"`
+	// PathTags metadata parsed from the source path
+	PathTags map[string]string `json:"path_tags"`
+	// OutputFile path of the bound book
+	OutputFile string `json:"output_file"`
+	// ChapterTitles titles of the chapters of the book
+	ChapterTitles []string `json:"chapter_titles"`
+	// Duration audio duration of the book
+	Duration time.Duration `json:"-"`
+	// OutputSize size of the bound book in bytes, zero if it wasn't bound
+	OutputSize int64 `json:"output_size"`
+	// EncodingProfile name of the encoding profile
+	EncodingProfile string `json:"encoding_profile"`
+	// Loudness measured loudness and applied correction, nil if the book wasn't corrected
+	Loudness *LoudnessMeasurement `json:"-"`
+	// Elapsed time spent on the book
+	Elapsed time.Duration `json:"-"`
+	// Status outcome of the book
+	Status string `json:"status"`
+	// Reason why the book was bound or skipped
+	Reason string `json:"reason,omitempty"`
+	// Error why the book failed
+	Error string `json:"error,omitempty"`
+}
+
+// bookReportJson the JSON form of a book report, with the counts and durations in seconds
+type bookReportJson struct {
+	BookReport
+	ChapterCount    int     `json:"chapter_count"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	// the loudness values are left out when the book wasn't corrected, or measured as silent
+	LoudnessIntegrated *float64 `json:"loudness_integrated_lufs,omitempty"`
+	LoudnessTruePeak   *float64 `json:"loudness_true_peak_dbtp,omitempty"`
+	LoudnessRange      *float64 `json:"loudness_range_lu,omitempty"`
+	LoudnessTarget     *float64 `json:"loudness_target_lufs,omitempty"`
+	LoudnessGain       *float64 `json:"loudness_gain_db,omitempty"`
+}
+
+// CheckReportFormat returns an error if the extension of the report file isn't a supported format
+func CheckReportFormat(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ReportFormatCsv, ReportFormatJson:
+		return nil
+	default:
+		return fmt.Errorf("unknown report format of %q, must end in %s or %s", path, ReportFormatJson, ReportFormatCsv)
+	}
+}
+
+// Describe fills in the path tags, output file, chapters, duration, encoding profile, and loudness of the book, from the bound book if it exists or the plan for it otherwise
+func (r *BookReport) Describe(ctx context.Context, config Config, book Book, pathTags map[string]string) {
+	r.PathTags = pathTags
+	r.OutputFile = filepath.Join(config.OutputPath, config.OutputFile)
+	if absOutput, err := filepath.Abs(r.OutputFile); err == nil {
+		r.OutputFile = absOutput
+	}
+	r.EncodingProfile = config.EncodingProfile
+	if r.EncodingProfile == "" {
+		r.EncodingProfile = defaultEncodingProfileName
+	}
+	r.Loudness = config.loudness
+
+	r.ChapterTitles = make([]string, len(book.Chapters))
+	for idx, chapter := range book.Chapters {
+		r.ChapterTitles[idx] = chapter.Title
+	}
+
+	// the chapters cover the whole book, otherwise the sources are measured
+	switch {
+	case len(book.Chapters) > 0:
+		r.Duration = time.Duration(book.Chapters[len(book.Chapters)-1].EndMs) * time.Millisecond
+	case config.bookDuration > 0:
+		r.Duration = config.bookDuration
+	default:
+		r.Duration = 0
+		for _, sourceFile := range config.sourceFiles {
+			data, err := ffprobe.ProbeURL(ctx, sourceFile)
+			if err != nil {
+				log.Warnf("error measuring %s for the report: %v", sourceFile, err)
+				r.Duration = 0
+				break
+			}
+			if data.Format != nil {
+				r.Duration += data.Format.Duration()
+			}
+		}
+	}
+}
+
+// MeasureOutputSize fills in the size of the output file, only for books bound in this run, so an output left by an earlier run isn't reported for a planned or failed book
+func (r *BookReport) MeasureOutputSize() {
+	r.OutputSize = 0
+	if info, err := os.Stat(r.OutputFile); err == nil {
+		r.OutputSize = info.Size()
+	}
+}
+
+// fillEmpty replaces the missing path tags and chapter titles of books that weren't described, so they're written as empty rather than null
+func (r *BookReport) fillEmpty() {
+	if r.PathTags == nil {
+		r.PathTags = make(map[string]string)
+	}
+	if r.ChapterTitles == nil {
+		r.ChapterTitles = make([]string, 0)
+	}
+}
+
+// WriteBatchReport writes the reports of the books of a batch run as JSON or CSV, by the extension of the report file
+func WriteBatchReport(path string, reports []BookReport) error {
+	if err := CheckReportFormat(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ReportFormatCsv {
+		err = writeReportCsv(f, reports)
+	} else {
+		err = writeReportJson(f, reports)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// loudnessValues integrated loudness, true peak, loudness range, target, and gain of the report, nil for the values that weren't measured or aren't finite
+func (r *BookReport) loudnessValues() []*float64 {
+	values := make([]*float64, 5)
+	if r.Loudness == nil {
+		return values
+	}
+	for idx, value := range []float64{r.Loudness.Integrated, r.Loudness.TruePeak, r.Loudness.LRA, r.Loudness.Target, r.Loudness.Gain} {
+		if !math.IsInf(value, 0) && !math.IsNaN(value) {
+			v := value
+			values[idx] = &v
+		}
+	}
+	return values
+}
+
+// writeReportJson writes the reports as a JSON document with a list of books
+func writeReportJson(w io.Writer, reports []BookReport) error {
+	books := make([]bookReportJson, len(reports))
+	for idx, report := range reports {
+		report.fillEmpty()
+		loudness := report.loudnessValues()
+		books[idx] = bookReportJson{
+			BookReport:         report,
+			ChapterCount:       len(report.ChapterTitles),
+			DurationSeconds:    report.Duration.Seconds(),
+			ElapsedSeconds:     report.Elapsed.Seconds(),
+			LoudnessIntegrated: loudness[0],
+			LoudnessTruePeak:   loudness[1],
+			LoudnessRange:      loudness[2],
+			LoudnessTarget:     loudness[3],
+			LoudnessGain:       loudness[4],
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Books []bookReportJson `json:"books"`
+	}{Books: books})
+}
+
+// writeReportCsv writes the reports as CSV with a row per book, the path tags and chapter titles are JSON encoded so they survive any separator in them
+func writeReportCsv(out io.Writer, reports []BookReport) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(reportCsvHeader); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		report.fillEmpty()
+		pathTags, err := json.Marshal(report.PathTags)
+		if err != nil {
+			return err
+		}
+		chapterTitles, err := json.Marshal(report.ChapterTitles)
+		if err != nil {
+			return err
+		}
+
+		row := []string{
+			report.SourceDir,
+			string(pathTags),
+			report.OutputFile,
+			strconv.Itoa(len(report.ChapterTitles)),
+			string(chapterTitles),
+			strconv.FormatFloat(report.Duration.Seconds(), 'f', 3, 64),
+			strconv.FormatInt(report.OutputSize, 10),
+			report.EncodingProfile,
+		}
+		// the loudness columns are empty when the book wasn't corrected
+		for _, value := range report.loudnessValues() {
+			if value == nil {
+				row = append(row, "")
+			} else {
+				row = append(row, strconv.FormatFloat(*value, 'f', 2, 64))
+			}
+		}
+		row = append(row,
+			strconv.FormatFloat(report.Elapsed.Seconds(), 'f', 3, 64),
+			report.Status,
+			report.Reason,
+			report.Error,
+		)
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,175 @@
+package audiobooker
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type BatchReportTestSuite struct {
+	suite.Suite
+}
+
+// testBookReports reports of a bound and a skipped book
+func testBookReports() []BookReport {
+	return []BookReport{
+		{
+			SourceDir:       "/src/Jules Verne/Around the World",
+			PathTags:        map[string]string{"author": "Jules Verne", "title": "Around the World"},
+			OutputFile:      "/out/Jules Verne/Around the World.m4b",
+			ChapterTitles:   []string{"Chapter 1", "Chapter 2, the Return"},
+			Duration:        90 * time.Minute,
+			OutputSize:      1234567,
+			EncodingProfile: "spoken-mono-48k",
+			Loudness:        &LoudnessMeasurement{Integrated: -23.4, TruePeak: -4.2, LRA: 6.5, Target: -18, Gain: 5.4},
+			Elapsed:         4*time.Minute + 500*time.Millisecond,
+			Status:          "bound",
+			Reason:          "new book",
+		},
+		{SourceDir: "/src/Jules Verne/Five Weeks", Status: "skipped", Reason: "already bound"},
+	}
+}
+
+func (suite *BatchReportTestSuite) TestCheckReportFormat() {
+	assert.Nil(suite.T(), CheckReportFormat("report.json"))
+	assert.Nil(suite.T(), CheckReportFormat("/reports/report.CSV"))
+	assert.NotNil(suite.T(), CheckReportFormat("report.txt"))
+	assert.NotNil(suite.T(), CheckReportFormat("report"))
+	assert.NotNil(suite.T(), WriteBatchReport(filepath.Join(UtScratchDirectory, "report.txt"), testBookReports()))
+}
+
+func (suite *BatchReportTestSuite) TestWriteBatchReportJson() {
+	reportFile := filepath.Join(UtScratchDirectory, "reports", "report.json")
+	assert.Nil(suite.T(), WriteBatchReport(reportFile, testBookReports()))
+
+	data, err := os.ReadFile(reportFile)
+	assert.Nil(suite.T(), err)
+	var report struct {
+		Books []map[string]interface{} `json:"books"`
+	}
+	assert.Nil(suite.T(), json.Unmarshal(data, &report))
+	assert.Len(suite.T(), report.Books, 2)
+
+	bound := report.Books[0]
+	assert.Equal(suite.T(), "/src/Jules Verne/Around the World", bound["source_dir"])
+	assert.Equal(suite.T(), map[string]interface{}{"author": "Jules Verne", "title": "Around the World"}, bound["path_tags"])
+	assert.Equal(suite.T(), "/out/Jules Verne/Around the World.m4b", bound["output_file"])
+	assert.Equal(suite.T(), float64(2), bound["chapter_count"])
+	assert.Equal(suite.T(), []interface{}{"Chapter 1", "Chapter 2, the Return"}, bound["chapter_titles"])
+	assert.Equal(suite.T(), float64(5400), bound["duration_seconds"])
+	assert.Equal(suite.T(), float64(1234567), bound["output_size"])
+	assert.Equal(suite.T(), "spoken-mono-48k", bound["encoding_profile"])
+	assert.Equal(suite.T(), -23.4, bound["loudness_integrated_lufs"])
+	assert.Equal(suite.T(), -4.2, bound["loudness_true_peak_dbtp"])
+	assert.Equal(suite.T(), 6.5, bound["loudness_range_lu"])
+	assert.Equal(suite.T(), float64(-18), bound["loudness_target_lufs"])
+	assert.Equal(suite.T(), 5.4, bound["loudness_gain_db"])
+	assert.Equal(suite.T(), 240.5, bound["elapsed_seconds"])
+	assert.Equal(suite.T(), "bound", bound["status"])
+	assert.NotContains(suite.T(), bound, "error")
+
+	// books that weren't described have empty tags and chapters
+	skipped := report.Books[1]
+	assert.Equal(suite.T(), map[string]interface{}{}, skipped["path_tags"])
+	assert.Equal(suite.T(), []interface{}{}, skipped["chapter_titles"])
+	assert.Equal(suite.T(), "already bound", skipped["reason"])
+	assert.NotContains(suite.T(), skipped, "loudness_integrated_lufs")
+
+	// a book measured as silent leaves out its integrated loudness rather than failing to encode
+	silent := BookReport{SourceDir: "/src/Jules Verne/Silent", Loudness: &LoudnessMeasurement{Integrated: math.Inf(-1), TruePeak: math.Inf(-1), Target: -18}}
+	assert.Nil(suite.T(), WriteBatchReport(reportFile, []BookReport{silent}))
+	data, err = os.ReadFile(reportFile)
+	assert.Nil(suite.T(), err)
+	var silentReport struct {
+		Books []map[string]interface{} `json:"books"`
+	}
+	assert.Nil(suite.T(), json.Unmarshal(data, &silentReport))
+	assert.NotContains(suite.T(), silentReport.Books[0], "loudness_integrated_lufs")
+	assert.Equal(suite.T(), float64(-18), silentReport.Books[0]["loudness_target_lufs"])
+}
+
+func (suite *BatchReportTestSuite) TestWriteBatchReportCsv() {
+	reportFile := filepath.Join(UtScratchDirectory, "report.csv")
+	assert.Nil(suite.T(), WriteBatchReport(reportFile, testBookReports()))
+
+	f, err := os.Open(reportFile)
+	assert.Nil(suite.T(), err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), rows, 3)
+	assert.Equal(suite.T(), reportCsvHeader, rows[0])
+	assert.Equal(suite.T(), []string{
+		"/src/Jules Verne/Around the World",
+		`{"author":"Jules Verne","title":"Around the World"}`,
+		"/out/Jules Verne/Around the World.m4b",
+		"2",
+		`["Chapter 1","Chapter 2, the Return"]`,
+		"5400.000",
+		"1234567",
+		"spoken-mono-48k",
+		"-23.40",
+		"-4.20",
+		"6.50",
+		"-18.00",
+		"5.40",
+		"240.500",
+		"bound",
+		"new book",
+		"",
+	}, rows[1])
+	assert.Equal(suite.T(), []string{"/src/Jules Verne/Five Weeks", "{}", "", "0", "[]", "0.000", "0", "", "", "", "", "", "", "0.000", "skipped", "already bound", ""}, rows[2])
+}
+
+func (suite *BatchReportTestSuite) TestDescribe() {
+	outputDir := filepath.Join(UtScratchDirectory, "describe-output")
+
+	config := Config{OutputPath: outputDir, OutputFile: "book.m4b"}
+	book := Book{Chapters: []*Chapter{
+		{Title: "Chapter 1", StartMs: 0, EndMs: 60000},
+		{Title: "Chapter 2", StartMs: 60000, EndMs: 150000},
+	}}
+	pathTags := map[string]string{"author": "Jules Verne"}
+
+	report := BookReport{SourceDir: "/src/Jules Verne/Around the World"}
+	report.Describe(context.Background(), config, book, pathTags)
+	assert.Equal(suite.T(), pathTags, report.PathTags)
+	assert.Equal(suite.T(), filepath.Join(outputDir, "book.m4b"), report.OutputFile)
+	assert.Equal(suite.T(), []string{"Chapter 1", "Chapter 2"}, report.ChapterTitles)
+	assert.Equal(suite.T(), 150*time.Second, report.Duration)
+	assert.Equal(suite.T(), "default", report.EncodingProfile)
+	assert.Nil(suite.T(), report.Loudness)
+
+	// a planned book has no output yet, and takes its duration from the transcoded sources
+	config = Config{OutputPath: outputDir, OutputFile: "planned.m4b", EncodingProfile: "spoken-mono-vbr", bookDuration: time.Hour, loudness: &LoudnessMeasurement{Target: -18, Gain: 2}}
+	report.Describe(context.Background(), config, Book{}, pathTags)
+	assert.Empty(suite.T(), report.ChapterTitles)
+	assert.Equal(suite.T(), time.Hour, report.Duration)
+	assert.Equal(suite.T(), "spoken-mono-vbr", report.EncodingProfile)
+	assert.Equal(suite.T(), 2.0, report.Loudness.Gain)
+}
+
+func (suite *BatchReportTestSuite) TestMeasureOutputSize() {
+	outputDir := filepath.Join(UtScratchDirectory, "measure-output")
+	assert.Nil(suite.T(), os.MkdirAll(outputDir, 0755))
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(outputDir, "book.m4b"), []byte("bound book"), 0644))
+
+	// an output left by an earlier run isn't reported until the book is bound
+	config := Config{OutputPath: outputDir, OutputFile: "book.m4b"}
+	report := BookReport{}
+	report.Describe(context.Background(), config, Book{}, nil)
+	assert.Equal(suite.T(), int64(0), report.OutputSize)
+	report.MeasureOutputSize()
+	assert.Equal(suite.T(), int64(len("bound book")), report.OutputSize)
+
+	// a missing output has no size
+	report = BookReport{OutputFile: filepath.Join(outputDir, "missing.m4b"), OutputSize: 10}
+	report.MeasureOutputSize()
+	assert.Equal(suite.T(), int64(0), report.OutputSize)
+}
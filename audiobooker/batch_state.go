@@ -0,0 +1,163 @@
+package audiobooker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BatchStateFilename name of the batch state file kept in the output root
+const BatchStateFilename = ".audiobooker-state.json"
+
+// states of a book in a batch run
+const (
+	BookStatusPending = "pending"
+	BookStatusDone    = "done"
+	BookStatusFailed  = "failed"
+)
+
+// BookState how a book of a batch run was last left
+type BookState struct {
+	// Status pending while the book is being bound, then done or failed
+	Status string `json:"status"`
+	// OutputPath path of the bound book
+	OutputPath string `json:"output_path,omitempty"`
+	// Fingerprint fingerprint of the source files the book was bound from
+	Fingerprint string `json:"fingerprint"`
+	// UpdatedAt when the status last changed
+	UpdatedAt time.Time `json:"updated_at"`
+	// Error why the book failed
+	Error string `json:"error,omitempty"`
+}
+
+// BatchState the state of each book of batch runs into the same output root, keyed by the book's source directory
+type BatchState struct {
+	// Books state of each book
+	Books map[string]*BookState `json:"books"`
+
+	// path path of the state file
+	path string
+}
+
+// BatchOutputRoot returns the directory of an output path pattern before its first placeholder, which every book is bound under
+func BatchOutputRoot(outputPathPattern string) string {
+	idx := strings.Index(outputPathPattern, "%")
+	if idx < 0 {
+		return filepath.Clean(outputPathPattern)
+	}
+	// drop the partial directory name in front of the placeholder
+	root := outputPathPattern[:idx]
+	if !strings.HasSuffix(root, "/") {
+		root = filepath.Dir(root)
+	}
+	return filepath.Clean(root)
+}
+
+// LoadBatchState reads the batch state file, an empty state is returned if it doesn't exist yet
+func LoadBatchState(path string) (*BatchState, error) {
+	state := &BatchState{Books: make(map[string]*BookState), path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("reading batch state file %s: %w", path, err)
+	}
+	if state.Books == nil {
+		state.Books = make(map[string]*BookState)
+	}
+	return state, nil
+}
+
+// Save writes the state file, replacing it only once it's completely written
+func (s *BatchState) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(append(data, '\n')); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return os.Rename(temp.Name(), s.path)
+}
+
+// Update records the status of a book and saves the state file
+func (s *BatchState) Update(sourceDir, status, outputPath, fingerprint string, bookErr error) error {
+	book := &BookState{Status: status, OutputPath: outputPath, Fingerprint: fingerprint, UpdatedAt: time.Now().UTC()}
+	if bookErr != nil {
+		book.Error = bookErr.Error()
+	}
+	s.Books[sourceDir] = book
+	return s.Save()
+}
+
+// ShouldProcess decides if a book is bound, returning why it's bound or skipped
+func (s *BatchState) ShouldProcess(sourceDir, fingerprint string, retryFailed, force bool) (bool, string) {
+	book, ok := s.Books[sourceDir]
+	switch {
+	case force:
+		return true, "forced"
+	case !ok:
+		return true, "new book"
+	case book.Fingerprint != fingerprint:
+		return true, "source files changed"
+	case book.Status == BookStatusDone:
+		if _, err := os.Stat(book.OutputPath); err != nil {
+			return true, "bound book is missing"
+		}
+		return false, "already bound"
+	case book.Status == BookStatusFailed:
+		if retryFailed {
+			return true, "retrying failed book"
+		}
+		return false, "failed on an earlier run"
+	default:
+		return true, "interrupted on an earlier run"
+	}
+}
+
+// SourceFingerprint fingerprints the files of a book directory from their names, sizes, and modification times, so changed sources are rebuilt without hashing their content
+func SourceFingerprint(sourceDir string) (string, error) {
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	hash := sha256.New()
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,110 @@
+package audiobooker
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type BatchStateTestSuite struct {
+	suite.Suite
+}
+
+func (suite *BatchStateTestSuite) TestBatchOutputRoot() {
+	assert.Equal(suite.T(), "ab/output", BatchOutputRoot("./ab/output/%a/%s/%p"))
+	assert.Equal(suite.T(), "/books", BatchOutputRoot("/books/%a - %t"))
+	assert.Equal(suite.T(), "out", BatchOutputRoot("out/book-%a"))
+	assert.Equal(suite.T(), ".", BatchOutputRoot("%a/%t"))
+	assert.Equal(suite.T(), "/books/output", BatchOutputRoot("/books/output/"))
+	assert.Equal(suite.T(), ".", BatchOutputRoot(""))
+}
+
+func (suite *BatchStateTestSuite) TestLoadAndSaveBatchState() {
+	statePath := filepath.Join(UtScratchDirectory, "batch-state", BatchStateFilename)
+
+	state, err := LoadBatchState(statePath)
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), state.Books)
+
+	assert.Nil(suite.T(), state.Update("/src/Author/Title", BookStatusFailed, "/out/Author/Title.m4b", "abc", errors.New("exit status 1")))
+	assert.Nil(suite.T(), state.Update("/src/Author/Other", BookStatusDone, "/out/Author/Other.m4b", "def", nil))
+
+	loaded, err := LoadBatchState(statePath)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), loaded.Books, 2)
+	assert.Equal(suite.T(), BookStatusFailed, loaded.Books["/src/Author/Title"].Status)
+	assert.Equal(suite.T(), "exit status 1", loaded.Books["/src/Author/Title"].Error)
+	assert.Equal(suite.T(), "/out/Author/Other.m4b", loaded.Books["/src/Author/Other"].OutputPath)
+	assert.Equal(suite.T(), "def", loaded.Books["/src/Author/Other"].Fingerprint)
+	assert.WithinDuration(suite.T(), time.Now(), loaded.Books["/src/Author/Other"].UpdatedAt, time.Minute)
+
+	// a corrupt state file isn't silently replaced
+	assert.Nil(suite.T(), os.WriteFile(statePath, []byte("{"), 0644))
+	_, err = LoadBatchState(statePath)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *BatchStateTestSuite) TestShouldProcess() {
+	boundBook := filepath.Join(UtScratchDirectory, "bound-book.m4b")
+	assert.Nil(suite.T(), os.WriteFile(boundBook, []byte("book"), 0644))
+	state := &BatchState{Books: map[string]*BookState{
+		"/src/done":    {Status: BookStatusDone, OutputPath: boundBook, Fingerprint: "abc"},
+		"/src/missing": {Status: BookStatusDone, OutputPath: filepath.Join(UtScratchDirectory, "missing.m4b"), Fingerprint: "abc"},
+		"/src/failed":  {Status: BookStatusFailed, Fingerprint: "abc"},
+		"/src/pending": {Status: BookStatusPending, Fingerprint: "abc"},
+	}}
+
+	tests := []struct {
+		dir         string
+		fingerprint string
+		retryFailed bool
+		force       bool
+		process     bool
+	}{
+		{"/src/new", "abc", false, false, true},
+		{"/src/done", "abc", false, false, false},
+		{"/src/done", "changed", false, false, true},
+		{"/src/done", "abc", false, true, true},
+		{"/src/missing", "abc", false, false, true},
+		{"/src/failed", "abc", false, false, false},
+		{"/src/failed", "abc", true, false, true},
+		{"/src/failed", "changed", false, false, true},
+		{"/src/pending", "abc", false, false, true},
+	}
+	for _, test := range tests {
+		process, reason := state.ShouldProcess(test.dir, test.fingerprint, test.retryFailed, test.force)
+		assert.Equal(suite.T(), test.process, process, "%+v", test)
+		assert.NotEmpty(suite.T(), reason)
+	}
+}
+
+func (suite *BatchStateTestSuite) TestSourceFingerprint() {
+	bookDir := filepath.Join(UtScratchDirectory, "fingerprint-book")
+	assert.Nil(suite.T(), os.MkdirAll(bookDir, 0755))
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(bookDir, "01.mp3"), []byte("part one"), 0644))
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(bookDir, "02.mp3"), []byte("part two"), 0644))
+
+	fingerprint, err := SourceFingerprint(bookDir)
+	assert.Nil(suite.T(), err)
+	same, err := SourceFingerprint(bookDir)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), fingerprint, same)
+
+	// a changed file changes the fingerprint
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(bookDir, "02.mp3"), []byte("part two, edited"), 0644))
+	changed, err := SourceFingerprint(bookDir)
+	assert.Nil(suite.T(), err)
+	assert.NotEqual(suite.T(), fingerprint, changed)
+
+	// so does an added file
+	assert.Nil(suite.T(), os.WriteFile(filepath.Join(bookDir, "cover.jpg"), []byte("cover"), 0644))
+	added, err := SourceFingerprint(bookDir)
+	assert.Nil(suite.T(), err)
+	assert.NotEqual(suite.T(), changed, added)
+
+	_, err = SourceFingerprint(filepath.Join(UtScratchDirectory, "no-such-book"))
+	assert.NotNil(suite.T(), err)
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/cslamar/mp4tag"
 	"github.com/dhowden/tag"
 	log "github.com/sirupsen/logrus"
-	ffmpeg_go "github.com/u2takey/ffmpeg-go"
 	"gopkg.in/vansante/go-ffprobe.v2"
 	"html/template"
 	"io"
@@ -29,16 +28,20 @@ type Book struct {
 	Date        *string
 	Description *string
 	Genre       *string
+	Language    *string
 	Narrator    *string
 	SortSlug    *string
 	Title       string
 
-	seriesName *string
-	seriesPart *int
+	chaptersFinalized bool
+	chaptersTitled    bool
+	seriesName        *string
+	seriesPart        *int
+	tocTitles         []string
 }
 
 // GenerateMetaTemplate writes out the compiled metadata template for use when compiling to m4b
-func (b *Book) GenerateMetaTemplate(config Config) error {
+func (b *Book) GenerateMetaTemplate(ctx context.Context, config Config) error {
 	// if series name and part are present, generate Sort property
 	if b.seriesName != nil && b.seriesPart != nil {
 		b.SortSlug = new(string)
@@ -52,6 +55,15 @@ func (b *Book) GenerateMetaTemplate(config Config) error {
 		}
 	}
 
+	// post-process the chapters and apply any chapter titles
+	changes, err := b.FinalizeChapters(ctx, config)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		log.Infof("%s: %s, %s", change.Step, change.Title, change.Description)
+	}
+
 	tmpl, err := template.ParseFS(metadataTemplate, "metadata.ini.tmpl")
 	if err != nil {
 		return err
@@ -79,14 +91,62 @@ func (b *Book) formatDescription(config Config) error {
 		return nil
 	}
 
+	formattedDescription := escapeDescription(string(data))
+	b.Description = &formattedDescription
+
+	return nil
+}
+
+// escapeDescription formats description text for use in the metadata template
+func escapeDescription(description string) string {
 	// replace all newlines with a space and backslash
-	formattedDescription := strings.ReplaceAll(string(data), "\n", " \\\n")
+	formattedDescription := strings.ReplaceAll(description, "\n", " \\\n")
 	// append a final newline to make sure the template isn't munched with the escaping
 	formattedDescription += "\n"
 
-	b.Description = &formattedDescription
+	return formattedDescription
+}
 
-	return nil
+// unescapeDescription reverses escapeDescription for use outside ffmetadata files
+func unescapeDescription(description string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(description, " \\\n", "\n"), "\n")
+}
+
+// ReadChapterTitles reads a chapter titles file, one title per line, skipping blank lines
+func ReadChapterTitles(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Errorln("error reading chapter titles file")
+		return nil, err
+	}
+
+	titles := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimPrefix(string(data), "\ufeff"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		titles = append(titles, line)
+	}
+
+	return titles, nil
+}
+
+// ApplyChapterTitles renames the chapters in order, each title can use the {n} chapter number and {title} generated title placeholders
+func (b *Book) ApplyChapterTitles(titles []string) {
+	if len(titles) < len(b.Chapters) {
+		log.Warnf("found %d chapter titles for %d chapters, the remaining chapters will keep their generated titles", len(titles), len(b.Chapters))
+	} else if len(titles) > len(b.Chapters) {
+		log.Warnf("found %d chapter titles for %d chapters, the extra titles will be ignored", len(titles), len(b.Chapters))
+	}
+
+	for idx, chapter := range b.Chapters {
+		if idx >= len(titles) {
+			break
+		}
+		replacer := strings.NewReplacer("{n}", strconv.Itoa(idx+1), "{title}", chapter.Title)
+		chapter.Title = replacer.Replace(titles[idx])
+	}
 }
 
 // CalcChapterTimes calculates the duration of the chapter
@@ -127,7 +187,7 @@ func (b *Book) ParseFromPattern(tags map[string]string) {
 }
 
 // GenerateStaticChapters creates Chapter objects based on specified length
-func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFile string) error {
+func (b *Book) GenerateStaticChapters(ctx context.Context, config Config, chapterLengthMin int, srcFile string) error {
 	totalMs := int64(0)
 	chapterLenMs := int64(chapterLengthMin * 60 * 1000)
 
@@ -143,7 +203,7 @@ func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFi
 			return err
 		}
 
-		fileData, err := ffprobe.ProbeURL(context.Background(), f.Name())
+		fileData, err := ffprobe.ProbeURL(ctx, f.Name())
 		if err != nil {
 			return err
 		}
@@ -156,7 +216,7 @@ func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFi
 			if err != nil {
 				return err
 			}
-			fileData, err := ffprobe.ProbeURL(context.Background(), f.Name())
+			fileData, err := ffprobe.ProbeURL(ctx, f.Name())
 			totalMs += fileData.Format.Duration().Milliseconds()
 			f.Close()
 		}
@@ -182,7 +242,7 @@ func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFi
 	tracker := int64(0)
 	for i := 0; i < len(b.Chapters); i++ {
 		b.Chapters[i] = new(Chapter)
-		b.Chapters[i].Title = fmt.Sprintf("Chapter %d", i+1)
+		b.Chapters[i].Title = config.ChapterTitle(i+1, "", "")
 		b.Chapters[i].StartMs = tracker
 		tracker += int64(chapterLengthMin * 1000 * 60)
 		b.Chapters[i].EndMs = tracker
@@ -193,7 +253,7 @@ func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFi
 	if extraChapterLen > 0 {
 		log.Debugf("There is an extra chapter required! %dms more needs adding", extraChapterLen)
 		c := new(Chapter)
-		c.Title = fmt.Sprintf("Chapter %d", len(b.Chapters)+1)
+		c.Title = config.ChapterTitle(len(b.Chapters)+1, "", "")
 		stamp := int64(chapterLengthMin * 1000 * 60 * len(b.Chapters))
 		c.StartMs = stamp
 		c.EndMs = stamp + extraChapterLen
@@ -205,15 +265,89 @@ func (b *Book) GenerateStaticChapters(config Config, chapterLengthMin int, srcFi
 	return nil
 }
 
+// ChapterBySilence creates Chapter objects from the silences detected in a single source file, returning the candidate selections when a target chapter count is set
+func (b *Book) ChapterBySilence(ctx context.Context, config Config, srcFile string, opts SilenceOptions) ([]MarkerSelection, error) {
+	// check if the source file specified is a file or a directory, if a directory grab the single file from the slice (error if there's more than one)
+	sourceFile, err := config.CheckForSourceFile(srcFile)
+	if err != nil {
+		return nil, err
+	}
+
+	fileData, err := ffprobe.ProbeURL(ctx, sourceFile)
+	if err != nil {
+		return nil, err
+	}
+	totalMs := fileData.Format.Duration().Milliseconds()
+
+	log.Infoln("Running silence detection, this may take a while depending on the length of the source file.")
+	points, err := GenerateVolMarkers(ctx, sourceFile, opts.MinSilence, opts.NoiseDb)
+	if err != nil {
+		return nil, err
+	}
+
+	// if there's no target chapter count, every marker point is used
+	if opts.Chapters <= 0 {
+		b.ChaptersFromMarkers(config, points, totalMs, opts.MinChapterLengthMs)
+		return nil, nil
+	}
+
+	// rank the marker points and pick the strongest for the requested number of chapters
+	if err := GradeMarkerDepth(ctx, sourceFile, points, opts.MinSilence, opts.NoiseDb); err != nil {
+		return nil, err
+	}
+	selections, err := SelectMarkers(points, opts.Chapters, float64(totalMs)/1000, float64(opts.MinChapterLengthMs)/1000)
+	if err != nil {
+		return selections, err
+	}
+	b.ChaptersFromMarkers(config, PickedMarkers(selections), totalMs, opts.MinChapterLengthMs)
+
+	return selections, nil
+}
+
+// ChaptersFromMarkers creates Chapter objects split at each MarkerPoint, skipping points that would create chapters shorter than minChapterLengthMs
+func (b *Book) ChaptersFromMarkers(config Config, points []MarkerPoint, totalMs, minChapterLengthMs int64) {
+	b.Chapters = make([]*Chapter, 0)
+	startMs := int64(0)
+
+	for _, point := range points {
+		markMs := int64(point.ParseEnd() * 1000)
+		// skip any marks that would leave either side of the split too short
+		if markMs-startMs < minChapterLengthMs || totalMs-markMs < minChapterLengthMs {
+			log.Debugf("skipping marker at %dms, chapter would be shorter than %dms", markMs, minChapterLengthMs)
+			continue
+		}
+
+		b.Chapters = append(b.Chapters, &Chapter{
+			LengthMs: markMs - startMs,
+			StartMs:  startMs,
+			EndMs:    markMs,
+			Number:   len(b.Chapters),
+			Title:    config.ChapterTitle(len(b.Chapters)+1, "", ""),
+		})
+		startMs = markMs
+	}
+
+	// the remaining audio after the last mark is the final chapter
+	if totalMs > startMs {
+		b.Chapters = append(b.Chapters, &Chapter{
+			LengthMs: totalMs - startMs,
+			StartMs:  startMs,
+			EndMs:    totalMs,
+			Number:   len(b.Chapters),
+			Title:    config.ChapterTitle(len(b.Chapters)+1, "", ""),
+		})
+	}
+}
+
 // ParseToChapters creates Chapter objects out of tagged files
-func (b *Book) ParseToChapters(config Config) error {
+func (b *Book) ParseToChapters(ctx context.Context, config Config) error {
 	currentChapter := new(Chapter)
 	chapterIndex := 0
 
 	for _, fileName := range config.transcodeFiles {
 		// parse track file
 		track := TrackFile{}
-		if err := track.Parse(fileName); err != nil {
+		if err := track.Parse(ctx, fileName); err != nil {
 			return err
 		}
 
@@ -252,34 +386,57 @@ func (b *Book) ParseToChapters(config Config) error {
 	b.Chapters = append(b.Chapters, currentChapter)
 	b.CalcChapterTimes()
 
+	// a configured template titles the chapters without a title tag
+	if config.ChapterTitleTemplate != "" {
+		for idx, chapter := range b.Chapters {
+			if chapter.Title != "" {
+				continue
+			}
+			name := ""
+			if len(chapter.Tracks) > 0 {
+				name = filepath.Base(chapter.Tracks[0].File.Name())
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			chapter.Title = config.ChapterTitle(idx+1, name, "")
+		}
+	}
+
 	return nil
 }
 
 // ChapterByFile creates Chapter objects from individual files
-func (b *Book) ChapterByFile(config Config, useFileNames, useTagTitle bool) error {
+func (b *Book) ChapterByFile(ctx context.Context, config Config, useFileNames, useTagTitle bool) error {
 	for idx, filename := range config.transcodeFiles {
 		chapter := new(Chapter)
 		track := TrackFile{}
-		if err := track.Parse(filename); err != nil {
+		if err := track.Parse(ctx, filename); err != nil {
 			return err
 		}
 
-		if useFileNames {
-			// use filename as the Chapter title
-			// capture and remove extension from name
-			name := filepath.Base(track.File.Name())
-			fileExt := filepath.Ext(name)
-			chapter.Title = strings.TrimSuffix(name, fileExt)
-		} else if useTagTitle {
-			// use track title tag as the Chapter title
+		// capture and remove extension from name
+		name := filepath.Base(track.File.Name())
+		fileExt := filepath.Ext(name)
+		name = strings.TrimSuffix(name, fileExt)
+
+		// only read the title tag if it's used
+		tagTitle := ""
+		if useTagTitle || strings.Contains(config.ChapterTitleTemplate, "{tag}") {
 			trackTag, err := tag.ReadFrom(track.File)
 			if err != nil {
 				return err
 			}
-			chapter.Title = trackTag.Title()
+			tagTitle = trackTag.Title()
+		}
+
+		if useFileNames {
+			// use filename as the Chapter title
+			chapter.Title = name
+		} else if useTagTitle {
+			// use track title tag as the Chapter title
+			chapter.Title = tagTitle
 		} else {
-			// Use the index as a Chapter title
-			chapter.Title = fmt.Sprintf("Chapter %d", idx+1)
+			// Use the index, or a configured template, as a Chapter title
+			chapter.Title = config.ChapterTitle(idx+1, name, tagTitle)
 		}
 		chapter.Number = idx
 		chapter.Tracks = []TrackFile{track}
@@ -293,23 +450,83 @@ func (b *Book) ChapterByFile(config Config, useFileNames, useTagTitle bool) erro
 	return nil
 }
 
-// ExtractChapters creates file from embedded chapters
-func (b *Book) ExtractChapters(config Config) error {
-	var err error
-	if len(config.sourceFiles) > 1 {
-		return errors.New("only one source file is allowed for now")
+// ExtractChapters creates Chapter objects from the embedded chapters of each source file, offset by the length of the files before them
+func (b *Book) ExtractChapters(ctx context.Context, config Config) error {
+	prefix := config.PrefixPartNames && len(config.sourceFiles) > 1
+	chapters := make([]*Chapter, 0)
+	offsetMs := int64(0)
+	for _, sourceFile := range config.sourceFiles {
+		fileData, err := ffprobe.ProbeURL(ctx, sourceFile)
+		if err != nil {
+			return err
+		}
+		durationMs := fileData.Format.Duration().Milliseconds()
+
+		partChapters, err := readSourceChapters(ctx, sourceFile)
+		if err != nil {
+			return err
+		}
+		partName := strings.TrimSuffix(filepath.Base(sourceFile), filepath.Ext(sourceFile))
+		if len(partChapters) == 0 {
+			log.Warnf("no embedded chapters found in %s, using the whole file as a chapter", sourceFile)
+		}
+
+		chapters = appendPartChapters(chapters, partChapters, partName, offsetMs, durationMs, prefix)
+		offsetMs += durationMs
 	}
 
-	err = ffmpeg_go.Input(config.sourceFiles[0]).
-		Output(filepath.Join(config.scratchDir, "extracted-chapters.ini"), ffmpeg_go.KwArgs{"f": "ffmetadata"}).
-		OverWriteOutput().
-		Run()
-	if err != nil {
-		return err
+	for idx, chapter := range chapters {
+		chapter.Number = idx
 	}
+	b.Chapters = chapters
+	b.titleUntitledChapters(config)
+
 	return nil
 }
 
+// readSourceChapters returns the embedded chapters of a source file, reading the ID3 chapter frames of MP3 files directly
+func readSourceChapters(ctx context.Context, sourceFile string) ([]*Chapter, error) {
+	if strings.EqualFold(filepath.Ext(sourceFile), Mp3) {
+		chapters, err := ReadID3Chapters(sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(chapters) > 0 {
+			return chapters, nil
+		}
+	}
+
+	return ReadEmbeddedChapters(ctx, sourceFile)
+}
+
+// appendPartChapters appends the chapters of a source file starting at offsetMs, the last one running to the end of the file, using the whole file as a chapter when it has none
+func appendPartChapters(chapters, partChapters []*Chapter, partName string, offsetMs, durationMs int64, prefix bool) []*Chapter {
+	if len(partChapters) == 0 {
+		return append(chapters, &Chapter{
+			StartMs:  offsetMs,
+			EndMs:    offsetMs + durationMs,
+			LengthMs: durationMs,
+			Title:    partName,
+		})
+	}
+
+	for idx, chapter := range partChapters {
+		chapter.StartMs += offsetMs
+		chapter.EndMs += offsetMs
+		// keep the chapters of each part back to back with the next part
+		if idx == len(partChapters)-1 {
+			chapter.EndMs = offsetMs + durationMs
+		}
+		chapter.LengthMs = chapter.EndMs - chapter.StartMs
+		if prefix {
+			chapter.Title = fmt.Sprintf("%s - %s", partName, chapter.Title)
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters
+}
+
 // generateSortSlug parses metadata for sort metadata
 func (b *Book) generateSortSlug() {
 	// if series name and part are present, generate Sort property
@@ -1,10 +1,12 @@
 package audiobooker
 
 import (
+	"context"
 	"github.com/cslamar/mp4tag"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -104,7 +106,7 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 	}
 
 	// fail execute case
-	err = book.GenerateMetaTemplate(Config{})
+	err = book.GenerateMetaTemplate(context.Background(), Config{})
 	assert.Error(suite.T(), err)
 
 	// success case
@@ -113,10 +115,10 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 		SourceFilesPath:  suite.ScratchPath,
 		ScratchFilesPath: suite.ScratchPath,
 	}
-	err = config.New()
+	err = config.New(context.Background())
 	assert.Nil(suite.T(), err)
 
-	err = book.GenerateMetaTemplate(config)
+	err = book.GenerateMetaTemplate(context.Background(), config)
 	assert.Nil(suite.T(), err)
 
 	fileInfo, err := config.ChaptersFile.Stat()
@@ -132,7 +134,7 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 		SourceFilesPath:  suite.ScratchPath,
 		ScratchFilesPath: suite.ScratchPath,
 	}
-	err = c2.New()
+	err = c2.New(context.Background())
 	assert.Nil(suite.T(), err)
 
 	seriesName := "Series Name"
@@ -152,7 +154,7 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 		seriesPart: &seriesPart,
 	}
 
-	err = b2.GenerateMetaTemplate(c2)
+	err = b2.GenerateMetaTemplate(context.Background(), c2)
 	assert.Nil(suite.T(), err)
 
 	fInfo2, err := c2.ChaptersFile.Stat()
@@ -166,7 +168,7 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 		SourceFilesPath:  suite.ScratchPath,
 		ScratchFilesPath: suite.ScratchPath,
 	}
-	err = c3.New()
+	err = c3.New(context.Background())
 	assert.Nil(suite.T(), err)
 
 	b3 := &Book{
@@ -182,7 +184,7 @@ func (suite *BookTestSuite) TestGenerateMetaTemplate() {
 		seriesName: &seriesName,
 	}
 
-	err = b3.GenerateMetaTemplate(c3)
+	err = b3.GenerateMetaTemplate(context.Background(), c3)
 	assert.Nil(suite.T(), err)
 
 	fInfo3, err := c3.ChaptersFile.Stat()
@@ -196,33 +198,51 @@ func (suite *BookTestSuite) TestChapterByFile() {
 
 	// use file names as chapter names
 	b1 := Book{}
-	err = b1.ChapterByFile(suite.Config, true, false)
+	err = b1.ChapterByFile(context.Background(), suite.Config, true, false)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 3, len(b1.Chapters))
 
 	// use file tag's title as chapter name
 	b2 := Book{}
-	err = b2.ChapterByFile(suite.Config, false, true)
+	err = b2.ChapterByFile(context.Background(), suite.Config, false, true)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 3, len(b2.Chapters))
 
 	// use file order as chapter name
 	b3 := Book{}
-	err = b3.ChapterByFile(suite.Config, false, false)
+	err = b3.ChapterByFile(context.Background(), suite.Config, false, false)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 3, len(b3.Chapters))
 
 	// error parsing track file
 	c4 := Config{transcodeFiles: []string{"no-file.mp3"}}
 	b4 := Book{}
-	err = b4.ChapterByFile(c4, false, false)
+	err = b4.ChapterByFile(context.Background(), c4, false, false)
 	assert.Error(suite.T(), err)
 
 	// error parsing file tag
 	c5 := Config{transcodeFiles: []string{filepath.Join(TestDataRoot, "files/no-tag.mp3")}}
 	b5 := Book{}
-	err = b5.ChapterByFile(c5, false, true)
+	err = b5.ChapterByFile(context.Background(), c5, false, true)
 	assert.Error(suite.T(), err)
+
+	// a chapter title template doesn't override file names or tag titles
+	c6 := suite.Config
+	c6.ChapterTitleTemplate = "Part {n}"
+	b6 := Book{}
+	err = b6.ChapterByFile(context.Background(), c6, true, false)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), b1.Chapters[0].Title, b6.Chapters[0].Title)
+	b7 := Book{}
+	err = b7.ChapterByFile(context.Background(), c6, false, true)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), b2.Chapters[0].Title, b7.Chapters[0].Title)
+
+	// a chapter title template titles chapters by file order
+	b8 := Book{}
+	err = b8.ChapterByFile(context.Background(), c6, false, false)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "Part 2", b8.Chapters[1].Title)
 }
 
 func (suite *BookTestSuite) TestParseToChapters() {
@@ -230,7 +250,7 @@ func (suite *BookTestSuite) TestParseToChapters() {
 
 	// successful operation
 	b1 := Book{}
-	err = b1.ParseToChapters(suite.Config)
+	err = b1.ParseToChapters(context.Background(), suite.Config)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 3, len(b1.Chapters))
 
@@ -239,14 +259,23 @@ func (suite *BookTestSuite) TestParseToChapters() {
 		transcodeFiles: []string{"no-file.mp3"},
 	}
 	b2 := Book{}
-	err = b2.ParseToChapters(c2)
+	err = b2.ParseToChapters(context.Background(), c2)
 	assert.Error(suite.T(), err)
 
 	// error parsing file tag
 	c3 := Config{transcodeFiles: []string{filepath.Join(TestDataRoot, "files/no-tag.mp3")}}
 	b3 := Book{}
-	err = b3.ParseToChapters(c3)
+	err = b3.ParseToChapters(context.Background(), c3)
 	assert.Error(suite.T(), err)
+
+	// a chapter title template doesn't retitle chapters with a title tag
+	c4 := suite.Config
+	c4.ChapterTitleTemplate = "Part {n}"
+	b4 := Book{}
+	err = b4.ParseToChapters(context.Background(), c4)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), b1.Chapters[0].Title, b4.Chapters[0].Title)
+	assert.NotEqual(suite.T(), "Part 1", b4.Chapters[0].Title)
 }
 
 func (suite *BookTestSuite) TestGenerateStaticChapters() {
@@ -255,7 +284,7 @@ func (suite *BookTestSuite) TestGenerateStaticChapters() {
 		transcodeFiles: []string{filepath.Join(TestDataRoot, "misc/60-min.m4a")},
 	}
 	b1 := Book{}
-	err := b1.GenerateStaticChapters(c1, 5, "")
+	err := b1.GenerateStaticChapters(context.Background(), c1, 5, "")
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 12, len(b1.Chapters))
 
@@ -264,7 +293,7 @@ func (suite *BookTestSuite) TestGenerateStaticChapters() {
 		transcodeFiles: []string{filepath.Join(TestDataRoot, "misc/4-min.m4a")},
 	}
 	b2 := Book{}
-	err = b2.GenerateStaticChapters(c2, 5, "")
+	err = b2.GenerateStaticChapters(context.Background(), c2, 5, "")
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 0, len(b2.Chapters))
 
@@ -273,7 +302,7 @@ func (suite *BookTestSuite) TestGenerateStaticChapters() {
 		transcodeFiles: []string{filepath.Join(TestDataRoot, "misc/8-min.m4a")},
 	}
 	b3 := Book{}
-	err = b3.GenerateStaticChapters(c3, 5, "")
+	err = b3.GenerateStaticChapters(context.Background(), c3, 5, "")
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 2, len(b3.Chapters))
 
@@ -282,7 +311,7 @@ func (suite *BookTestSuite) TestGenerateStaticChapters() {
 		transcodeFiles: []string{filepath.Join(TestDataRoot, "misc/8-min.m4a")},
 	}
 	b4 := Book{}
-	err = b4.GenerateStaticChapters(c4, 3, "")
+	err = b4.GenerateStaticChapters(context.Background(), c4, 3, "")
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 3, len(b4.Chapters))
 
@@ -291,7 +320,7 @@ func (suite *BookTestSuite) TestGenerateStaticChapters() {
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc", "60-min-book.m4b")},
 	}
 	b5 := Book{}
-	err = b5.GenerateStaticChapters(c5, 5, filepath.Join(TestDataRoot, "misc", "60-min-book.m4b"))
+	err = b5.GenerateStaticChapters(context.Background(), c5, 5, filepath.Join(TestDataRoot, "misc", "60-min-book.m4b"))
 	assert.Nil(suite.T(), err)
 }
 
@@ -304,7 +333,7 @@ func (suite *BookTestSuite) TestBindEmbeddedChapters() {
 		SourceFilesPath:  filepath.Join(TestDataRoot, "misc/embedded-chapters.opus"),
 		VerboseTranscode: true,
 	}
-	err = c1.New()
+	err = c1.New(context.Background())
 	assert.Nil(suite.T(), err)
 
 	imgFile := filepath.Join(TestDataRoot, "misc/cover.jpg")
@@ -320,15 +349,15 @@ func (suite *BookTestSuite) TestBindEmbeddedChapters() {
 	}
 
 	// generate book meta
-	err = b1.GenerateMetaTemplate(c1)
+	err = b1.GenerateMetaTemplate(context.Background(), c1)
 	assert.Nil(suite.T(), err)
 
 	// pull embed
-	err = b1.ExtractChapters(c1)
+	err = b1.ExtractChapters(context.Background(), c1)
 	assert.Nil(suite.T(), err)
 
 	// bind
-	err = Bind(c1, b1)
+	err = Bind(context.Background(), c1, b1)
 	assert.Nil(suite.T(), err)
 }
 
@@ -342,7 +371,7 @@ func (suite *BookTestSuite) TestEmbedDescription() {
 		SourceFilesPath:  filepath.Join(TestDataRoot, "misc", "Test Author", "Test Book", "Title One"),
 		VerboseTranscode: true,
 	}
-	err = c1.New()
+	err = c1.New(context.Background())
 	assert.Nil(suite.T(), err)
 
 	// Create dummy book
@@ -352,7 +381,7 @@ func (suite *BookTestSuite) TestEmbedDescription() {
 	}
 
 	// generate metadata template
-	err = b1.GenerateMetaTemplate(c1)
+	err = b1.GenerateMetaTemplate(context.Background(), c1)
 	// check for error
 	assert.Nil(suite.T(), err)
 	// check for existence of description
@@ -366,7 +395,7 @@ func (suite *BookTestSuite) TestEmbedDescription() {
 		SourceFilesPath:  filepath.Join(TestDataRoot, "misc", "Test Author", "Test Book", "Title One"),
 		VerboseTranscode: true,
 	}
-	err = c2.New()
+	err = c2.New(context.Background())
 	assert.Nil(suite.T(), err)
 	// set empty description file and check for file pointer error
 	c2.descriptionFile, err = os.Open(filepath.Join(TestDataRoot, "misc", "empty.txt"))
@@ -379,7 +408,7 @@ func (suite *BookTestSuite) TestEmbedDescription() {
 	}
 
 	// attempt to generate a description, it should not error even though it does not exist
-	err = b2.GenerateMetaTemplate(c2)
+	err = b2.GenerateMetaTemplate(context.Background(), c2)
 	assert.Nil(suite.T(), err)
 
 }
@@ -505,3 +534,141 @@ func (suite *BookTestSuite) TestFormatDescription() {
 	err = b3.formatDescription(c3)
 	assert.Nil(suite.T(), err)
 }
+
+// generateSilenceTestFile generates a tone broken by a 3 and a 5 second silence as an mp3 file
+func generateSilenceTestFile(scratchPath string) (string, error) {
+	srcFile := filepath.Join(scratchPath, "3and5-sec-silence.mp3")
+	// the silences run a little past 3 and 5 seconds, so the mp3 encoder's padding can't shorten them below the minimum
+	tone := ffmpeg_go.Input("aevalsrc='if(between(t,2,5.2)+between(t,7.2,12.4),0,sin(440*2*PI*t))':s=44100:d=14.4", ffmpeg_go.KwArgs{"f": "lavfi"})
+	if err := tone.Output(srcFile, ffmpeg_go.KwArgs{"c:a": "libmp3lame"}).OverWriteOutput().Run(); err != nil {
+		return "", err
+	}
+	return srcFile, nil
+}
+
+func (suite *BookTestSuite) TestChapterBySilence() {
+	srcFile, err := generateSilenceTestFile(suite.ScratchPath)
+	if !assert.Nil(suite.T(), err) {
+		return
+	}
+
+	// split on both the 3 and 5 second silences
+	c1 := Config{}
+	b1 := Book{}
+	_, err = b1.ChapterBySilence(context.Background(), c1, srcFile, SilenceOptions{MinSilence: 3, NoiseDb: -30})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(b1.Chapters))
+
+	// error on missing source file
+	b2 := Book{}
+	_, err = b2.ChapterBySilence(context.Background(), c1, "no-file.mp3", SilenceOptions{MinSilence: 3, NoiseDb: -30})
+	assert.Error(suite.T(), err)
+
+	// pick the single strongest silence for two chapters
+	b3 := Book{}
+	selections, err := b3.ChapterBySilence(context.Background(), c1, srcFile, SilenceOptions{Chapters: 2, MinSilence: 3, NoiseDb: -30})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(selections))
+	assert.Equal(suite.T(), 2, len(b3.Chapters))
+}
+
+func (suite *BookTestSuite) TestChaptersFromMarkers() {
+	points := []MarkerPoint{
+		{Duration: 2, End: 2},
+		{Duration: 2, End: 61},
+		{Duration: 4, End: 122},
+		{Duration: 2, End: 131},
+	}
+
+	// every marker creates a chapter
+	b1 := Book{}
+	b1.ChaptersFromMarkers(Config{}, points, 180000, 0)
+	assert.Equal(suite.T(), 5, len(b1.Chapters))
+	assert.Equal(suite.T(), int64(1000), b1.Chapters[0].EndMs)
+	assert.Equal(suite.T(), "Chapter 5", b1.Chapters[4].Title)
+	assert.Equal(suite.T(), int64(180000), b1.Chapters[4].EndMs)
+
+	// markers closer than the minimum chapter length are skipped
+	b2 := Book{}
+	b2.ChaptersFromMarkers(Config{}, points, 180000, 30000)
+	assert.Equal(suite.T(), 3, len(b2.Chapters))
+	assert.Equal(suite.T(), int64(0), b2.Chapters[0].StartMs)
+	assert.Equal(suite.T(), int64(60000), b2.Chapters[0].EndMs)
+	assert.Equal(suite.T(), int64(60000), b2.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(120000), b2.Chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(60000), b2.Chapters[2].LengthMs)
+	assert.Equal(suite.T(), 2, b2.Chapters[2].Number)
+
+	// no markers creates a single chapter
+	b3 := Book{}
+	b3.ChaptersFromMarkers(Config{}, nil, 180000, 30000)
+	assert.Equal(suite.T(), 1, len(b3.Chapters))
+	assert.Equal(suite.T(), int64(180000), b3.Chapters[0].LengthMs)
+}
+
+func (suite *BookTestSuite) TestApplyChapterTitles() {
+	titlesFile := filepath.Join(UtScratchDirectory, "chapters.txt")
+	err := os.WriteFile(titlesFile, []byte("\ufeffPrologue\n\n  {n}: Of the Nature of War  \nChapter {n} ({title})\n"), 0644)
+	assert.Nil(suite.T(), err)
+
+	titles, err := ReadChapterTitles(titlesFile)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"Prologue", "{n}: Of the Nature of War", "Chapter {n} ({title})"}, titles)
+
+	// chapters are renamed in order with the placeholders filled in
+	b1 := Book{Chapters: []*Chapter{{Title: "Chapter 1"}, {Title: "Chapter 2"}, {Title: "01-track"}}}
+	b1.ApplyChapterTitles(titles)
+	assert.Equal(suite.T(), "Prologue", b1.Chapters[0].Title)
+	assert.Equal(suite.T(), "2: Of the Nature of War", b1.Chapters[1].Title)
+	assert.Equal(suite.T(), "Chapter 3 (01-track)", b1.Chapters[2].Title)
+
+	// remaining chapters keep their generated titles when there are fewer titles than chapters
+	b2 := Book{Chapters: []*Chapter{{Title: "Chapter 1"}, {Title: "Chapter 2"}}}
+	b2.ApplyChapterTitles(titles[:1])
+	assert.Equal(suite.T(), "Prologue", b2.Chapters[0].Title)
+	assert.Equal(suite.T(), "Chapter 2", b2.Chapters[1].Title)
+
+	// extra titles are ignored
+	b3 := Book{Chapters: []*Chapter{{Title: "Chapter 1"}}}
+	b3.ApplyChapterTitles(titles)
+	assert.Equal(suite.T(), 1, len(b3.Chapters))
+	assert.Equal(suite.T(), "Prologue", b3.Chapters[0].Title)
+
+	_, err = ReadChapterTitles(filepath.Join(UtScratchDirectory, "missing.txt"))
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *BookTestSuite) TestAppendPartChapters() {
+	part1 := []*Chapter{
+		{StartMs: 0, EndMs: 60000, Title: "Book One"},
+		{StartMs: 60000, EndMs: 119500, Title: "Book Two"},
+	}
+	part2 := []*Chapter{
+		{StartMs: 0, EndMs: 30000, Title: "Book Three"},
+		{StartMs: 30000, EndMs: 90000, Title: "Book Four"},
+	}
+
+	// chapters of later parts are offset by the length of the parts before them
+	chapters := appendPartChapters(nil, part1, "Part 1", 0, 120000, false)
+	chapters = appendPartChapters(chapters, part2, "Part 2", 120000, 90000, false)
+	assert.Equal(suite.T(), 4, len(chapters))
+	assert.Equal(suite.T(), int64(120000), chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(60000), chapters[1].LengthMs)
+	assert.Equal(suite.T(), int64(120000), chapters[2].StartMs)
+	assert.Equal(suite.T(), int64(150000), chapters[2].EndMs)
+	assert.Equal(suite.T(), int64(150000), chapters[3].StartMs)
+	assert.Equal(suite.T(), int64(210000), chapters[3].EndMs)
+	assert.Equal(suite.T(), "Book Three", chapters[2].Title)
+
+	// titles are prefixed with the part name when requested
+	chapters = appendPartChapters(nil, []*Chapter{{StartMs: 0, EndMs: 5000, Title: "Book One"}}, "Part 1", 0, 5000, true)
+	assert.Equal(suite.T(), "Part 1 - Book One", chapters[0].Title)
+
+	// parts without chapters become a single chapter named after the part
+	chapters = appendPartChapters(chapters, nil, "Part 2", 5000, 10000, true)
+	assert.Equal(suite.T(), 2, len(chapters))
+	assert.Equal(suite.T(), "Part 2", chapters[1].Title)
+	assert.Equal(suite.T(), int64(5000), chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(15000), chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(10000), chapters[1].LengthMs)
+}
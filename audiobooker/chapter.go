@@ -2,11 +2,11 @@ package audiobooker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/vansante/go-ffprobe.v2"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -40,27 +40,44 @@ func (c *Chapter) Compile() {
 
 // cueEntry holds the parsed chapter info based on a CUE SHEET
 type cueEntry struct {
-	Track              int
-	Title              string
-	TimeEndMs          int64
-	TimeStartStr       string
-	TimeStartMs        int64
-	LengthMs           int64
-	trackStartDuration time.Duration
+	Track       int
+	Title       string
+	TimeEndMs   int64
+	TimeStartMs int64
+	LengthMs    int64
 }
 
-// parseTimeCode parses CUE SHEET time code into a duration
-func (c *cueEntry) parseTimeCode(timeCode string) error {
+// cueFramesPerSecond number of frames in each second of a CUE SHEET time code
+const cueFramesPerSecond = 75
+
+// parseCueTimeCode parses a CUE SHEET mm:ss:ff time code into a duration, including the frames
+func parseCueTimeCode(timeCode string) (time.Duration, error) {
 	timeValues := strings.Split(timeCode, ":")
-	//toParse := fmt.Sprintf("%sm%ss%sms", timeValues[0], timeValues[1], timeValues[2]) // TODO could work out way to calculate frames if desired...
-	toParse := fmt.Sprintf("%sm%ss", timeValues[0], timeValues[1])
-	duration, err := time.ParseDuration(toParse)
-	if err != nil {
-		return err
+	if len(timeValues) != 3 {
+		return 0, fmt.Errorf("invalid CUE time code %q, must be mm:ss:ff", timeCode)
+	}
+
+	values := make([]int, len(timeValues))
+	for idx, value := range timeValues {
+		// only plain digits are allowed, no signs or decimals
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return 0, fmt.Errorf("invalid CUE time code %q, must be mm:ss:ff", timeCode)
+		}
+		values[idx], _ = strconv.Atoi(value)
 	}
 
-	c.trackStartDuration = duration
-	return nil
+	minutes, seconds, frames := values[0], values[1], values[2]
+	if seconds >= 60 {
+		return 0, fmt.Errorf("CUE time code %q is out of range, seconds must be less than 60", timeCode)
+	}
+	if frames >= cueFramesPerSecond {
+		return 0, fmt.Errorf("CUE time code %q is out of range, frames must be less than %d", timeCode, cueFramesPerSecond)
+	}
+
+	duration := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	duration += time.Duration(frames) * time.Second / cueFramesPerSecond
+
+	return duration, nil
 }
 
 // toChapter converts a cueEntry to a Chapter
@@ -75,12 +92,14 @@ func (c *cueEntry) toChapter() Chapter {
 }
 
 // parseFromCueTag creates Chapter object from embedded CUESHEET tag
-func parseFromCueTag(config Config) ([]cueEntry, error) {
+func parseFromCueTag(ctx context.Context, config Config) ([]cueEntry, error) {
 	f, err := os.Open(config.sourceFiles[0])
 	if err != nil {
 		return nil, err
 	}
-	fileMetadata, err := ffprobe.ProbeURL(context.Background(), f.Name())
+	defer f.Close()
+
+	fileMetadata, err := ffprobe.ProbeURL(ctx, f.Name())
 	if err != nil {
 		return nil, err
 	}
@@ -102,66 +121,50 @@ func parseFromCueTag(config Config) ([]cueEntry, error) {
 
 	log.Debugln(rawCueSheet)
 
-	// prepare for cue entry parsing
-	var entry *cueEntry
+	sheet, err := ParseCueSheet(strings.NewReader(rawCueSheet))
+	if err != nil {
+		return nil, err
+	}
+
+	// an embedded CUE SHEET describes a single file, so every track start is relative to the start of the file
 	entries := make([]cueEntry, 0)
-	trackCount := 1
-
-	// loop through the raw CUE SHEET split by newlines
-	for _, val := range strings.Split(rawCueSheet, "\n") {
-		// sanitize the leading and trailing spaces prior to parsing
-		clean := strings.TrimSpace(val)
-		if strings.HasPrefix(clean, "TRACK ") {
-			// if the line starts with TRACK, create a new entry and assign the index value to it
-			entry = new(cueEntry)
-			// TODO maybe grab track number from regexp?
-			entry.Track = trackCount
-		} else if strings.HasPrefix(clean, "TITLE") {
-			// if the line starts with TITLE, clean it up and store it as the chapter title
-			clean = strings.TrimPrefix(clean, "TITLE ")
-			clean = strings.ReplaceAll(clean, `"`, "")
-			entry.Title = clean
-		} else if strings.HasPrefix(clean, "INDEX") {
-			// if the line begins with INDEX, sanitize and capture the time code for later usage
-			re := regexp.MustCompile(`INDEX \d+ `)
-			clean = re.ReplaceAllString(clean, "")
-			entry.TimeStartStr = clean
-			// parse the string time into a usable time.Duration format for later
-			if err := entry.parseTimeCode(clean); err != nil {
-				log.Errorln(err)
+	for _, file := range sheet.Files {
+		for _, track := range file.Tracks {
+			start, ok := track.Start()
+			if !ok {
+				log.Warnf("track %d has no INDEX entry, skipping", track.Number)
 				continue
 			}
-
-			// append the completed entry to the entries slice
-			entries = append(entries, *entry)
-			trackCount++
+			if start.Milliseconds() >= fullTrackMs {
+				return nil, fmt.Errorf("track %d starts at %s, after the end of the audio", track.Number, start)
+			}
+			if len(entries) > 0 && start.Milliseconds() <= entries[len(entries)-1].TimeStartMs {
+				return nil, fmt.Errorf("track %d starts at %s, which is not after the track before it", track.Number, start)
+			}
+			entries = append(entries, cueEntry{
+				Track:       len(entries) + 1,
+				Title:       track.Title,
+				TimeStartMs: start.Milliseconds(),
+			})
 		}
 	}
 
-	tracker := int64(0)
-
-	for idx := 0; idx < len(entries); idx++ {
-		if idx == 0 {
-			// if at the first element
-			// figure out starting inference
-			log.Debugf("at the first element\n")
-			entries[idx].TimeStartMs = 0
-			tracker += entries[idx+1].trackStartDuration.Milliseconds()
-			entries[idx].TimeEndMs = tracker
-			log.Debugf("track %d starts at %dms and ends at %dms\n", entries[idx].Track, 0, entries[idx].TimeEndMs)
-		} else if idx == (len(entries) - 1) {
-			// if at the last element
-			log.Debugf("at the last element\n")
-			entries[idx].TimeStartMs = tracker
+	if len(entries) == 0 {
+		return nil, errors.New("no tracks with INDEX entries found in CUESHEET tag")
+	}
+
+	// the first track always starts at the beginning of the file
+	entries[0].TimeStartMs = 0
+
+	// each track runs until the next one starts, the last runs until the end of the file
+	for idx := range entries {
+		if idx == len(entries)-1 {
 			entries[idx].TimeEndMs = fullTrackMs
-			log.Debugf("track %d starts at %d and ends at %d\n", entries[idx].Track, entries[idx].TimeStartMs, entries[idx].TimeEndMs)
 		} else {
-			// must be somewhere in the middle
-			entries[idx].TimeStartMs = tracker
-			tracker += entries[idx+1].trackStartDuration.Milliseconds() - tracker
-			entries[idx].TimeEndMs = tracker
-			log.Debugf("track %d starts at %d element and ends at %d\n", entries[idx].Track, entries[idx].TimeStartMs, entries[idx].TimeEndMs)
+			entries[idx].TimeEndMs = entries[idx+1].TimeStartMs
 		}
+		entries[idx].LengthMs = entries[idx].TimeEndMs - entries[idx].TimeStartMs
+		log.Debugf("track %d starts at %dms and ends at %dms\n", entries[idx].Track, entries[idx].TimeStartMs, entries[idx].TimeEndMs)
 	}
 
 	return entries, nil
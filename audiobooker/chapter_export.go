@@ -0,0 +1,285 @@
+package audiobooker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// chapter list formats
+const (
+	ChapterFormatAudacity   = "audacity"
+	ChapterFormatCue        = "cue"
+	ChapterFormatFFMetadata = "ffmetadata"
+	ChapterFormatJson       = "json"
+	ChapterFormatMp4Chaps   = "mp4chaps"
+)
+
+// ChapterFormats list of the supported chapter list formats
+var ChapterFormats = []string{
+	ChapterFormatAudacity,
+	ChapterFormatCue,
+	ChapterFormatFFMetadata,
+	ChapterFormatJson,
+	ChapterFormatMp4Chaps,
+}
+
+// chapterFormatExtensions file extensions used when exporting chapters next to a bound book
+var chapterFormatExtensions = map[string]string{
+	ChapterFormatAudacity:   ".labels.txt",
+	ChapterFormatCue:        ".cue",
+	ChapterFormatFFMetadata: ".chapters.ini",
+	ChapterFormatJson:       ".chapters.json",
+	ChapterFormatMp4Chaps:   ".chapters.txt",
+}
+
+// jsonChapters holds the JSON representation of a book's chapters
+type jsonChapters struct {
+	Author   string        `json:"author,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Chapters []jsonChapter `json:"chapters"`
+}
+
+// jsonChapter holds the JSON representation of a chapter
+type jsonChapter struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	Start    string `json:"start"`
+	StartMs  int64  `json:"start_ms"`
+	EndMs    int64  `json:"end_ms"`
+	LengthMs int64  `json:"length_ms"`
+}
+
+// probeChapters holds the chapters output of ffprobe
+type probeChapters struct {
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// CheckChapterFormat returns an error if the chapter list format is not supported
+func CheckChapterFormat(format string) error {
+	for _, chapterFormat := range ChapterFormats {
+		if format == chapterFormat {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported chapter format %q, must be one of: %s", format, strings.Join(ChapterFormats, ", "))
+}
+
+// ReadEmbedded loads the chapters, title, and author embedded in an audio file, untitled chapters are titled with the chapter title template of the config
+func (b *Book) ReadEmbedded(ctx context.Context, config Config, filename string) error {
+	fileData, err := ffprobe.ProbeURL(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	// prefer the album tag for the title since that's where bound books keep it
+	if album, err := fileData.Format.TagList.GetString("album"); err == nil && album != "" {
+		b.Title = album
+	} else if title, err := fileData.Format.TagList.GetString("title"); err == nil {
+		b.Title = title
+	}
+	if artist, err := fileData.Format.TagList.GetString("artist"); err == nil {
+		b.Author = artist
+	}
+
+	b.Chapters, err = readSourceChapters(ctx, filename)
+	if err != nil {
+		return err
+	}
+	b.titleUntitledChapters(config)
+
+	return nil
+}
+
+// ReadEmbeddedChapters returns the chapters embedded in an audio file, untitled chapters are left without a title
+func ReadEmbeddedChapters(ctx context.Context, filename string) ([]*Chapter, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-loglevel", "error", "-print_format", "json", "-show_chapters", filename)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading chapters from %s: %v", filename, err)
+	}
+
+	return parseProbeChapters(output)
+}
+
+// parseProbeChapters converts ffprobe chapters JSON output into Chapter objects, leaving untitled chapters for the chapter title template
+func parseProbeChapters(data []byte) ([]*Chapter, error) {
+	probed := probeChapters{}
+	if err := json.Unmarshal(data, &probed); err != nil {
+		return nil, err
+	}
+
+	chapters := make([]*Chapter, len(probed.Chapters))
+	for idx, probedChapter := range probed.Chapters {
+		start, err := strconv.ParseFloat(probedChapter.StartTime, 64)
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.ParseFloat(probedChapter.EndTime, 64)
+		if err != nil {
+			return nil, err
+		}
+		chapter := &Chapter{
+			Number:  idx,
+			StartMs: secondsToMs(start),
+			EndMs:   secondsToMs(end),
+			Title:   probedChapter.Tags["title"],
+		}
+		chapter.LengthMs = chapter.EndMs - chapter.StartMs
+		chapters[idx] = chapter
+	}
+
+	return chapters, nil
+}
+
+// ExportChapters writes the chapters of the book to w in the given format, audioFile is the file referenced by CUE sheets
+func ExportChapters(w io.Writer, book Book, format, audioFile string) error {
+	if err := CheckChapterFormat(format); err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	switch format {
+	case ChapterFormatAudacity:
+		// label tracks are tab separated start, end, and label with times in seconds
+		for _, chapter := range book.Chapters {
+			fmt.Fprintf(&out, "%.6f\t%.6f\t%s\n", float64(chapter.StartMs)/1000, float64(chapter.EndMs)/1000, chapter.Title)
+		}
+	case ChapterFormatCue:
+		fileType := "WAVE"
+		if strings.EqualFold(filepath.Ext(audioFile), Mp3) {
+			fileType = "MP3"
+		}
+		if book.Author != "" {
+			fmt.Fprintf(&out, "PERFORMER %s\n", quoteCueString(book.Author))
+		}
+		if book.Title != "" {
+			fmt.Fprintf(&out, "TITLE %s\n", quoteCueString(book.Title))
+		}
+		fmt.Fprintf(&out, "FILE %s %s\n", quoteCueString(filepath.Base(audioFile)), fileType)
+		for idx, chapter := range book.Chapters {
+			fmt.Fprintf(&out, "  TRACK %02d AUDIO\n", idx+1)
+			fmt.Fprintf(&out, "    TITLE %s\n", quoteCueString(chapter.Title))
+			fmt.Fprintf(&out, "    INDEX 01 %s\n", formatCueTimeCode(chapter.StartMs))
+		}
+	case ChapterFormatFFMetadata:
+		out.WriteString(";FFMETADATA1\n")
+		if book.Title != "" {
+			fmt.Fprintf(&out, "title=%s\n", escapeFFMetadata(book.Title))
+		}
+		if book.Author != "" {
+			fmt.Fprintf(&out, "artist=%s\n", escapeFFMetadata(book.Author))
+		}
+		for _, chapter := range book.Chapters {
+			fmt.Fprintf(&out, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", chapter.StartMs, chapter.EndMs, escapeFFMetadata(chapter.Title))
+		}
+	case ChapterFormatJson:
+		data := jsonChapters{Author: book.Author, Title: book.Title, Chapters: make([]jsonChapter, len(book.Chapters))}
+		for idx, chapter := range book.Chapters {
+			data.Chapters[idx] = jsonChapter{
+				Number:   idx + 1,
+				Title:    chapter.Title,
+				Start:    formatTimestamp(chapter.StartMs),
+				StartMs:  chapter.StartMs,
+				EndMs:    chapter.EndMs,
+				LengthMs: chapter.EndMs - chapter.StartMs,
+			}
+		}
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		out.Write(encoded)
+		out.WriteString("\n")
+	case ChapterFormatMp4Chaps:
+		for _, chapter := range book.Chapters {
+			fmt.Fprintf(&out, "%s %s\n", formatTimestamp(chapter.StartMs), chapter.Title)
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// ExportBookChapters writes the chapters of a bound book next to the output file in each of the configured formats
+func ExportBookChapters(ctx context.Context, config Config, book Book) error {
+	outputFile := filepath.Join(config.OutputPath, config.OutputFile)
+
+	// chapters pulled straight from a source file aren't held in memory, so read them back from the bound book
+	if len(book.Chapters) == 0 {
+		chapters, err := ReadEmbeddedChapters(ctx, outputFile)
+		if err != nil {
+			return err
+		}
+		book.Chapters = chapters
+		book.titleUntitledChapters(config)
+	}
+	if len(book.Chapters) == 0 {
+		log.Warnln("no chapters found to export")
+		return nil
+	}
+
+	base := strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	for _, format := range config.ExportChapterFormats {
+		if err := CheckChapterFormat(format); err != nil {
+			return err
+		}
+		exportFile := base + chapterFormatExtensions[format]
+		f, err := os.Create(exportFile)
+		if err != nil {
+			return err
+		}
+		if err := ExportChapters(f, book, format, outputFile); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.Infof("exported %s chapters to %s", format, exportFile)
+	}
+
+	return nil
+}
+
+// formatTimestamp formats milliseconds as a HH:MM:SS.mmm timestamp
+func formatTimestamp(ms int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, ms%1000)
+}
+
+// formatCueTimeCode formats milliseconds as a CUE SHEET mm:ss:ff time code, rounded to the nearest frame
+func formatCueTimeCode(ms int64) string {
+	frames := (ms*cueFramesPerSecond + 500) / 1000
+	return fmt.Sprintf("%02d:%02d:%02d", frames/(cueFramesPerSecond*60), (frames/cueFramesPerSecond)%60, frames%cueFramesPerSecond)
+}
+
+// quoteCueString wraps a CUE SHEET value in quotes, swapping out any quotes within it
+func quoteCueString(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, "'") + `"`
+}
+
+// escapeFFMetadata escapes the special characters of an ffmetadata value
+func escapeFFMetadata(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+	return replacer.Replace(value)
+}
+
+// secondsToMs converts fractional seconds to milliseconds, rounded to the nearest millisecond
+func secondsToMs(seconds float64) int64 {
+	if seconds < 0 {
+		return 0
+	}
+	return int64(seconds*1000 + 0.5)
+}
@@ -0,0 +1,127 @@
+package audiobooker
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChapterExportTestSuite struct {
+	suite.Suite
+	book Book
+}
+
+func (suite *ChapterExportTestSuite) SetupTest() {
+	suite.book = Book{
+		Author: "Carl von Clausewitz",
+		Title:  "On War",
+		Chapters: []*Chapter{
+			{Number: 0, StartMs: 0, EndMs: 630500, LengthMs: 630500, Title: "Book One"},
+			{Number: 1, StartMs: 630500, EndMs: 3723007, LengthMs: 3092507, Title: "Book Two; \"Of Strategy\""},
+		},
+	}
+}
+
+func (suite *ChapterExportTestSuite) TestExportMp4Chaps() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, ChapterFormatMp4Chaps, "book.m4b")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "00:00:00.000 Book One\n00:10:30.500 Book Two; \"Of Strategy\"\n", out.String())
+}
+
+func (suite *ChapterExportTestSuite) TestExportAudacity() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, ChapterFormatAudacity, "book.m4b")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "0.000000\t630.500000\tBook One\n630.500000\t3723.007000\tBook Two; \"Of Strategy\"\n", out.String())
+}
+
+func (suite *ChapterExportTestSuite) TestExportCue() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, ChapterFormatCue, "/books/On War.m4b")
+	assert.Nil(suite.T(), err)
+	expected := `PERFORMER "Carl von Clausewitz"
+TITLE "On War"
+FILE "On War.m4b" WAVE
+  TRACK 01 AUDIO
+    TITLE "Book One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Book Two; 'Of Strategy'"
+    INDEX 01 10:30:38
+`
+	assert.Equal(suite.T(), expected, out.String())
+
+	// the exported sheet parses back into the same chapter starts, within a frame
+	sheet, err := ParseCueSheet(&out)
+	assert.Nil(suite.T(), err)
+	start, ok := sheet.Files[0].Tracks[1].Start()
+	assert.True(suite.T(), ok)
+	assert.InDelta(suite.T(), 630500, start.Milliseconds(), 14)
+}
+
+func (suite *ChapterExportTestSuite) TestExportFFMetadata() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, ChapterFormatFFMetadata, "book.m4b")
+	assert.Nil(suite.T(), err)
+	expected := `;FFMETADATA1
+title=On War
+artist=Carl von Clausewitz
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=630500
+title=Book One
+[CHAPTER]
+TIMEBASE=1/1000
+START=630500
+END=3723007
+title=Book Two\; "Of Strategy"
+`
+	assert.Equal(suite.T(), expected, out.String())
+}
+
+func (suite *ChapterExportTestSuite) TestExportJson() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, ChapterFormatJson, "book.m4b")
+	assert.Nil(suite.T(), err)
+
+	exported := jsonChapters{}
+	assert.Nil(suite.T(), json.Unmarshal(out.Bytes(), &exported))
+	assert.Equal(suite.T(), "On War", exported.Title)
+	assert.Equal(suite.T(), 2, len(exported.Chapters))
+	assert.Equal(suite.T(), 2, exported.Chapters[1].Number)
+	assert.Equal(suite.T(), "00:10:30.500", exported.Chapters[1].Start)
+	assert.Equal(suite.T(), int64(630500), exported.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(3092507), exported.Chapters[1].LengthMs)
+}
+
+func (suite *ChapterExportTestSuite) TestExportUnsupportedFormat() {
+	var out bytes.Buffer
+	err := ExportChapters(&out, suite.book, "vtt", "book.m4b")
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 0, out.Len())
+}
+
+func (suite *ChapterExportTestSuite) TestParseProbeChapters() {
+	probed := []byte(`{
+    "chapters": [
+        {"id": 0, "time_base": "1/1000", "start": 0, "start_time": "0.000000", "end": 630500, "end_time": "630.500000", "tags": {"title": "Book One"}},
+        {"id": 1, "time_base": "1/1000", "start": 630500, "start_time": "630.500000", "end": 3723007, "end_time": "3723.007000"}
+    ]
+}`)
+	chapters, err := parseProbeChapters(probed)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(chapters))
+	assert.Equal(suite.T(), "Book One", chapters[0].Title)
+	assert.Equal(suite.T(), int64(630500), chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(3723007), chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(3092507), chapters[1].LengthMs)
+	// untitled chapters are titled with the chapter title template and language
+	assert.Equal(suite.T(), "", chapters[1].Title)
+	book := Book{Chapters: chapters}
+	book.titleUntitledChapters(Config{ChapterLanguage: "de"})
+	assert.Equal(suite.T(), "Book One", book.Chapters[0].Title)
+	assert.Equal(suite.T(), "Kapitel 2", book.Chapters[1].Title)
+}
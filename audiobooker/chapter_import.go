@@ -0,0 +1,417 @@
+package audiobooker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChapterFormatOgm OGM/Matroska simple chapter format, CHAPTER01=HH:MM:SS.mmm and CHAPTER01NAME=Title pairs
+const ChapterFormatOgm = "ogm"
+
+// ogmChapterRegex matches the lines of an OGM chapter list
+var ogmChapterRegex = regexp.MustCompile(`(?i)^CHAPTER(\d+)(NAME)?=(.*)$`)
+
+// ChapterByList creates Chapter objects from the chapter list file of the config, checked against the length of the source files
+func (b *Book) ChapterByList(ctx context.Context, config Config) error {
+	data, err := os.ReadFile(config.ChapterListFile)
+	if err != nil {
+		return err
+	}
+
+	chapters, format, err := ParseChapterList(string(data))
+	if err != nil {
+		return fmt.Errorf("error parsing chapters file %s: %v", config.ChapterListFile, err)
+	}
+	log.Debugf("parsed %d chapters from %s chapters file %s", len(chapters), format, config.ChapterListFile)
+
+	// the chapters cover the length of all the source files combined
+	totalMs := int64(0)
+	for _, sourceFile := range config.sourceFiles {
+		fileData, err := ffprobe.ProbeURL(ctx, sourceFile)
+		if err != nil {
+			return err
+		}
+		totalMs += fileData.Format.Duration().Milliseconds()
+	}
+
+	if err := finalizeChapterList(chapters, totalMs); err != nil {
+		return fmt.Errorf("chapters file %s doesn't match the source files: %v", config.ChapterListFile, err)
+	}
+	b.Chapters = chapters
+	b.titleUntitledChapters(config)
+
+	return nil
+}
+
+// ParseChapterList detects the format of a chapter list and parses it into Chapter objects with start times and titles, returning the detected format
+func ParseChapterList(data string) ([]*Chapter, string, error) {
+	// sanitize a possible byte order mark prior to parsing
+	data = strings.TrimPrefix(data, "\ufeff")
+
+	format, err := detectChapterFormat(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var chapters []*Chapter
+	switch format {
+	case ChapterFormatAudacity:
+		chapters, err = parseAudacityLabels(data)
+	case ChapterFormatCue:
+		chapters, err = parseCueChapterList(data)
+	case ChapterFormatFFMetadata:
+		chapters, err = parseFFMetadataChapters(data)
+	case ChapterFormatJson:
+		chapters, err = parseJsonChapters(data)
+	case ChapterFormatMp4Chaps:
+		chapters, err = parseMp4Chaps(data)
+	case ChapterFormatOgm:
+		chapters, err = parseOgmChapters(data)
+	}
+	if err != nil {
+		return nil, format, err
+	}
+	if len(chapters) == 0 {
+		return nil, format, errors.New("no chapters found")
+	}
+
+	return chapters, format, nil
+}
+
+// detectChapterFormat determines the format of a chapter list from its contents
+func detectChapterFormat(data string) (string, error) {
+	trimmed := strings.TrimSpace(data)
+	switch {
+	case trimmed == "":
+		return "", errors.New("no chapters found")
+	case strings.HasPrefix(trimmed, "{"):
+		return ChapterFormatJson, nil
+	case strings.HasPrefix(trimmed, ";FFMETADATA"):
+		return ChapterFormatFFMetadata, nil
+	}
+
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		command, _ := splitCueLine(line)
+		switch strings.ToUpper(command) {
+		case "FILE", "TRACK", "INDEX":
+			return ChapterFormatCue, nil
+		}
+	}
+
+	// the remaining formats are recognized by their first line
+	firstLine := strings.TrimSpace(strings.SplitN(trimmed, "\n", 2)[0])
+	if ogmChapterRegex.MatchString(firstLine) {
+		return ChapterFormatOgm, nil
+	}
+	if fields := strings.Split(firstLine, "\t"); len(fields) >= 2 {
+		if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			return ChapterFormatAudacity, nil
+		}
+	}
+	if _, err := parseTimestamp(strings.Fields(firstLine)[0]); err == nil {
+		return ChapterFormatMp4Chaps, nil
+	}
+
+	return "", errors.New("unable to detect the chapters format, must be one of: audacity, cue, ffmetadata, json, mp4chaps, ogm, or HH:MM:SS Title lines")
+}
+
+// finalizeChapterList validates the chapter starts against the total length of the audio and fills in the chapter numbers and ends
+func finalizeChapterList(chapters []*Chapter, totalMs int64) error {
+	for idx, chapter := range chapters {
+		if chapter.StartMs >= totalMs {
+			return fmt.Errorf("chapter %d %q starts at %s, after the end of the audio at %s", idx+1, chapter.Title, formatTimestamp(chapter.StartMs), formatTimestamp(totalMs))
+		}
+		if idx > 0 && chapter.StartMs <= chapters[idx-1].StartMs {
+			return fmt.Errorf("chapter %d %q starts at %s, which is not after the chapter before it", idx+1, chapter.Title, formatTimestamp(chapter.StartMs))
+		}
+	}
+
+	// the first chapter always starts at the beginning of the audio
+	if chapters[0].StartMs > 0 {
+		log.Warnf("first chapter starts at %s, moving it to the start of the book", formatTimestamp(chapters[0].StartMs))
+		chapters[0].StartMs = 0
+	}
+
+	// each chapter runs until the next one starts, the last runs until the end of the audio
+	for idx, chapter := range chapters {
+		chapter.Number = idx
+		if idx == len(chapters)-1 {
+			chapter.EndMs = totalMs
+		} else {
+			chapter.EndMs = chapters[idx+1].StartMs
+		}
+		chapter.LengthMs = chapter.EndMs - chapter.StartMs
+	}
+
+	return nil
+}
+
+// parseTimestamp parses a [HH:]MM:SS[.mmm] timestamp into milliseconds
+func parseTimestamp(timestamp string) (int64, error) {
+	invalid := fmt.Errorf("invalid timestamp %q, must be HH:MM:SS.mmm", timestamp)
+
+	clock, fraction, hasFraction := strings.Cut(timestamp, ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+
+	totalSeconds := int64(0)
+	for idx, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return 0, invalid
+		}
+		value, _ := strconv.ParseInt(part, 10, 64)
+		// minutes and seconds following a larger unit must be less than 60
+		if idx > 0 && value >= 60 {
+			return 0, invalid
+		}
+		totalSeconds = totalSeconds*60 + value
+	}
+
+	ms := totalSeconds * 1000
+	if hasFraction {
+		if fraction == "" || strings.Trim(fraction, "0123456789") != "" {
+			return 0, invalid
+		}
+		// only millisecond precision is kept
+		fraction = (fraction + "00")[:3]
+		fractionMs, _ := strconv.ParseInt(fraction, 10, 64)
+		ms += fractionMs
+	}
+
+	return ms, nil
+}
+
+// parseAudacityLabels parses an Audacity label track, tab separated start and end seconds followed by the label
+func parseAudacityLabels(data string) ([]*Chapter, error) {
+	chapters := make([]*Chapter, 0)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// spectral selection lines start with a backslash and don't hold a label
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, `\`) {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: label must have tab separated start and end times", lineNum)
+		}
+		start, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start time %q", lineNum, fields[0])
+		}
+		title := ""
+		if len(fields) == 3 {
+			title = strings.TrimSpace(fields[2])
+		}
+		chapters = append(chapters, &Chapter{StartMs: secondsToMs(start), Title: title})
+	}
+
+	return chapters, scanner.Err()
+}
+
+// parseCueChapterList parses a CUE sheet describing a single file
+func parseCueChapterList(data string) ([]*Chapter, error) {
+	sheet, err := ParseCueSheet(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(sheet.Files) > 1 {
+		return nil, errors.New("CUE sheets with more than one FILE entry can't be used as a chapters file, use the cue sub-command instead")
+	}
+
+	chapters := make([]*Chapter, 0)
+	for _, file := range sheet.Files {
+		for _, track := range file.Tracks {
+			start, ok := track.Start()
+			if !ok {
+				log.Warnf("track %d has no INDEX entry, skipping", track.Number)
+				continue
+			}
+			chapters = append(chapters, &Chapter{StartMs: start.Milliseconds(), Title: track.Title})
+		}
+	}
+
+	return chapters, nil
+}
+
+// parseFFMetadataChapters parses the [CHAPTER] sections of an ffmetadata file
+func parseFFMetadataChapters(data string) ([]*Chapter, error) {
+	chapters := make([]*Chapter, 0)
+	var chapter *Chapter
+	// ffmpeg assumes nanoseconds when a chapter has no TIMEBASE
+	timeBaseNum, timeBaseDen := int64(1), int64(time.Second)
+	chapterStart := int64(0)
+
+	// stamp the start of the current chapter once its time base is known
+	closeChapter := func() {
+		if chapter != nil {
+			chapter.StartMs = chapterStart * timeBaseNum * 1000 / timeBaseDen
+			chapters = append(chapters, chapter)
+		}
+	}
+
+	lineNum := 0
+	for _, line := range strings.Split(data, "\n") {
+		lineNum++
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			closeChapter()
+			chapter = nil
+			if line == "[CHAPTER]" {
+				chapter = new(Chapter)
+				timeBaseNum, timeBaseDen = 1, int64(time.Second)
+				chapterStart = 0
+			}
+			continue
+		}
+		if chapter == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "TIMEBASE":
+			num, den, ok := strings.Cut(value, "/")
+			if ok {
+				timeBaseNum, err = strconv.ParseInt(num, 10, 64)
+				if err == nil {
+					timeBaseDen, err = strconv.ParseInt(den, 10, 64)
+				}
+			}
+			if !ok || err != nil || timeBaseNum <= 0 || timeBaseDen <= 0 {
+				return nil, fmt.Errorf("line %d: invalid TIMEBASE %q", lineNum, value)
+			}
+		case "START":
+			chapterStart, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid START %q", lineNum, value)
+			}
+		case "TITLE":
+			chapter.Title = unescapeFFMetadata(value)
+		}
+	}
+	closeChapter()
+
+	return chapters, nil
+}
+
+// unescapeFFMetadata removes the escaping of the special characters of an ffmetadata value
+func unescapeFFMetadata(value string) string {
+	var out strings.Builder
+	escaped := false
+	for _, r := range value {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// parseJsonChapters parses chapters in the JSON format written by ExportChapters
+func parseJsonChapters(data string) ([]*Chapter, error) {
+	parsed := jsonChapters{}
+	if err := json.Unmarshal([]byte(data), &parsed); err != nil {
+		return nil, err
+	}
+
+	chapters := make([]*Chapter, len(parsed.Chapters))
+	for idx, parsedChapter := range parsed.Chapters {
+		chapters[idx] = &Chapter{StartMs: parsedChapter.StartMs, Title: parsedChapter.Title}
+	}
+
+	return chapters, nil
+}
+
+// parseMp4Chaps parses Nero/mp4chaps style chapter lists, one "HH:MM:SS.mmm Title" line per chapter
+func parseMp4Chaps(data string) ([]*Chapter, error) {
+	chapters := make([]*Chapter, 0)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the title is separated from the timestamp by a space or a tab
+		timestamp, title := line, ""
+		if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+			timestamp, title = line[:idx], line[idx+1:]
+		}
+		start, err := parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		chapters = append(chapters, &Chapter{StartMs: start, Title: strings.TrimSpace(title)})
+	}
+
+	return chapters, scanner.Err()
+}
+
+// parseOgmChapters parses OGM/Matroska simple chapter lists of CHAPTERxx and CHAPTERxxNAME pairs
+func parseOgmChapters(data string) ([]*Chapter, error) {
+	chapters := make([]*Chapter, 0)
+	byNumber := make(map[string]*Chapter)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		matches := ogmChapterRegex.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("line %d: expected a CHAPTERxx= or CHAPTERxxNAME= entry", lineNum)
+		}
+
+		number, isName, value := matches[1], matches[2] != "", strings.TrimSpace(matches[3])
+		chapter, ok := byNumber[number]
+		if !ok {
+			chapter = new(Chapter)
+			byNumber[number] = chapter
+			chapters = append(chapters, chapter)
+		}
+		if isName {
+			chapter.Title = value
+			continue
+		}
+		start, err := parseTimestamp(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		chapter.StartMs = start
+	}
+
+	return chapters, scanner.Err()
+}
@@ -0,0 +1,113 @@
+package audiobooker
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChapterImportTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ChapterImportTestSuite) TestParseChapterList() {
+	testCases := []struct {
+		name   string
+		data   string
+		format string
+	}{
+		{"audacity", "0.000000\t0.000000\tBook One\n\\\t200.000000\t2000.000000\n630.500000\t630.500000\tBook Two\n", ChapterFormatAudacity},
+		{"cue", "TITLE \"On War\"\nFILE \"book.m4b\" WAVE\n  TRACK 01 AUDIO\n    TITLE \"Book One\"\n    INDEX 01 00:00:00\n  TRACK 02 AUDIO\n    TITLE \"Book Two\"\n    INDEX 01 10:30:37\n", ChapterFormatCue},
+		{"ffmetadata", ";FFMETADATA1\ntitle=On War\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=630500\ntitle=Book One\n[CHAPTER]\nTIMEBASE=1/1000000\nSTART=630500000\nEND=900000000\ntitle=Book Two\n", ChapterFormatFFMetadata},
+		{"json", `{"title": "On War", "chapters": [{"title": "Book One", "start_ms": 0}, {"title": "Book Two", "start_ms": 630500}]}`, ChapterFormatJson},
+		{"mp4chaps", "00:00:00.000 Book One\n00:10:30.500 Book Two\n", ChapterFormatMp4Chaps},
+		{"simple", "\ufeff0:00:00 Book One\r\n0:10:30.5\tBook Two\r\n", ChapterFormatMp4Chaps},
+		{"ogm", "CHAPTER01=00:00:00.000\nCHAPTER01NAME=Book One\nCHAPTER02=00:10:30.500\nCHAPTER02NAME=Book Two\n", ChapterFormatOgm},
+	}
+
+	for _, testCase := range testCases {
+		chapters, format, err := ParseChapterList(testCase.data)
+		assert.Nil(suite.T(), err, testCase.name)
+		assert.Equal(suite.T(), testCase.format, format, testCase.name)
+		if assert.Equal(suite.T(), 2, len(chapters), testCase.name) {
+			assert.Equal(suite.T(), "Book One", chapters[0].Title, testCase.name)
+			assert.Equal(suite.T(), int64(0), chapters[0].StartMs, testCase.name)
+			assert.Equal(suite.T(), "Book Two", chapters[1].Title, testCase.name)
+			// CUE frames are only accurate to 1/75th of a second
+			assert.InDelta(suite.T(), 630500, chapters[1].StartMs, 14, testCase.name)
+		}
+	}
+
+	// unknown and empty lists
+	_, _, err := ParseChapterList("Book One starts at the beginning\n")
+	assert.NotNil(suite.T(), err)
+	_, _, err = ParseChapterList("\n")
+	assert.NotNil(suite.T(), err)
+
+	// CUE sheets covering multiple files are left to the cue sub-command
+	_, _, err = ParseChapterList(testCueSheet)
+	assert.NotNil(suite.T(), err)
+
+	// exported chapters can be imported again
+	book := Book{Chapters: []*Chapter{
+		{StartMs: 0, EndMs: 630500, Title: "Book One"},
+		{StartMs: 630500, EndMs: 900000, Title: "Book Two = War; Strategy"},
+	}}
+	for _, format := range []string{ChapterFormatAudacity, ChapterFormatFFMetadata, ChapterFormatJson, ChapterFormatMp4Chaps} {
+		var out bytes.Buffer
+		assert.Nil(suite.T(), ExportChapters(&out, book, format, "book.m4b"))
+		chapters, detected, err := ParseChapterList(out.String())
+		assert.Nil(suite.T(), err, format)
+		assert.Equal(suite.T(), format, detected)
+		if assert.Equal(suite.T(), 2, len(chapters), format) {
+			assert.Equal(suite.T(), book.Chapters[1].Title, chapters[1].Title, format)
+			assert.Equal(suite.T(), book.Chapters[1].StartMs, chapters[1].StartMs, format)
+		}
+	}
+}
+
+func (suite *ChapterImportTestSuite) TestParseTimestamp() {
+	testCases := map[string]int64{
+		"00:00:00.000":  0,
+		"01:02:03.004":  3723004,
+		"1:02:03":       3723000,
+		"02:03.5":       123500,
+		"00:00:01.2345": 1234,
+		"100:00:00":     360000000,
+	}
+	for timestamp, expected := range testCases {
+		ms, err := parseTimestamp(timestamp)
+		assert.Nil(suite.T(), err, timestamp)
+		assert.Equal(suite.T(), expected, ms, timestamp)
+	}
+
+	for _, timestamp := range []string{"", "12", "00:60:00", "00:00:60", "00:00:00.", "-1:00:00", "00:00:0a", "1:2:3:4"} {
+		_, err := parseTimestamp(timestamp)
+		assert.NotNil(suite.T(), err, timestamp)
+	}
+}
+
+func (suite *ChapterImportTestSuite) TestFinalizeChapterList() {
+	chapters := []*Chapter{
+		{StartMs: 1500, Title: "Book One"},
+		{StartMs: 630500},
+	}
+	assert.Nil(suite.T(), finalizeChapterList(chapters, 900000))
+	// the first chapter is moved to the start of the audio
+	assert.Equal(suite.T(), int64(0), chapters[0].StartMs)
+	assert.Equal(suite.T(), int64(630500), chapters[0].EndMs)
+	assert.Equal(suite.T(), int64(630500), chapters[0].LengthMs)
+	// the last chapter runs to the end of the audio
+	assert.Equal(suite.T(), 1, chapters[1].Number)
+	assert.Equal(suite.T(), "", chapters[1].Title)
+	assert.Equal(suite.T(), int64(900000), chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(269500), chapters[1].LengthMs)
+
+	// chapters past the end of the audio
+	err := finalizeChapterList([]*Chapter{{StartMs: 0}, {StartMs: 900000}}, 900000)
+	assert.NotNil(suite.T(), err)
+
+	// chapters out of order
+	err = finalizeChapterList([]*Chapter{{StartMs: 0}, {StartMs: 5000}, {StartMs: 5000}}, 900000)
+	assert.NotNil(suite.T(), err)
+}
@@ -0,0 +1,277 @@
+package audiobooker
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// chapter post-processing steps
+const (
+	ChapterStepMergeDuplicates = "merge-duplicates"
+	ChapterStepMergeShort      = "merge-short"
+	ChapterStepSplitLong       = "split-long"
+)
+
+const (
+	// splitSilenceNoiseDb noise floor, in dB, used when looking for silences to split long chapters at
+	splitSilenceNoiseDb = -30
+	// splitSilenceDuration minimum duration, in seconds, of silences to split long chapters at
+	splitSilenceDuration = 1.0
+)
+
+// nonAlphanumericRegex matches runs of anything other than letters and numbers
+var nonAlphanumericRegex = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// ChapterChange describes a change made to the chapters by post-processing
+type ChapterChange struct {
+	// Step post-processing step that made the change
+	Step string
+	// Title of the chapter after the change
+	Title string
+	// Description of the change
+	Description string
+}
+
+// FinalizeChapters applies any chapter titles to the generated chapters, then post-processes them, it only runs once per book
+func (b *Book) FinalizeChapters(ctx context.Context, config Config) ([]ChapterChange, error) {
+	if b.chaptersFinalized {
+		return nil, nil
+	}
+	b.chaptersFinalized = true
+
+	// title the chapters from the EPUB table of contents, CUE sheets, chapter lists, and embedded chapters carry their own titles
+	if len(b.tocTitles) > 0 && len(b.Chapters) > 0 && !b.chaptersTitled && config.ChapterListFile == "" && !config.ExternalChapters {
+		b.ApplyChapterTitles(b.tocTitles)
+	}
+
+	// check for and apply chapter titles file
+	if config.chapterTitlesFile != nil {
+		titles, err := ReadChapterTitles(*config.chapterTitlesFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(b.Chapters) == 0 {
+			log.Warnln("no generated chapters to apply the chapter titles to, skipping")
+		} else {
+			b.ApplyChapterTitles(titles)
+		}
+	}
+
+	return b.ProcessChapters(ctx, config)
+}
+
+// ProcessChapters merges duplicate and short chapters, then splits long chapters, as configured, returning the changes made
+func (b *Book) ProcessChapters(ctx context.Context, config Config) ([]ChapterChange, error) {
+	changes := make([]ChapterChange, 0)
+	if len(b.Chapters) == 0 {
+		return changes, nil
+	}
+
+	if config.MergeDuplicateTitles {
+		changes = append(changes, b.mergeDuplicateChapters()...)
+	}
+	if config.MinChapterLength > 0 {
+		changes = append(changes, b.mergeShortChapters(config.MinChapterLength.Milliseconds())...)
+	}
+	if config.MaxChapterLength > 0 {
+		var silences []MarkerPoint
+		if config.SplitAtSilence && b.hasChaptersLongerThan(config.MaxChapterLength.Milliseconds()) {
+			var err error
+			silences, err = detectBookSilences(ctx, config.sourceFiles)
+			if err != nil {
+				return changes, err
+			}
+		}
+		changes = append(changes, b.splitLongChapters(config.MaxChapterLength.Milliseconds(), silences)...)
+	}
+
+	for idx, chapter := range b.Chapters {
+		chapter.Number = idx
+	}
+
+	return changes, nil
+}
+
+// normalizeChapterTitle reduces a chapter title to lower case letters and numbers for comparison
+func normalizeChapterTitle(title string) string {
+	return strings.TrimSpace(nonAlphanumericRegex.ReplaceAllString(strings.ToLower(title), " "))
+}
+
+// mergeChapters merges the next chapter into the chapter, keeping the title of the chapter
+func mergeChapters(chapter, next *Chapter) {
+	chapter.EndMs = next.EndMs
+	chapter.LengthMs = chapter.EndMs - chapter.StartMs
+	chapter.Tracks = append(chapter.Tracks, next.Tracks...)
+}
+
+// mergeDuplicateChapters merges adjacent chapters with the same normalized title
+func (b *Book) mergeDuplicateChapters() []ChapterChange {
+	changes := make([]ChapterChange, 0)
+	merged := []*Chapter{b.Chapters[0]}
+	for _, chapter := range b.Chapters[1:] {
+		previous := merged[len(merged)-1]
+		if normalizeChapterTitle(chapter.Title) != "" && normalizeChapterTitle(chapter.Title) == normalizeChapterTitle(previous.Title) {
+			changes = append(changes, ChapterChange{
+				Step:        ChapterStepMergeDuplicates,
+				Title:       previous.Title,
+				Description: fmt.Sprintf("merged %q at %s into the chapter before it", chapter.Title, formatTimestamp(chapter.StartMs)),
+			})
+			mergeChapters(previous, chapter)
+			continue
+		}
+		merged = append(merged, chapter)
+	}
+	b.Chapters = merged
+
+	return changes
+}
+
+// mergeShortChapters merges chapters shorter than minLengthMs into the chapter after them, or before them for the last chapter
+func (b *Book) mergeShortChapters(minLengthMs int64) []ChapterChange {
+	changes := make([]ChapterChange, 0)
+	for len(b.Chapters) > 1 {
+		idx := -1
+		for chapterIdx, chapter := range b.Chapters {
+			if chapter.LengthMs < minLengthMs {
+				idx = chapterIdx
+				break
+			}
+		}
+		if idx < 0 {
+			break
+		}
+
+		short := b.Chapters[idx]
+		if idx == len(b.Chapters)-1 {
+			// the last chapter is merged into the chapter before it
+			previous := b.Chapters[idx-1]
+			changes = append(changes, ChapterChange{
+				Step:        ChapterStepMergeShort,
+				Title:       previous.Title,
+				Description: fmt.Sprintf("merged %q (%s long) into the chapter before it", short.Title, time.Duration(short.LengthMs)*time.Millisecond),
+			})
+			mergeChapters(previous, short)
+			b.Chapters = b.Chapters[:idx]
+			continue
+		}
+
+		// the chapter after it takes over the start of the short chapter, keeping its own title
+		next := b.Chapters[idx+1]
+		changes = append(changes, ChapterChange{
+			Step:        ChapterStepMergeShort,
+			Title:       next.Title,
+			Description: fmt.Sprintf("merged %q (%s long) into the chapter after it", short.Title, time.Duration(short.LengthMs)*time.Millisecond),
+		})
+		next.StartMs = short.StartMs
+		next.LengthMs = next.EndMs - next.StartMs
+		next.Tracks = append(append([]TrackFile{}, short.Tracks...), next.Tracks...)
+		b.Chapters = append(b.Chapters[:idx], b.Chapters[idx+1:]...)
+	}
+
+	return changes
+}
+
+// hasChaptersLongerThan checks if any of the chapters are longer than maxLengthMs
+func (b *Book) hasChaptersLongerThan(maxLengthMs int64) bool {
+	for _, chapter := range b.Chapters {
+		if chapter.LengthMs > maxLengthMs {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLongChapters splits chapters longer than maxLengthMs into even parts, moving each split to the strongest nearby silence when silences are given
+func (b *Book) splitLongChapters(maxLengthMs int64, silences []MarkerPoint) []ChapterChange {
+	changes := make([]ChapterChange, 0)
+	split := make([]*Chapter, 0, len(b.Chapters))
+	for _, chapter := range b.Chapters {
+		if chapter.LengthMs <= maxLengthMs {
+			split = append(split, chapter)
+			continue
+		}
+
+		parts := int((chapter.LengthMs + maxLengthMs - 1) / maxLengthMs)
+		spacingMs := chapter.LengthMs / int64(parts)
+		marks := make([]int64, 0, parts-1)
+		for part := 1; part < parts; part++ {
+			markMs := chapter.StartMs + spacingMs*int64(part)
+			// look for a silence within a quarter of the spacing of the even split
+			if silenceMs, ok := strongestSilenceNear(silences, markMs, spacingMs/4); ok {
+				markMs = silenceMs
+			}
+			marks = append(marks, markMs)
+		}
+
+		startMs := chapter.StartMs
+		for part := 1; part <= parts; part++ {
+			endMs := chapter.EndMs
+			if part < parts {
+				endMs = marks[part-1]
+			}
+			split = append(split, &Chapter{
+				StartMs:  startMs,
+				EndMs:    endMs,
+				LengthMs: endMs - startMs,
+				Title:    fmt.Sprintf("%s (%d/%d)", chapter.Title, part, parts),
+			})
+			startMs = endMs
+		}
+
+		description := fmt.Sprintf("split %s into %d parts", time.Duration(chapter.LengthMs)*time.Millisecond, parts)
+		if len(silences) > 0 {
+			description += " at the strongest nearby silences"
+		}
+		changes = append(changes, ChapterChange{Step: ChapterStepSplitLong, Title: chapter.Title, Description: description})
+	}
+	b.Chapters = split
+
+	return changes
+}
+
+// strongestSilenceNear returns the middle of the strongest silence within windowMs of targetMs
+func strongestSilenceNear(silences []MarkerPoint, targetMs, windowMs int64) (int64, bool) {
+	found := false
+	best := MarkerPoint{}
+	for _, silence := range silences {
+		silenceMs := int64(silence.ParseEnd() * 1000)
+		if silenceMs < targetMs-windowMs || silenceMs > targetMs+windowMs {
+			continue
+		}
+		if !found || silence.score() > best.score() {
+			best = silence
+			found = true
+		}
+	}
+
+	return int64(best.ParseEnd() * 1000), found
+}
+
+// detectBookSilences detects the silences across the source files, offset by the length of the files before them
+func detectBookSilences(ctx context.Context, sourceFiles []string) ([]MarkerPoint, error) {
+	log.Infoln("Running silence detection to split long chapters, this may take a while depending on the length of the source files.")
+	silences := make([]MarkerPoint, 0)
+	offset := 0.0
+	for _, sourceFile := range sourceFiles {
+		fileData, err := ffprobe.ProbeURL(ctx, sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		points, err := GenerateVolMarkers(ctx, sourceFile, splitSilenceDuration, splitSilenceNoiseDb)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			point.End += offset
+			silences = append(silences, point)
+		}
+		offset += fileData.Format.Duration().Seconds()
+	}
+
+	return silences, nil
+}
@@ -0,0 +1,147 @@
+package audiobooker
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type ChapterProcessingTestSuite struct {
+	suite.Suite
+}
+
+// testProcessingBook creates a book with back to back chapters of the given titles and lengths in seconds
+func testProcessingBook(titles []string, lengths []int64) *Book {
+	b := &Book{}
+	startMs := int64(0)
+	for idx, title := range titles {
+		endMs := startMs + lengths[idx]*1000
+		b.Chapters = append(b.Chapters, &Chapter{Number: idx, Title: title, StartMs: startMs, EndMs: endMs, LengthMs: endMs - startMs})
+		startMs = endMs
+	}
+	return b
+}
+
+// chapterTitles returns the titles of the chapters of a book
+func chapterTitles(b *Book) []string {
+	titles := make([]string, 0, len(b.Chapters))
+	for _, chapter := range b.Chapters {
+		titles = append(titles, chapter.Title)
+	}
+	return titles
+}
+
+func (suite *ChapterProcessingTestSuite) TestNormalizeChapterTitle() {
+	assert.Equal(suite.T(), "chapter 1", normalizeChapterTitle("Chapter 1"))
+	assert.Equal(suite.T(), "chapter 1", normalizeChapterTitle("  CHAPTER 1. "))
+	assert.Equal(suite.T(), "chapter 1 part 2", normalizeChapterTitle("Chapter 1 — Part 2"))
+	assert.Equal(suite.T(), "", normalizeChapterTitle("---"))
+}
+
+func (suite *ChapterProcessingTestSuite) TestMergeDuplicateChapters() {
+	b := testProcessingBook([]string{"Prologue", "Chapter 1", "chapter 1.", "Chapter 2", "", ""}, []int64{10, 20, 30, 40, 5, 5})
+	changes, err := b.ProcessChapters(context.Background(), Config{MergeDuplicateTitles: true})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(changes))
+	assert.Equal(suite.T(), ChapterStepMergeDuplicates, changes[0].Step)
+	assert.Equal(suite.T(), "Chapter 1", changes[0].Title)
+
+	// untitled chapters are never merged as duplicates
+	assert.Equal(suite.T(), []string{"Prologue", "Chapter 1", "Chapter 2", "", ""}, chapterTitles(b))
+	assert.Equal(suite.T(), int64(10000), b.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(60000), b.Chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(50000), b.Chapters[1].LengthMs)
+	for idx, chapter := range b.Chapters {
+		assert.Equal(suite.T(), idx, chapter.Number)
+	}
+}
+
+func (suite *ChapterProcessingTestSuite) TestMergeShortChapters() {
+	// first, middle, and last chapters are short
+	b := testProcessingBook([]string{"Opening Credits", "Chapter 1", "Interlude", "Chapter 2", "End Credits"}, []int64{5, 600, 10, 600, 8})
+	changes, err := b.ProcessChapters(context.Background(), Config{MinChapterLength: 30 * time.Second})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(changes))
+	assert.Equal(suite.T(), []string{"Chapter 1", "Chapter 2"}, chapterTitles(b))
+
+	// short chapters are merged into the chapter after them, the last one into the chapter before it
+	assert.Equal(suite.T(), int64(0), b.Chapters[0].StartMs)
+	assert.Equal(suite.T(), int64(605000), b.Chapters[0].EndMs)
+	assert.Equal(suite.T(), int64(605000), b.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(1223000), b.Chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(618000), b.Chapters[1].LengthMs)
+	assert.Equal(suite.T(), 1, b.Chapters[1].Number)
+
+	// a single chapter is left alone however short it is
+	b2 := testProcessingBook([]string{"Only"}, []int64{5})
+	changes, err = b2.ProcessChapters(context.Background(), Config{MinChapterLength: 30 * time.Second})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(changes))
+	assert.Equal(suite.T(), 1, len(b2.Chapters))
+}
+
+func (suite *ChapterProcessingTestSuite) TestSplitLongChapters() {
+	// split into even parts
+	b := testProcessingBook([]string{"Chapter 1", "Chapter 2"}, []int64{600, 2500})
+	changes, err := b.ProcessChapters(context.Background(), Config{MaxChapterLength: 1000 * time.Second})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(changes))
+	assert.Equal(suite.T(), ChapterStepSplitLong, changes[0].Step)
+	assert.Equal(suite.T(), []string{"Chapter 1", "Chapter 2 (1/3)", "Chapter 2 (2/3)", "Chapter 2 (3/3)"}, chapterTitles(b))
+	assert.Equal(suite.T(), int64(600000), b.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(1433333), b.Chapters[2].StartMs)
+	assert.Equal(suite.T(), int64(2266666), b.Chapters[3].StartMs)
+	assert.Equal(suite.T(), int64(3100000), b.Chapters[3].EndMs)
+	assert.Equal(suite.T(), 3, b.Chapters[3].Number)
+
+	// split at the strongest silence near each even split, ignoring those too far away
+	b2 := testProcessingBook([]string{"Chapter 1"}, []int64{2000})
+	silences := []MarkerPoint{
+		{Depth: 0, Duration: 1, End: 950.5},
+		{Depth: 20, Duration: 2, End: 1101},
+		{Depth: 30, Duration: 4, End: 1402},
+	}
+	changes = b2.splitLongChapters(1500000, silences)
+	assert.Equal(suite.T(), 1, len(changes))
+	assert.Equal(suite.T(), 2, len(b2.Chapters))
+	assert.Equal(suite.T(), int64(1100000), b2.Chapters[0].EndMs)
+	assert.Equal(suite.T(), int64(1100000), b2.Chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(900000), b2.Chapters[1].LengthMs)
+}
+
+func (suite *ChapterProcessingTestSuite) TestFinalizeChapters() {
+	b := testProcessingBook([]string{"Intro", "Chapter 1", "Chapter 1"}, []int64{5, 600, 600})
+	b.tocTitles = []string{"The Beginning"}
+	config := Config{MergeDuplicateTitles: true, MinChapterLength: 30 * time.Second}
+
+	changes, err := b.FinalizeChapters(context.Background(), config)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(changes))
+	// the table of contents titles are applied before post-processing, so the short titled intro is merged away
+	assert.Equal(suite.T(), []string{"Chapter 1"}, chapterTitles(b))
+	assert.Equal(suite.T(), int64(1205000), b.Chapters[0].LengthMs)
+
+	// only runs once
+	changes, err = b.FinalizeChapters(context.Background(), config)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(changes))
+	assert.Equal(suite.T(), 1, len(b.Chapters))
+}
+
+func (suite *ChapterProcessingTestSuite) TestFinalizeChaptersWithTitlesFile() {
+	titlesFile := filepath.Join(suite.T().TempDir(), "chapters.txt")
+	err := os.WriteFile(titlesFile, []byte("Prologue\nOpening Credits\nThe Storm\nThe Harbor\n"), 0644)
+	assert.Nil(suite.T(), err)
+
+	// each title lands on the chapter it was listed for, before the short credits are merged into the chapter after them
+	b := testProcessingBook([]string{"Chapter 1", "Chapter 2", "Chapter 3", "Chapter 4"}, []int64{600, 10, 600, 600})
+	config := Config{MinChapterLength: 30 * time.Second, chapterTitlesFile: &titlesFile}
+	changes, err := b.FinalizeChapters(context.Background(), config)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(changes))
+	assert.Equal(suite.T(), []string{"Prologue", "The Storm", "The Harbor"}, chapterTitles(b))
+	assert.Equal(suite.T(), int64(610000), b.Chapters[1].LengthMs)
+}
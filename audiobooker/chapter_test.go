@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/vansante/go-ffprobe.v2"
@@ -42,7 +43,7 @@ func (suite *ChapterSuite) TestParseFromCueTag() {
 	}
 
 	// parse cue sheet from tag
-	cues1, err := parseFromCueTag(c1)
+	cues1, err := parseFromCueTag(context.Background(), c1)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 50, len(cues1))
 
@@ -73,7 +74,29 @@ func (suite *ChapterSuite) TestParseFromCueTag() {
 	c2 := Config{
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/tagged.mp3")},
 	}
-	_, err = parseFromCueTag(c2)
+	_, err = parseFromCueTag(context.Background(), c2)
 	// should return a tag not found error
 	assert.Equal(suite.T(), ffprobe.ErrTagNotFound, err)
 }
+
+func (suite *ChapterSuite) TestParseCueTimeCode() {
+	// whole seconds
+	d1, err := parseCueTimeCode("01:02:00")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(62000), d1.Milliseconds())
+
+	// frames are 1/75th of a second
+	d2, err := parseCueTimeCode("00:10:37")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(10493), d2.Milliseconds())
+	d3, err := parseCueTimeCode("100:59:74")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), int64(6059986), d3.Milliseconds())
+
+	// out of range and malformed time codes
+	invalid := []string{"00:60:00", "00:00:75", "00:00", "aa:00:00", "-1:00:00", "00:+1:00", "00::00"}
+	for _, timeCode := range invalid {
+		_, err := parseCueTimeCode(timeCode)
+		assert.Error(suite.T(), err, timeCode)
+	}
+}
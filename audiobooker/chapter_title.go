@@ -0,0 +1,282 @@
+package audiobooker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultChapterTitleTemplate chapter title template used when none is configured
+const DefaultChapterTitleTemplate = "{chapter} {n}"
+
+// DefaultChapterLanguage language used for chapter titles when none is configured
+const DefaultChapterLanguage = "en"
+
+// chapterTitlePlaceholderRegex matches the {name} and {name:width} placeholders of a chapter title template
+var chapterTitlePlaceholderRegex = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+
+// chapterWords localised word for "chapter" in each supported language
+var chapterWords = map[string]string{
+	"de": "Kapitel",
+	"en": "Chapter",
+	"es": "Capítulo",
+	"fr": "Chapitre",
+}
+
+// ChapterLanguages list of the supported chapter title languages
+var ChapterLanguages = []string{"de", "en", "es", "fr"}
+
+// CheckChapterLanguage returns an error if the chapter title language is not supported
+func CheckChapterLanguage(language string) error {
+	if _, ok := chapterWords[normalizeLanguage(language)]; !ok {
+		return fmt.Errorf("unsupported chapter language %q, must be one of: %s", language, strings.Join(ChapterLanguages, ", "))
+	}
+	return nil
+}
+
+// ChapterTitle renders the chapter title template of the config for a chapter, number starts at 1, file and tag are the source filename and title tag if known
+func (c *Config) ChapterTitle(number int, file, tag string) string {
+	template := c.ChapterTitleTemplate
+	if template == "" {
+		template = DefaultChapterTitleTemplate
+	}
+	language := normalizeLanguage(c.ChapterLanguage)
+	if _, ok := chapterWords[language]; !ok {
+		language = DefaultChapterLanguage
+	}
+
+	return FormatChapterTitle(template, language, number, file, tag)
+}
+
+// FormatChapterTitle renders a chapter title template, supporting the {chapter}, {n}, {n:width}, {words}, {roman}, {file}, and {tag} placeholders
+func FormatChapterTitle(template, language string, number int, file, tag string) string {
+	title := chapterTitlePlaceholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		matches := chapterTitlePlaceholderRegex.FindStringSubmatch(placeholder)
+		switch matches[1] {
+		case "chapter":
+			return chapterWords[language]
+		case "n":
+			width, _ := strconv.Atoi(matches[2])
+			return fmt.Sprintf("%0*d", width, number)
+		case "words":
+			return capitalize(spellNumber(number, language))
+		case "roman":
+			return romanNumeral(number)
+		case "file":
+			return file
+		case "tag":
+			return tag
+		}
+		// leave unknown placeholders as they are
+		return placeholder
+	})
+
+	return strings.TrimSpace(title)
+}
+
+// titleUntitledChapters titles any chapters without a title using the chapter title template of the config
+func (b *Book) titleUntitledChapters(config Config) {
+	for idx, chapter := range b.Chapters {
+		if chapter.Title == "" {
+			chapter.Title = config.ChapterTitle(idx+1, "", "")
+		}
+	}
+}
+
+// normalizeLanguage reduces a language tag like "de-DE" to its lower case primary language
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if idx := strings.IndexAny(language, "-_"); idx >= 0 {
+		language = language[:idx]
+	}
+	if language == "" {
+		return DefaultChapterLanguage
+	}
+	return language
+}
+
+// capitalize upper cases the first letter of a string
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// romanNumeral converts a number to upper case Roman numerals, numbers outside 1-3999 are left as digits
+func romanNumeral(number int) string {
+	if number < 1 || number > 3999 {
+		return strconv.Itoa(number)
+	}
+
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var roman strings.Builder
+	for idx, value := range values {
+		for number >= value {
+			roman.WriteString(symbols[idx])
+			number -= value
+		}
+	}
+
+	return roman.String()
+}
+
+// spellNumber spells out a number in the given language, numbers outside 0-999 are left as digits
+func spellNumber(number int, language string) string {
+	if number < 0 || number > 999 {
+		return strconv.Itoa(number)
+	}
+
+	switch language {
+	case "de":
+		return spellNumberDe(number)
+	case "es":
+		return spellNumberEs(number)
+	case "fr":
+		return spellNumberFr(number)
+	default:
+		return spellNumberEn(number)
+	}
+}
+
+// spellNumberEn spells out a number from 0-999 in English
+func spellNumberEn(number int) string {
+	ones := []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+		"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	tens := []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+
+	words := make([]string, 0)
+	if number >= 100 {
+		words = append(words, ones[number/100], "hundred")
+		number %= 100
+		if number == 0 {
+			return strings.Join(words, " ")
+		}
+	}
+	switch {
+	case number < 20:
+		words = append(words, ones[number])
+	case number%10 == 0:
+		words = append(words, tens[number/10])
+	default:
+		words = append(words, tens[number/10]+"-"+ones[number%10])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// spellNumberDe spells out a number from 0-999 in German
+func spellNumberDe(number int) string {
+	ones := []string{"null", "eins", "zwei", "drei", "vier", "fünf", "sechs", "sieben", "acht", "neun", "zehn",
+		"elf", "zwölf", "dreizehn", "vierzehn", "fünfzehn", "sechzehn", "siebzehn", "achtzehn", "neunzehn"}
+	tens := []string{"", "", "zwanzig", "dreißig", "vierzig", "fünfzig", "sechzig", "siebzig", "achtzig", "neunzig"}
+
+	// "eins" becomes "ein" when it's part of a compound number
+	compound := func(n int) string {
+		if n == 1 {
+			return "ein"
+		}
+		return ones[n]
+	}
+
+	words := ""
+	if number >= 100 {
+		words = compound(number/100) + "hundert"
+		number %= 100
+		if number == 0 {
+			return words
+		}
+	}
+	switch {
+	case number < 20:
+		words += ones[number]
+	case number%10 == 0:
+		words += tens[number/10]
+	default:
+		words += compound(number%10) + "und" + tens[number/10]
+	}
+
+	return words
+}
+
+// spellNumberEs spells out a number from 0-999 in Spanish
+func spellNumberEs(number int) string {
+	ones := []string{"cero", "uno", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve", "diez",
+		"once", "doce", "trece", "catorce", "quince", "dieciséis", "diecisiete", "dieciocho", "diecinueve",
+		"veinte", "veintiuno", "veintidós", "veintitrés", "veinticuatro", "veinticinco", "veintiséis", "veintisiete", "veintiocho", "veintinueve"}
+	tens := []string{"", "", "", "treinta", "cuarenta", "cincuenta", "sesenta", "setenta", "ochenta", "noventa"}
+	hundreds := []string{"", "ciento", "doscientos", "trescientos", "cuatrocientos", "quinientos", "seiscientos", "setecientos", "ochocientos", "novecientos"}
+
+	if number == 100 {
+		return "cien"
+	}
+
+	words := make([]string, 0)
+	if number >= 100 {
+		words = append(words, hundreds[number/100])
+		number %= 100
+		if number == 0 {
+			return strings.Join(words, " ")
+		}
+	}
+	switch {
+	case number < 30:
+		words = append(words, ones[number])
+	case number%10 == 0:
+		words = append(words, tens[number/10])
+	default:
+		words = append(words, tens[number/10], "y", ones[number%10])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// spellNumberFr spells out a number from 0-999 in French
+func spellNumberFr(number int) string {
+	ones := []string{"zéro", "un", "deux", "trois", "quatre", "cinq", "six", "sept", "huit", "neuf", "dix",
+		"onze", "douze", "treize", "quatorze", "quinze", "seize", "dix-sept", "dix-huit", "dix-neuf"}
+	tens := []string{"", "", "vingt", "trente", "quarante", "cinquante", "soixante", "soixante", "quatre-vingt", "quatre-vingt"}
+
+	words := make([]string, 0)
+	if number >= 100 {
+		hundreds := number / 100
+		number %= 100
+		switch {
+		case hundreds == 1:
+			words = append(words, "cent")
+		case number == 0:
+			// "cent" takes a plural only when it ends the number
+			words = append(words, ones[hundreds], "cents")
+		default:
+			words = append(words, ones[hundreds], "cent")
+		}
+		if number == 0 {
+			return strings.Join(words, " ")
+		}
+	}
+
+	switch {
+	case number < 20:
+		words = append(words, ones[number])
+	case number == 80:
+		words = append(words, "quatre-vingts")
+	default:
+		ten, unit := number/10, number%10
+		// seventies and nineties count on from sixty and eighty
+		if ten == 7 || ten == 9 {
+			unit += 10
+		}
+		switch {
+		case unit == 0:
+			words = append(words, tens[ten])
+		case unit == 1 && ten < 8, unit == 11 && ten == 7:
+			words = append(words, tens[ten], "et", ones[unit])
+		default:
+			words = append(words, tens[ten]+"-"+ones[unit])
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,83 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChapterTitleTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ChapterTitleTestSuite) TestFormatChapterTitle() {
+	testCases := []struct {
+		template string
+		language string
+		expected string
+	}{
+		{"{chapter} {n}", "en", "Chapter 7"},
+		{"{chapter} {n}", "de", "Kapitel 7"},
+		{"{chapter} {n:3}", "fr", "Chapitre 007"},
+		{"{chapter} {words}", "es", "Capítulo Siete"},
+		{"{roman}. {tag}", "en", "VII. Of the Nature of War"},
+		{"{n:2} - {file}", "en", "07 - 07-track"},
+		{"{chapter} {unknown}", "en", "Chapter {unknown}"},
+	}
+	for _, testCase := range testCases {
+		title := FormatChapterTitle(testCase.template, testCase.language, 7, "07-track", "Of the Nature of War")
+		assert.Equal(suite.T(), testCase.expected, title, testCase.template)
+	}
+}
+
+func (suite *ChapterTitleTestSuite) TestConfigChapterTitle() {
+	// defaults to English "Chapter N"
+	c1 := Config{}
+	assert.Equal(suite.T(), "Chapter 3", c1.ChapterTitle(3, "", ""))
+
+	// language tags are reduced to the primary language
+	c2 := Config{ChapterLanguage: "de-DE", ChapterTitleTemplate: "{chapter} {words}"}
+	assert.Equal(suite.T(), "Kapitel Einundzwanzig", c2.ChapterTitle(21, "", ""))
+
+	// unsupported languages fall back to English
+	c3 := Config{ChapterLanguage: "xx"}
+	assert.Equal(suite.T(), "Chapter 3", c3.ChapterTitle(3, "", ""))
+
+	assert.Nil(suite.T(), CheckChapterLanguage("fr_CA"))
+	assert.NotNil(suite.T(), CheckChapterLanguage("xx"))
+
+	// generated chapters use the template
+	b1 := Book{}
+	b1.ChaptersFromMarkers(Config{ChapterLanguage: "fr", ChapterTitleTemplate: "{chapter} {roman}"}, []MarkerPoint{{Duration: 2, End: 61}}, 120000, 0)
+	assert.Equal(suite.T(), "Chapitre I", b1.Chapters[0].Title)
+	assert.Equal(suite.T(), "Chapitre II", b1.Chapters[1].Title)
+
+	// only untitled chapters are titled
+	b2 := Book{Chapters: []*Chapter{{Title: "Prologue"}, {}}}
+	b2.titleUntitledChapters(Config{ChapterLanguage: "es"})
+	assert.Equal(suite.T(), "Prologue", b2.Chapters[0].Title)
+	assert.Equal(suite.T(), "Capítulo 2", b2.Chapters[1].Title)
+}
+
+func (suite *ChapterTitleTestSuite) TestSpellNumber() {
+	testCases := map[string]map[int]string{
+		"en": {1: "one", 13: "thirteen", 40: "forty", 42: "forty-two", 100: "one hundred", 315: "three hundred fifteen"},
+		"de": {1: "eins", 17: "siebzehn", 21: "einundzwanzig", 30: "dreißig", 100: "einhundert", 101: "einhunderteins", 245: "zweihundertfünfundvierzig"},
+		"es": {1: "uno", 16: "dieciséis", 21: "veintiuno", 35: "treinta y cinco", 100: "cien", 101: "ciento uno", 500: "quinientos"},
+		"fr": {1: "un", 17: "dix-sept", 21: "vingt et un", 22: "vingt-deux", 71: "soixante et onze", 80: "quatre-vingts", 81: "quatre-vingt-un", 99: "quatre-vingt-dix-neuf", 100: "cent", 200: "deux cents", 201: "deux cent un"},
+	}
+	for language, numbers := range testCases {
+		for number, expected := range numbers {
+			assert.Equal(suite.T(), expected, spellNumber(number, language), language)
+		}
+	}
+
+	// numbers too large to spell out are left as digits
+	assert.Equal(suite.T(), "1000", spellNumber(1000, "en"))
+}
+
+func (suite *ChapterTitleTestSuite) TestRomanNumeral() {
+	testCases := map[int]string{1: "I", 4: "IV", 9: "IX", 14: "XIV", 40: "XL", 90: "XC", 400: "CD", 1994: "MCMXCIV", 0: "0", 4000: "4000"}
+	for number, expected := range testCases {
+		assert.Equal(suite.T(), expected, romanNumeral(number))
+	}
+}
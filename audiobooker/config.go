@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/caarlos0/env/v6"
@@ -8,6 +9,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 const (
@@ -32,37 +35,105 @@ var formats = []string{
 	Opus,
 }
 
+// output formats of the bound book
+const (
+	OutputFormatM4b  = "m4b"
+	OutputFormatMp3  = "mp3"
+	OutputFormatOpus = "opus"
+)
+
+// OutputFormats list of the supported output formats
+var OutputFormats = []string{OutputFormatM4b, OutputFormatMp3, OutputFormatOpus}
+
+// CheckOutputFormat returns an error if the output format is not supported
+func CheckOutputFormat(format string) error {
+	for _, outputFormat := range OutputFormats {
+		if format == outputFormat {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %q, must be one of: %s", format, strings.Join(OutputFormats, ", "))
+}
+
 // Config application config data
 type Config struct {
+	// CacheDir directory of the persistent transcode cache, files aren't cached when empty
+	CacheDir string `yaml:"cache_dir" env:"CACHE_DIR"`
+	// ChapterLanguage language of the spelled out words in chapter titles
+	ChapterLanguage string `yaml:"chapter_language" env:"CHAPTER_LANGUAGE"`
+	// ChapterListFile optional chapter list file to use in place of generated chapters
+	ChapterListFile string
+	// ChapterTitleTemplate template for generated chapter titles
+	ChapterTitleTemplate string `yaml:"chapter_title_template" env:"CHAPTER_TITLE_TEMPLATE"`
+	// ChapterTitlesFile optional file of chapter titles, one per line, used in place of a chapters.txt file
+	ChapterTitlesFile string
 	// ChaptersFile file handler for chapters file
 	ChaptersFile *os.File
 	// DescriptionFilename optional filename for book description data
 	DescriptionFilename string
+	// EmbedSourceFile bind the single source file as it is, embedding the chapters and metadata without transcoding or combining it
+	EmbedSourceFile bool
+	// EncodingProfile name of the encoding profile used when transcoding, ffmpeg AAC defaults when empty
+	EncodingProfile string `yaml:"encoding_profile" env:"ENCODING_PROFILE"`
+	// EpubFile optional EPUB file used for chapter titles and book metadata, in place of one found in the source files
+	EpubFile string
+	// ExportChapterFormats formats to export the chapters of the bound book in, alongside the output file
+	ExportChapterFormats []string `yaml:"export_chapter_formats" env:"EXPORT_CHAPTER_FORMATS"`
 	// ExternalChapters pull chapters from existing file
 	ExternalChapters bool
 	// Jobs number of concurrent transcode jobs to run
 	Jobs int `yaml:"jobs" env:"JOBS"`
+	// LoudnessTarget integrated loudness in LUFS to correct each book to, no correction when zero
+	LoudnessTarget float64 `yaml:"loudness_target" env:"LOUDNESS_TARGET"`
+	// MaxChapterLength split chapters longer than this into even parts
+	MaxChapterLength time.Duration `yaml:"max_chapter_length" env:"MAX_CHAPTER_LENGTH"`
+	// MergeDuplicateTitles merge adjacent chapters with the same normalized title
+	MergeDuplicateTitles bool `yaml:"merge_duplicate_titles" env:"MERGE_DUPLICATE_TITLES"`
+	// MinChapterLength merge chapters shorter than this into their neighbor
+	MinChapterLength time.Duration `yaml:"min_chapter_length" env:"MIN_CHAPTER_LENGTH"`
 	// OutputFileDest path to output file TODO allow for custom file name
 	OutputFileDest string `yaml:"output_file_dest" env:"OUTPUT_FILE_DEST"`
 	// OutputFilePattern placeholder for output filename template
 	OutputFilePattern string `yaml:"output_file_pattern" env:"OUTPUT_FILE_PATTERN"`
+	// OutputFormat format of the bound book, m4b, mp3, or opus
+	OutputFormat string `yaml:"output_format" env:"OUTPUT_FORMAT"`
 	// OutputPathPattern placeholder for output path template
 	OutputPathPattern string `yaml:"output_path_pattern" env:"OUTPUT_PATH_PATTERN"`
 	// PathPattern placeholder template string
 	PathPattern string `yaml:"path_pattern" env:"PATH_PATTERN"`
+	// PrefixPartNames prefix embedded chapter titles with the name of the source file they came from
+	PrefixPartNames bool
+	// Progress receives the progress of the transcode, combine, and bind of the book, nothing is reported when nil
+	Progress ProgressReporter
 	// ScratchFilesPath path to put scratch files
 	ScratchFilesPath string `yaml:"scratch_files_path" env:"SCRATCH_FILES_PATH"`
+	// SplitAtSilence split long chapters at the strongest silence near each even split
+	SplitAtSilence bool `yaml:"split_at_silence" env:"SPLIT_AT_SILENCE"`
 	// SourceFilesPath wildcard glob of files to use as input TODO refine this into options
 	SourceFilesPath string
 	// TracksFile file handler for tracks to transcode/compile file
 	TracksFile *os.File
+	// TranscodeRetries times to retry a failed transcode, the remaining files keep transcoding when retries are set, otherwise the first failure stops them
+	TranscodeRetries int `yaml:"transcode_retries" env:"TRANSCODE_RETRIES"`
 	// VerboseTranscode show verbose output of ffmpeg commands
 	VerboseTranscode bool
 
+	// bookDuration audio duration of the source files, measured when they're transcoded
+	bookDuration time.Duration
+	// bookStart when work on the book started, the book-wide progress is measured from it
+	bookStart time.Time
+	// chapterTitlesFile scraped chapter titles file
+	chapterTitlesFile *string
 	// coverImage scraped cover image
 	coverImage *string
+	// cueSheet scraped standalone CUE sheet
+	cueSheet *string
 	// descriptionFile file handler book description file
 	descriptionFile *os.File
+	// epubFile scraped EPUB file
+	epubFile *string
+	// loudness loudness measured for the book, and the correction applied, when it's transcoded with a loudness target
+	loudness *LoudnessMeasurement
 	// OutputFile filename of final book output file
 	OutputFile string
 	// OutputPath rendered path directories
@@ -90,9 +161,15 @@ func (c *Config) Parse() error {
 }
 
 // New provisions new Config object
-func (c *Config) New() error {
+func (c *Config) New(ctx context.Context) error {
 	var err error
 
+	// don't start on a book once cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.bookStart = time.Now()
+
 	// if no path for scratch files is defined, use current directory
 	if c.ScratchFilesPath == "" {
 		c.ScratchFilesPath = "."
@@ -119,7 +196,7 @@ func (c *Config) New() error {
 	}
 
 	// setup final book output file
-	c.OutputFile = filepath.Join(c.OutputFileDest, "book.m4b")
+	c.OutputFile = filepath.Join(c.OutputFileDest, "book"+c.OutputExtension())
 
 	// pre output file path
 	c.preOutputFilePath = filepath.Join(c.scratchDir, "out.m4b")
@@ -132,6 +209,35 @@ func (c *Config) New() error {
 		return err
 	}
 
+	// an explicit EPUB file takes the place of one found in the source files
+	if c.EpubFile != "" {
+		c.epubFile = &c.EpubFile
+	}
+
+	// an explicit chapter titles file takes the place of one found in the source files
+	if c.ChapterTitlesFile != "" {
+		c.chapterTitlesFile = &c.ChapterTitlesFile
+	}
+
+	return nil
+}
+
+// PlanFromSourceFiles points the chapter generators at the source files in place of the transcoded files, which keep their names, lengths, and title tags, so a dry-run lists the chapters the book would get
+func (c *Config) PlanFromSourceFiles() {
+	c.transcodeFiles = append([]string{}, c.sourceFiles...)
+}
+
+// ValidateChapterProcessing returns an error if the chapter post-processing options are negative or conflict
+func (c *Config) ValidateChapterProcessing() error {
+	if c.MinChapterLength < 0 || c.MaxChapterLength < 0 {
+		return errors.New("chapter lengths must not be negative")
+	}
+	if c.SplitAtSilence && c.MaxChapterLength == 0 {
+		return errors.New("split-at-silence requires split-longer-than to be set")
+	}
+	if c.MinChapterLength > 0 && c.MaxChapterLength > 0 && c.MinChapterLength >= c.MaxChapterLength {
+		return errors.New("merge-shorter-than must be less than split-longer-than")
+	}
 	return nil
 }
 
@@ -171,9 +277,26 @@ func (c *Config) gatherSourceFilesFromDir() error {
 				log.Debugf("%s is valid, adding to list", path)
 				c.sourceFiles = append(c.sourceFiles, path)
 			}
+			if strings.EqualFold(filepath.Ext(path), ".cue") {
+				log.Debugf("%s CUE sheet found!!", path)
+				c.cueSheet = &path
+			}
+			if strings.EqualFold(filepath.Ext(path), ".epub") {
+				log.Debugf("%s EPUB found!!", path)
+				c.epubFile = &path
+			}
 			switch filepath.Base(path) {
 			case "cover.jpg", "cover.png", "folder.jpg", "folder.png":
 				c.coverImage = &path
+			case "chapters.txt":
+				// a chapters file passed in as the chapter list isn't a list of titles
+				if listInfo, err := os.Stat(c.ChapterListFile); err == nil {
+					if fileInfo, err := d.Info(); err == nil && os.SameFile(listInfo, fileInfo) {
+						break
+					}
+				}
+				log.Debugf("%s chapter titles file found!!", path)
+				c.chapterTitlesFile = &path
 			case "description.txt", "comment.txt", c.DescriptionFilename:
 				log.Debugf("%s description file found!!", path)
 				c.descriptionFile, err = os.Open(path)
@@ -215,6 +338,18 @@ func checkValidAudioFile(filename string) bool {
 	return false
 }
 
+// OutputExtension returns the file extension of the output format, defaulting to m4b
+func (c *Config) OutputExtension() string {
+	switch c.OutputFormat {
+	case OutputFormatMp3:
+		return Mp3
+	case OutputFormatOpus:
+		return Opus
+	default:
+		return M4b
+	}
+}
+
 // SetOutputFilename sets the output filename based on metadata
 func (c *Config) SetOutputFilename(book Book) error {
 	var err error
@@ -229,7 +364,7 @@ func (c *Config) SetOutputFilename(book Book) error {
 	}
 
 	// parse file pattern into output file
-	c.OutputFile = OutputFilePattern(book, c.OutputFilePattern)
+	c.OutputFile = OutputFilePattern(book, c.OutputFilePattern, c.OutputExtension())
 
 	return nil
 }
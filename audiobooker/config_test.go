@@ -1,12 +1,14 @@
 package audiobooker
 
 import (
+	"context"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type ConfigTestSuite struct {
@@ -77,7 +79,7 @@ func (suite *ConfigTestSuite) TestNewAndCleanup() {
 	}
 
 	// test config New
-	err = config.New()
+	err = config.New(context.Background())
 	assert.Nil(suite.T(), err)
 
 	// test clean up
@@ -90,6 +92,20 @@ func (suite *ConfigTestSuite) TestNewAndCleanup() {
 	}
 }
 
+func (suite *ConfigTestSuite) TestNewCancelled() {
+	config := Config{
+		SourceFilesPath:  suite.ScratchPath,
+		ScratchFilesPath: suite.ScratchPath,
+	}
+
+	// a cancelled book doesn't create a scratch directory
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := config.New(ctx)
+	assert.ErrorIs(suite.T(), err, context.Canceled)
+	assert.Equal(suite.T(), "", config.scratchDir)
+}
+
 func (suite *ConfigTestSuite) TestParse() {
 	config := Config{}
 	err := config.Parse()
@@ -125,7 +141,7 @@ func (suite *ConfigTestSuite) TestAddToFileList() {
 		SourceFilesPath:  suite.TestDataPath,
 	}
 
-	err := config.New()
+	err := config.New(context.Background())
 	assert.Nil(suite.T(), err)
 	defer config.Cleanup()
 
@@ -202,3 +218,28 @@ func (suite *ConfigTestSuite) TestCheckForSourceFile() {
 	_, err = c5.CheckForSourceFile(testBookDir)
 	assert.Error(suite.T(), err)
 }
+
+func (suite *ConfigTestSuite) TestValidateChapterProcessing() {
+	c1 := Config{MinChapterLength: time.Minute, MaxChapterLength: time.Hour, SplitAtSilence: true}
+	assert.Nil(suite.T(), c1.ValidateChapterProcessing())
+
+	c2 := Config{MinChapterLength: -time.Minute}
+	assert.NotNil(suite.T(), c2.ValidateChapterProcessing())
+
+	// splitting at silences needs chapters to split
+	c3 := Config{SplitAtSilence: true}
+	assert.NotNil(suite.T(), c3.ValidateChapterProcessing())
+
+	c4 := Config{MinChapterLength: time.Hour, MaxChapterLength: time.Minute}
+	assert.NotNil(suite.T(), c4.ValidateChapterProcessing())
+}
+
+func (suite *ConfigTestSuite) TestPlanFromSourceFiles() {
+	c1 := Config{sourceFiles: []string{"01.mp3", "02.mp3"}}
+	c1.PlanFromSourceFiles()
+	assert.Equal(suite.T(), []string{"01.mp3", "02.mp3"}, c1.transcodeFiles)
+
+	// the transcoded files replace the planned ones without changing the source files
+	c1.transcodeFiles[0] = "01.m4a"
+	assert.Equal(suite.T(), "01.mp3", c1.sourceFiles[0])
+}
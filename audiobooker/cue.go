@@ -0,0 +1,401 @@
+package audiobooker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CueSheet holds the parsed contents of a CUE sheet
+type CueSheet struct {
+	Date      string
+	Files     []CueFile
+	Genre     string
+	Performer string
+	Title     string
+}
+
+// CueFile holds a FILE entry of a CUE sheet and the tracks within it
+type CueFile struct {
+	Name   string
+	Tracks []CueTrack
+	Type   string
+}
+
+// CueTrack holds a TRACK entry of a CUE sheet
+type CueTrack struct {
+	Indexes   map[int]time.Duration
+	Number    int
+	Performer string
+	Title     string
+}
+
+// Start returns the start of the track relative to its file, INDEX 01 if present otherwise INDEX 00
+func (t CueTrack) Start() (time.Duration, bool) {
+	if start, ok := t.Indexes[1]; ok {
+		return start, true
+	}
+	start, ok := t.Indexes[0]
+	return start, ok
+}
+
+// ParseCueSheet parses CUE sheet data
+func ParseCueSheet(r io.Reader) (*CueSheet, error) {
+	sheet := new(CueSheet)
+	var file *CueFile
+	var track *CueTrack
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		// sanitize the leading and trailing spaces (and a possible byte order mark) prior to parsing
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+
+		command, args := splitCueLine(line)
+		switch strings.ToUpper(command) {
+		case "REM":
+			if len(args) < 2 {
+				continue
+			}
+			switch strings.ToUpper(args[0]) {
+			case "DATE":
+				sheet.Date = args[1]
+			case "GENRE":
+				sheet.Genre = args[1]
+			}
+		case "PERFORMER":
+			if len(args) == 0 {
+				continue
+			}
+			if track != nil {
+				track.Performer = args[0]
+			} else {
+				sheet.Performer = args[0]
+			}
+		case "TITLE":
+			if len(args) == 0 {
+				continue
+			}
+			if track != nil {
+				track.Title = args[0]
+			} else {
+				sheet.Title = args[0]
+			}
+		case "FILE":
+			if len(args) == 0 {
+				return nil, fmt.Errorf("line %d: FILE entry is missing a filename", lineNum)
+			}
+			sheet.Files = append(sheet.Files, CueFile{Name: args[0]})
+			file = &sheet.Files[len(sheet.Files)-1]
+			if len(args) > 1 {
+				file.Type = args[1]
+			}
+			track = nil
+		case "TRACK":
+			if file == nil {
+				return nil, fmt.Errorf("line %d: TRACK entry found before any FILE entry", lineNum)
+			}
+			if len(args) == 0 {
+				return nil, fmt.Errorf("line %d: TRACK entry is missing a number", lineNum)
+			}
+			number, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid track number %q", lineNum, args[0])
+			}
+			file.Tracks = append(file.Tracks, CueTrack{Number: number, Indexes: make(map[int]time.Duration)})
+			track = &file.Tracks[len(file.Tracks)-1]
+		case "INDEX":
+			if track == nil {
+				// a track whose pregap ends in the previous file continues in this one
+				track = continueCueTrack(sheet)
+			}
+			if track == nil {
+				return nil, fmt.Errorf("line %d: INDEX entry found before any TRACK entry", lineNum)
+			}
+			if len(args) < 2 {
+				return nil, fmt.Errorf("line %d: INDEX entry requires a number and a time code", lineNum)
+			}
+			number, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid index number %q", lineNum, args[0])
+			}
+			timeCode, err := parseCueTimeCode(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			track.Indexes[number] = timeCode
+		default:
+			log.Debugf("skipping unused CUE sheet entry: %s", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := sheet.validate(); err != nil {
+		return nil, err
+	}
+
+	return sheet, nil
+}
+
+// validate checks that the indexes of each track, and the tracks of each file, are in increasing order
+func (s *CueSheet) validate() error {
+	for _, file := range s.Files {
+		previous := time.Duration(-1)
+		for _, track := range file.Tracks {
+			// walk the indexes of the track in numeric order
+			numbers := make([]int, 0, len(track.Indexes))
+			for number := range track.Indexes {
+				numbers = append(numbers, number)
+			}
+			sort.Ints(numbers)
+
+			for _, number := range numbers {
+				if track.Indexes[number] <= previous {
+					return fmt.Errorf("INDEX %02d of track %d in %s is at %s, which is not after the index before it", number, track.Number, file.Name, track.Indexes[number])
+				}
+				previous = track.Indexes[number]
+			}
+		}
+	}
+
+	return nil
+}
+
+// continueCueTrack moves the last track of the previous file, when it has no INDEX 01, into the current file and returns it
+func continueCueTrack(sheet *CueSheet) *CueTrack {
+	if len(sheet.Files) < 2 {
+		return nil
+	}
+	previous := &sheet.Files[len(sheet.Files)-2]
+	if len(previous.Tracks) == 0 {
+		return nil
+	}
+	last := previous.Tracks[len(previous.Tracks)-1]
+	if _, ok := last.Indexes[1]; ok {
+		return nil
+	}
+
+	// the pregap stays with the previous file, so the track starts fresh in the current one
+	previous.Tracks = previous.Tracks[:len(previous.Tracks)-1]
+	last.Indexes = make(map[int]time.Duration)
+	current := &sheet.Files[len(sheet.Files)-1]
+	current.Tracks = append(current.Tracks, last)
+
+	return &current.Tracks[len(current.Tracks)-1]
+}
+
+// ParseCueSheetFile opens and parses a CUE sheet file
+func ParseCueSheetFile(filename string) (*CueSheet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseCueSheet(f)
+}
+
+// splitCueLine splits a CUE sheet line into its command and arguments, keeping quoted arguments together
+func splitCueLine(line string) (string, []string) {
+	fields := make([]string, 0)
+	var current strings.Builder
+	inQuotes := false
+	hasField := false
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasField {
+				fields = append(fields, current.String())
+				current.Reset()
+				hasField = false
+			}
+		default:
+			current.WriteRune(r)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, current.String())
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// ToChapters converts the tracks of the CUE sheet into Chapter objects, fileDurations holds the length of each FILE entry in order, untitled tracks are left untitled
+func (s *CueSheet) ToChapters(fileDurations []time.Duration) ([]*Chapter, error) {
+	if len(fileDurations) != len(s.Files) {
+		return nil, fmt.Errorf("CUE sheet lists %d files, but %d file durations were given", len(s.Files), len(fileDurations))
+	}
+
+	chapters := make([]*Chapter, 0)
+	offset := time.Duration(0)
+	for idx, file := range s.Files {
+		for _, track := range file.Tracks {
+			start, ok := track.Start()
+			if !ok {
+				log.Warnf("track %d of %s has no INDEX entry, skipping", track.Number, file.Name)
+				continue
+			}
+			if start >= fileDurations[idx] {
+				return nil, fmt.Errorf("track %d starts at %s, after the end of %s", track.Number, start, file.Name)
+			}
+			chapters = append(chapters, &Chapter{
+				Number:  len(chapters),
+				StartMs: (offset + start).Milliseconds(),
+				Title:   track.Title,
+			})
+		}
+		offset += fileDurations[idx]
+	}
+
+	if len(chapters) == 0 {
+		return nil, errors.New("no tracks with INDEX entries found in CUE sheet")
+	}
+
+	// the first chapter always starts at the beginning of the audio
+	chapters[0].StartMs = 0
+
+	// each chapter runs until the next one starts, the last runs until the end of the audio
+	for idx, chapter := range chapters {
+		if idx == len(chapters)-1 {
+			chapter.EndMs = offset.Milliseconds()
+		} else {
+			chapter.EndMs = chapters[idx+1].StartMs
+		}
+		chapter.LengthMs = chapter.EndMs - chapter.StartMs
+	}
+
+	return chapters, nil
+}
+
+// ChapterByCueSheet creates Chapter objects and book metadata from a standalone CUE sheet, ordering the source files to match it
+func (b *Book) ChapterByCueSheet(ctx context.Context, config *Config) error {
+	if config.cueSheet == nil {
+		return errors.New("no CUE sheet found in source files path")
+	}
+
+	sheet, err := ParseCueSheetFile(*config.cueSheet)
+	if err != nil {
+		return err
+	}
+	if len(sheet.Files) == 0 {
+		return fmt.Errorf("no FILE entries found in %s", *config.cueSheet)
+	}
+
+	// match the FILE entries of the sheet to the source files, then order the source files to match the sheet
+	orderedFiles, err := matchCueFiles(sheet, config.sourceFiles)
+	if err != nil {
+		return err
+	}
+	config.sourceFiles = orderedFiles
+
+	// get the length of each file to offset the tracks of the following files
+	fileDurations := make([]time.Duration, len(sheet.Files))
+	for idx := range sheet.Files {
+		fileData, err := ffprobe.ProbeURL(ctx, orderedFiles[idx])
+		if err != nil {
+			return err
+		}
+		fileDurations[idx] = fileData.Format.Duration()
+	}
+
+	b.Chapters, err = sheet.ToChapters(fileDurations)
+	if err != nil {
+		return err
+	}
+
+	// extend the last chapter over any source files not listed in the sheet
+	for _, extraFile := range orderedFiles[len(sheet.Files):] {
+		fileData, err := ffprobe.ProbeURL(ctx, extraFile)
+		if err != nil {
+			return err
+		}
+		lastChapter := b.Chapters[len(b.Chapters)-1]
+		lastChapter.EndMs += fileData.Format.Duration().Milliseconds()
+		lastChapter.LengthMs = lastChapter.EndMs - lastChapter.StartMs
+	}
+
+	b.titleUntitledChapters(*config)
+	b.chaptersTitled = true
+	b.ParseFromCueSheet(sheet)
+
+	return nil
+}
+
+// ParseFromCueSheet fills in book metadata from the CUE sheet that wasn't already set from the path
+func (b *Book) ParseFromCueSheet(sheet *CueSheet) {
+	if b.Title == "" {
+		b.Title = sheet.Title
+	}
+	if b.Author == "" {
+		b.Author = sheet.Performer
+	}
+	if b.Genre == nil && sheet.Genre != "" {
+		genre := sheet.Genre
+		b.Genre = &genre
+	}
+	if b.Date == nil && sheet.Date != "" {
+		date := sheet.Date
+		b.Date = &date
+	}
+}
+
+// matchCueFiles returns the source files in the order of the FILE entries in the CUE sheet
+func matchCueFiles(sheet *CueSheet, sourceFiles []string) ([]string, error) {
+	// a single file can be matched regardless of its name
+	if len(sheet.Files) == 1 && len(sourceFiles) == 1 {
+		return sourceFiles, nil
+	}
+
+	ordered := make([]string, 0, len(sourceFiles))
+	used := make(map[string]bool)
+	for _, file := range sheet.Files {
+		// CUE sheets written on Windows may use backslashes
+		name := filepath.Base(strings.ReplaceAll(file.Name, `\`, "/"))
+		match := ""
+		for _, sourceFile := range sourceFiles {
+			if strings.EqualFold(filepath.Base(sourceFile), name) {
+				match = sourceFile
+				break
+			}
+		}
+		if match == "" {
+			return nil, fmt.Errorf("CUE sheet file %s was not found in the source files", file.Name)
+		}
+		ordered = append(ordered, match)
+		used[match] = true
+	}
+
+	// any source files not listed in the sheet are appended to the end
+	for _, sourceFile := range sourceFiles {
+		if !used[sourceFile] {
+			log.Warnf("%s is not listed in the CUE sheet, adding it to the end of the book", sourceFile)
+			ordered = append(ordered, sourceFile)
+		}
+	}
+
+	return ordered, nil
+}
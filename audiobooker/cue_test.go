@@ -0,0 +1,166 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"time"
+)
+
+const testCueSheet = `REM GENRE "Audiobook"
+REM DATE 1903
+PERFORMER "Carl von Clausewitz"
+TITLE "On War"
+FILE "CD1.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "Book One"
+    PERFORMER "Some Narrator"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Book Two"
+    INDEX 00 10:30:00
+    INDEX 01 10:32:00
+FILE "CD2.flac" WAVE
+  TRACK 03 AUDIO
+    TITLE "Book Three"
+    INDEX 01 00:00:00
+  TRACK 04 AUDIO
+    INDEX 01 05:00:00
+`
+
+type CueTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CueTestSuite) TestParseCueSheet() {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	assert.Nil(suite.T(), err)
+
+	// disc level entries
+	assert.Equal(suite.T(), "Carl von Clausewitz", sheet.Performer)
+	assert.Equal(suite.T(), "On War", sheet.Title)
+	assert.Equal(suite.T(), "Audiobook", sheet.Genre)
+	assert.Equal(suite.T(), "1903", sheet.Date)
+
+	// file and track level entries
+	assert.Equal(suite.T(), 2, len(sheet.Files))
+	assert.Equal(suite.T(), "CD1.flac", sheet.Files[0].Name)
+	assert.Equal(suite.T(), "WAVE", sheet.Files[0].Type)
+	assert.Equal(suite.T(), 2, len(sheet.Files[0].Tracks))
+	assert.Equal(suite.T(), "Some Narrator", sheet.Files[0].Tracks[0].Performer)
+	assert.Equal(suite.T(), 2, sheet.Files[0].Tracks[1].Number)
+	assert.Equal(suite.T(), 10*time.Minute+30*time.Second, sheet.Files[0].Tracks[1].Indexes[0])
+
+	// INDEX 01 is preferred over INDEX 00 as the track start
+	start, ok := sheet.Files[0].Tracks[1].Start()
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), 10*time.Minute+32*time.Second, start)
+
+	// malformed sheets
+	_, err = ParseCueSheet(strings.NewReader("TRACK 01 AUDIO\n"))
+	assert.Error(suite.T(), err)
+	_, err = ParseCueSheet(strings.NewReader("FILE \"a.mp3\" MP3\n  TRACK 01 AUDIO\n    INDEX 01 nope\n"))
+	assert.Error(suite.T(), err)
+
+	// tracks must be in increasing order within a file
+	_, err = ParseCueSheet(strings.NewReader("FILE \"a.mp3\" MP3\n  TRACK 01 AUDIO\n    INDEX 01 05:00:00\n  TRACK 02 AUDIO\n    INDEX 01 04:59:74\n"))
+	assert.Error(suite.T(), err)
+	_, err = ParseCueSheet(strings.NewReader("FILE \"a.mp3\" MP3\n  TRACK 01 AUDIO\n    INDEX 00 05:00:00\n    INDEX 01 05:00:00\n"))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *CueTestSuite) TestParseCueSheetContinuedTrack() {
+	// the pregap of track 02 sits at the end of the first file, while the track itself starts the second file
+	raw := `FILE "CD1.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 00 09:58:00
+FILE "CD2.flac" WAVE
+    INDEX 01 00:00:37
+  TRACK 03 AUDIO
+    TITLE "Three"
+    INDEX 01 04:00:00
+`
+	sheet, err := ParseCueSheet(strings.NewReader(raw))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(sheet.Files[0].Tracks))
+	assert.Equal(suite.T(), 2, len(sheet.Files[1].Tracks))
+	assert.Equal(suite.T(), "Two", sheet.Files[1].Tracks[0].Title)
+
+	chapters, err := sheet.ToChapters([]time.Duration{10 * time.Minute, 10 * time.Minute})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(chapters))
+	assert.Equal(suite.T(), int64(600493), chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(600493), chapters[0].EndMs)
+}
+
+func (suite *CueTestSuite) TestToChapters() {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	assert.Nil(suite.T(), err)
+
+	chapters, err := sheet.ToChapters([]time.Duration{20 * time.Minute, 10 * time.Minute})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 4, len(chapters))
+
+	// tracks of the second file are offset by the length of the first
+	assert.Equal(suite.T(), int64(632000), chapters[0].EndMs)
+	assert.Equal(suite.T(), int64(1200000), chapters[2].StartMs)
+	assert.Equal(suite.T(), int64(1500000), chapters[3].StartMs)
+	assert.Equal(suite.T(), int64(1800000), chapters[3].EndMs)
+	assert.Equal(suite.T(), int64(300000), chapters[3].LengthMs)
+
+	// untitled tracks get a generated title
+	assert.Equal(suite.T(), "Book Three", chapters[2].Title)
+	// untitled tracks are left for the chapter title template
+	assert.Equal(suite.T(), "", chapters[3].Title)
+
+	// mismatched file durations
+	_, err = sheet.ToChapters([]time.Duration{20 * time.Minute})
+	assert.Error(suite.T(), err)
+
+	// track starts after the end of its file
+	_, err = sheet.ToChapters([]time.Duration{10 * time.Minute, 10 * time.Minute})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *CueTestSuite) TestMatchCueFiles() {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	assert.Nil(suite.T(), err)
+
+	// source files are ordered to match the sheet, unlisted files go last
+	ordered, err := matchCueFiles(sheet, []string{"src/bonus.mp3", "src/cd2.FLAC", "src/CD1.flac"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"src/CD1.flac", "src/cd2.FLAC", "src/bonus.mp3"}, ordered)
+
+	// missing source file
+	_, err = matchCueFiles(sheet, []string{"src/CD1.flac"})
+	assert.Error(suite.T(), err)
+
+	// a single file matches regardless of name
+	single := &CueSheet{Files: []CueFile{{Name: "renamed.wav"}}}
+	ordered, err = matchCueFiles(single, []string{"src/book.flac"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{"src/book.flac"}, ordered)
+}
+
+func (suite *CueTestSuite) TestParseFromCueSheet() {
+	sheet, err := ParseCueSheet(strings.NewReader(testCueSheet))
+	assert.Nil(suite.T(), err)
+
+	// empty book takes all the sheet metadata
+	b1 := Book{}
+	b1.ParseFromCueSheet(sheet)
+	assert.Equal(suite.T(), "Carl von Clausewitz", b1.Author)
+	assert.Equal(suite.T(), "On War", b1.Title)
+	assert.Equal(suite.T(), "Audiobook", *b1.Genre)
+	assert.Equal(suite.T(), "1903", *b1.Date)
+
+	// path tags are not overridden
+	b2 := Book{Author: "Path Author", Title: "Path Title"}
+	b2.ParseFromCueSheet(sheet)
+	assert.Equal(suite.T(), "Path Author", b2.Author)
+	assert.Equal(suite.T(), "Path Title", b2.Title)
+}
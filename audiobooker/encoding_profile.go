@@ -0,0 +1,121 @@
+package audiobooker
+
+import (
+	"fmt"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"sort"
+	"strings"
+)
+
+// EncodingProfile audio encoder settings used when transcoding source files
+type EncodingProfile struct {
+	// Codec ffmpeg audio encoder
+	Codec string
+	// Profile optional encoder profile, such as aac_he
+	Profile string
+	// Bitrate constant target bitrate, ignored when Quality is set
+	Bitrate string
+	// Quality variable bitrate quality of the encoder
+	Quality string
+	// Mp3Quality libmp3lame variable bitrate quality, 0 best to 9 smallest, used for MP3 output of variable bitrate profiles
+	Mp3Quality string
+	// OpusBitrate libopus variable bitrate target, used for Opus output of variable bitrate profiles
+	OpusBitrate string
+	// Channels number of audio channels, the source channel count when zero
+	Channels int
+	// SampleRate sample rate in Hz, the source sample rate when zero
+	SampleRate int
+}
+
+// defaultEncodingProfile profile used when none is selected, AAC with the ffmpeg defaults
+var defaultEncodingProfile = EncodingProfile{Codec: "aac"}
+
+// encodingProfiles named profiles that may be selected
+var encodingProfiles = map[string]EncodingProfile{
+	"spoken-mono-48k":          {Codec: "aac", Bitrate: "48k", Channels: 1, SampleRate: 44100},
+	"spoken-mono-vbr":          {Codec: "aac", Quality: "1", Mp3Quality: "7", OpusBitrate: "32k", Channels: 1, SampleRate: 44100},
+	"high-quality-stereo-128k": {Codec: "aac", Bitrate: "128k", Channels: 2, SampleRate: 44100},
+	// HE-AAC requires ffmpeg to be built with libfdk_aac
+	"he-aac-32k": {Codec: "libfdk_aac", Profile: "aac_he", Bitrate: "32k", Channels: 2, SampleRate: 44100},
+}
+
+// EncodingProfiles returns the sorted names of the encoding profiles
+func EncodingProfiles() []string {
+	names := make([]string, 0, len(encodingProfiles))
+	for name := range encodingProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckEncodingProfile returns an error if the encoding profile doesn't exist
+func CheckEncodingProfile(name string) error {
+	if _, ok := encodingProfiles[name]; !ok {
+		return fmt.Errorf("unknown encoding profile %q, must be one of: %s", name, strings.Join(EncodingProfiles(), ", "))
+	}
+	return nil
+}
+
+// GetEncodingProfile returns the named encoding profile, or the default profile if name is empty
+func GetEncodingProfile(name string) (EncodingProfile, error) {
+	if name == "" {
+		return defaultEncodingProfile, nil
+	}
+	if err := CheckEncodingProfile(name); err != nil {
+		return EncodingProfile{}, err
+	}
+	return encodingProfiles[name], nil
+}
+
+// ffmpegArgs returns the ffmpeg output arguments that encode audio with the profile
+func (p EncodingProfile) ffmpegArgs() ffmpeg_go.KwArgs {
+	args := ffmpeg_go.KwArgs{"c:a": p.Codec}
+	if p.Profile != "" {
+		args["profile:a"] = p.Profile
+	}
+	if p.Quality != "" {
+		args["q:a"] = p.Quality
+	} else if p.Bitrate != "" {
+		args["b:a"] = p.Bitrate
+	}
+	if p.Channels > 0 {
+		args["ac"] = p.Channels
+	}
+	if p.SampleRate > 0 {
+		args["ar"] = p.SampleRate
+	}
+	return args
+}
+
+// mp3Args returns the libmp3lame output arguments of the profile, variable bitrate profiles use lame's variable bitrate quality
+func (p EncodingProfile) mp3Args() ffmpeg_go.KwArgs {
+	args := ffmpeg_go.KwArgs{"c:a": "libmp3lame"}
+	if p.Quality != "" {
+		args["q:a"] = p.Mp3Quality
+	} else if p.Bitrate != "" {
+		args["b:a"] = p.Bitrate
+	}
+	if p.Channels > 0 {
+		args["ac"] = p.Channels
+	}
+	if p.SampleRate > 0 {
+		args["ar"] = p.SampleRate
+	}
+	return args
+}
+
+// opusArgs returns the libopus output arguments of the profile, Opus only encodes at 48 kHz and its divisions so the sample rate is left to ffmpeg
+func (p EncodingProfile) opusArgs() ffmpeg_go.KwArgs {
+	args := ffmpeg_go.KwArgs{"c:a": "libopus", "b:a": "48k"}
+	if p.Quality != "" {
+		args["vbr"] = "on"
+		args["b:a"] = p.OpusBitrate
+	} else if p.Bitrate != "" {
+		args["b:a"] = p.Bitrate
+	}
+	if p.Channels > 0 {
+		args["ac"] = p.Channels
+	}
+	return args
+}
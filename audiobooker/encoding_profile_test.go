@@ -0,0 +1,72 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+)
+
+type EncodingProfileTestSuite struct {
+	suite.Suite
+}
+
+func (suite *EncodingProfileTestSuite) TestGetEncodingProfile() {
+	// no profile keeps the ffmpeg defaults
+	profile, err := GetEncodingProfile("")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "aac"}, profile.ffmpegArgs())
+
+	profile, err = GetEncodingProfile("spoken-mono-48k")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "aac", "b:a": "48k", "ac": 1, "ar": 44100}, profile.ffmpegArgs())
+
+	// variable bitrate quality is used in place of a bitrate
+	profile, err = GetEncodingProfile("spoken-mono-vbr")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "aac", "q:a": "1", "ac": 1, "ar": 44100}, profile.ffmpegArgs())
+
+	profile, err = GetEncodingProfile("he-aac-32k")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "aac_he", profile.ffmpegArgs()["profile:a"])
+
+	_, err = GetEncodingProfile("lossless")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *EncodingProfileTestSuite) TestCheckEncodingProfile() {
+	for _, name := range EncodingProfiles() {
+		assert.Nil(suite.T(), CheckEncodingProfile(name))
+	}
+	assert.Equal(suite.T(), []string{"he-aac-32k", "high-quality-stereo-128k", "spoken-mono-48k", "spoken-mono-vbr"}, EncodingProfiles())
+	assert.ErrorContains(suite.T(), CheckEncodingProfile(""), "must be one of: he-aac-32k")
+}
+
+func (suite *EncodingProfileTestSuite) TestOutputFormatArgs() {
+	// constant bitrate profiles keep their bitrate
+	profile, err := GetEncodingProfile("spoken-mono-48k")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libmp3lame", "b:a": "48k", "ac": 1, "ar": 44100}, profile.mp3Args())
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libopus", "b:a": "48k", "ac": 1}, profile.opusArgs())
+
+	// variable bitrate profiles use the variable bitrate mode of each encoder
+	profile, err = GetEncodingProfile("spoken-mono-vbr")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libmp3lame", "q:a": "7", "ac": 1, "ar": 44100}, profile.mp3Args())
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libopus", "vbr": "on", "b:a": "32k", "ac": 1}, profile.opusArgs())
+
+	// the default profile leaves the MP3 bitrate to lame
+	profile, err = GetEncodingProfile("")
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libmp3lame"}, profile.mp3Args())
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "libopus", "b:a": "48k"}, profile.opusArgs())
+
+	// every variable bitrate profile sets the quality of each output format
+	for _, name := range EncodingProfiles() {
+		profile, err := GetEncodingProfile(name)
+		assert.Nil(suite.T(), err)
+		if profile.Quality != "" {
+			assert.NotEmpty(suite.T(), profile.Mp3Quality, name)
+			assert.NotEmpty(suite.T(), profile.OpusBitrate, name)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package audiobooker
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Epub holds the book metadata and table of contents read from an EPUB file
+type Epub struct {
+	Author      string
+	Description string
+	Language    string
+	Title       string
+	TocTitles   []string
+}
+
+// epubContainer holds the META-INF/container.xml data of an EPUB file
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage holds the OPF package document data of an EPUB file
+type epubPackage struct {
+	Metadata struct {
+		Creators    []string `xml:"creator"`
+		Description string   `xml:"description"`
+		Language    string   `xml:"language"`
+		Titles      []string `xml:"title"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Href       string `xml:"href,attr"`
+		ID         string `xml:"id,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc string `xml:"toc,attr"`
+	} `xml:"spine"`
+}
+
+// epubNcx holds the top level entries of an EPUB 2 NCX table of contents
+type epubNcx struct {
+	NavPoints []struct {
+		Label string `xml:"navLabel>text"`
+	} `xml:"navMap>navPoint"`
+}
+
+// epubNav holds the top level entries of an EPUB 3 navigation document table of contents
+type epubNav struct {
+	Items []struct {
+		Anchor epubInnerXml `xml:"a"`
+		Span   epubInnerXml `xml:"span"`
+	} `xml:"ol>li"`
+}
+
+// epubInnerXml holds the raw contents of an element
+type epubInnerXml struct {
+	Inner string `xml:",innerxml"`
+}
+
+// tagRegex matches markup tags
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// ParseEpub reads the metadata and top level table of contents entries from an EPUB file
+func ParseEpub(filename string) (*Epub, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	// the container points to the OPF package document
+	container := epubContainer{}
+	if err := readEpubXml(&archive.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "" {
+		return nil, errors.New("no package document found in EPUB container")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	pkg := epubPackage{}
+	if err := readEpubXml(&archive.Reader, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	epub := &Epub{
+		Description: cleanEpubText(pkg.Metadata.Description),
+		Language:    strings.TrimSpace(pkg.Metadata.Language),
+	}
+	if len(pkg.Metadata.Titles) > 0 {
+		epub.Title = cleanEpubText(pkg.Metadata.Titles[0])
+	}
+	if len(pkg.Metadata.Creators) > 0 {
+		epub.Author = cleanEpubText(pkg.Metadata.Creators[0])
+	}
+
+	// prefer the EPUB 3 navigation document, falling back to the EPUB 2 NCX
+	navHref, ncxHref := "", ""
+	for _, item := range pkg.Manifest {
+		switch {
+		case navHref == "" && strings.Contains(" "+item.Properties+" ", " nav "):
+			navHref = item.Href
+		case ncxHref == "" && (item.ID == pkg.Spine.Toc || item.MediaType == "application/x-dtbncx+xml"):
+			ncxHref = item.Href
+		}
+	}
+
+	switch {
+	case navHref != "":
+		epub.TocTitles, err = readEpubNav(&archive.Reader, resolveEpubHref(opfPath, navHref))
+	case ncxHref != "":
+		epub.TocTitles, err = readEpubNcx(&archive.Reader, resolveEpubHref(opfPath, ncxHref))
+	default:
+		log.Warnf("no table of contents found in %s", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return epub, nil
+}
+
+// ParseFromEpub fills in book metadata from the EPUB file of the config that wasn't already set from the path, keeping its table of contents to title the chapters
+func (b *Book) ParseFromEpub(config Config) error {
+	if config.epubFile == nil {
+		return nil
+	}
+
+	epub, err := ParseEpub(*config.epubFile)
+	if err != nil {
+		return fmt.Errorf("error reading EPUB %s: %v", *config.epubFile, err)
+	}
+
+	if b.Title == "" {
+		b.Title = epub.Title
+	}
+	if b.Author == "" {
+		b.Author = epub.Author
+	}
+	if b.Description == nil && epub.Description != "" {
+		description := escapeDescription(epub.Description)
+		b.Description = &description
+	}
+	if b.Language == nil && epub.Language != "" {
+		language := epub.Language
+		b.Language = &language
+	}
+	b.tocTitles = epub.TocTitles
+
+	return nil
+}
+
+// readEpubXml decodes an XML file within the EPUB archive
+func readEpubXml(archive *zip.Reader, name string, v any) error {
+	f, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("%s not found in EPUB: %v", name, err)
+	}
+	defer f.Close()
+
+	decoder := newEpubDecoder(f)
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// readEpubNav returns the top level entries of the toc nav element of an EPUB 3 navigation document
+func readEpubNav(archive *zip.Reader, name string) ([]string, error) {
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in EPUB: %v", name, err)
+	}
+	defer f.Close()
+
+	decoder := newEpubDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no toc nav element found in %s", name)
+		} else if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", name, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "nav" || !isTocNav(start) {
+			continue
+		}
+
+		nav := epubNav{}
+		if err := decoder.DecodeElement(&nav, &start); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", name, err)
+		}
+		titles := make([]string, 0, len(nav.Items))
+		for _, item := range nav.Items {
+			title := cleanEpubText(item.Anchor.Inner)
+			if title == "" {
+				title = cleanEpubText(item.Span.Inner)
+			}
+			titles = append(titles, title)
+		}
+		return titles, nil
+	}
+}
+
+// readEpubNcx returns the top level entries of an EPUB 2 NCX table of contents
+func readEpubNcx(archive *zip.Reader, name string) ([]string, error) {
+	ncx := epubNcx{}
+	if err := readEpubXml(archive, name, &ncx); err != nil {
+		return nil, err
+	}
+
+	titles := make([]string, 0, len(ncx.NavPoints))
+	for _, navPoint := range ncx.NavPoints {
+		titles = append(titles, cleanEpubText(navPoint.Label))
+	}
+
+	return titles, nil
+}
+
+// isTocNav checks if a nav element is the table of contents
+func isTocNav(start xml.StartElement) bool {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			for _, navType := range strings.Fields(attr.Value) {
+				if navType == "toc" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// newEpubDecoder creates an XML decoder lenient enough for the XHTML found in EPUB files
+func newEpubDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+// resolveEpubHref resolves a manifest href relative to the OPF package document
+func resolveEpubHref(opfPath, href string) string {
+	// drop any fragment and decode escaped characters
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(path.Dir(opfPath), href)
+}
+
+// cleanEpubText strips markup from EPUB text and collapses its whitespace
+func cleanEpubText(text string) string {
+	text = html.UnescapeString(tagRegex.ReplaceAllString(text, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
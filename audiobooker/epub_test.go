@@ -0,0 +1,166 @@
+package audiobooker
+
+import (
+	"archive/zip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+)
+
+const testEpubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const testEpubOpf = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>On War</dc:title>
+    <dc:creator>Carl von Clausewitz</dc:creator>
+    <dc:language>en</dc:language>
+    <dc:description>&lt;p&gt;A treatise on &lt;i&gt;military&lt;/i&gt; strategy.&lt;/p&gt;</dc:description>
+  </metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="nav" href="text/nav%20doc.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+  </manifest>
+  <spine toc="ncx"/>
+</package>`
+
+const testEpubNav = `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+  <nav epub:type="landmarks"><ol><li><a href="cover.xhtml">Cover</a></li></ol></nav>
+  <nav epub:type="toc">
+    <ol>
+      <li><a href="one.xhtml">Book One:&nbsp;<em>On the Nature of War</em></a>
+        <ol>
+          <li><a href="one.xhtml#c1">What is War?</a></li>
+        </ol>
+      </li>
+      <li><span>Book Two</span>
+        <ol><li><a href="two.xhtml">Branches of the Art of War</a></li></ol>
+      </li>
+      <li><a href="three.xhtml">Book Three &amp; Strategy</a></li>
+    </ol>
+  </nav>
+</body>
+</html>`
+
+const testEpubNcx = `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1" playOrder="1">
+      <navLabel><text>Book One</text></navLabel>
+      <navPoint id="p1-1" playOrder="2"><navLabel><text>What is War?</text></navLabel></navPoint>
+    </navPoint>
+    <navPoint id="p2" playOrder="3"><navLabel><text>Book Two</text></navLabel></navPoint>
+  </navMap>
+</ncx>`
+
+type EpubTestSuite struct {
+	suite.Suite
+}
+
+// writeTestEpub creates an EPUB file from a map of archive paths to content
+func writeTestEpub(filename string, files map[string]string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (suite *EpubTestSuite) TestParseEpubNav() {
+	filename := filepath.Join(UtScratchDirectory, "nav.epub")
+	err := writeTestEpub(filename, map[string]string{
+		"mimetype":                 "application/epub+zip",
+		"META-INF/container.xml":   testEpubContainer,
+		"OEBPS/content.opf":        testEpubOpf,
+		"OEBPS/toc.ncx":            testEpubNcx,
+		"OEBPS/text/nav doc.xhtml": testEpubNav,
+	})
+	assert.Nil(suite.T(), err)
+
+	epub, err := ParseEpub(filename)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "On War", epub.Title)
+	assert.Equal(suite.T(), "Carl von Clausewitz", epub.Author)
+	assert.Equal(suite.T(), "en", epub.Language)
+	assert.Equal(suite.T(), "A treatise on military strategy.", epub.Description)
+	// only the top level entries of the toc nav are used, preferring the nav over the NCX
+	assert.Equal(suite.T(), []string{"Book One: On the Nature of War", "Book Two", "Book Three & Strategy"}, epub.TocTitles)
+}
+
+func (suite *EpubTestSuite) TestParseEpubNcx() {
+	filename := filepath.Join(UtScratchDirectory, "ncx.epub")
+	err := writeTestEpub(filename, map[string]string{
+		"META-INF/container.xml": testEpubContainer,
+		"OEBPS/content.opf":      testEpubOpf,
+		"OEBPS/toc.ncx":          testEpubNcx,
+	})
+	assert.Nil(suite.T(), err)
+
+	// a nav document listed in the manifest must be in the archive
+	epub, err := ParseEpub(filename)
+	assert.NotNil(suite.T(), err)
+	assert.Nil(suite.T(), epub)
+
+	err = writeTestEpub(filename, map[string]string{
+		"META-INF/container.xml": testEpubContainer,
+		"OEBPS/content.opf":      `<package><metadata><title>On War</title></metadata><manifest><item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/></manifest><spine toc="ncx"/></package>`,
+		"OEBPS/toc.ncx":          testEpubNcx,
+	})
+	assert.Nil(suite.T(), err)
+
+	epub, err = ParseEpub(filename)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "On War", epub.Title)
+	assert.Equal(suite.T(), []string{"Book One", "Book Two"}, epub.TocTitles)
+
+	// not an EPUB
+	_, err = ParseEpub(filepath.Join(UtScratchDirectory, "missing.epub"))
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *EpubTestSuite) TestParseFromEpub() {
+	filename := filepath.Join(UtScratchDirectory, "metadata.epub")
+	err := writeTestEpub(filename, map[string]string{
+		"META-INF/container.xml":   testEpubContainer,
+		"OEBPS/content.opf":        testEpubOpf,
+		"OEBPS/text/nav doc.xhtml": testEpubNav,
+	})
+	assert.Nil(suite.T(), err)
+
+	// no EPUB found
+	b1 := Book{}
+	err = b1.ParseFromEpub(Config{})
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), b1.tocTitles)
+
+	// path tags take precedence over the EPUB metadata
+	b2 := Book{Title: "Vom Kriege"}
+	err = b2.ParseFromEpub(Config{epubFile: &filename})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(b2.tocTitles))
+	assert.Equal(suite.T(), "Vom Kriege", b2.Title)
+	assert.Equal(suite.T(), "Carl von Clausewitz", b2.Author)
+	assert.Equal(suite.T(), "en", *b2.Language)
+	assert.Equal(suite.T(), "A treatise on military strategy.\n", *b2.Description)
+}
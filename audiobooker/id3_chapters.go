@@ -0,0 +1,350 @@
+package audiobooker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// id3HeaderSize size of the ID3v2 tag header and of each ID3v2.3/2.4 frame header
+	id3HeaderSize = 10
+	// id3FlagUnsynchronisation tag header flag for unsynchronised tags
+	id3FlagUnsynchronisation = 0x80
+	// id3FlagExtendedHeader tag header flag for tags with an extended header
+	id3FlagExtendedHeader = 0x40
+	// ctocFlagTopLevel CTOC flag marking the root table of contents
+	ctocFlagTopLevel = 0x02
+)
+
+// id3Chapter holds a CHAP frame of an ID3v2 tag
+type id3Chapter struct {
+	ID      string
+	StartMs int64
+	EndMs   int64
+	Title   string
+}
+
+// id3Toc holds a CTOC frame of an ID3v2 tag
+type id3Toc struct {
+	ID       string
+	TopLevel bool
+	Children []string
+}
+
+// ReadID3Chapters returns the chapters of the ID3v2 CHAP frames of an MP3 file, ordered by its table of contents if it has one
+func ReadID3Chapters(filename string) ([]*Chapter, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	chapters, err := ParseID3Chapters(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ID3 chapters from %s: %v", filename, err)
+	}
+
+	return chapters, nil
+}
+
+// ParseID3Chapters parses the CHAP and CTOC frames of the ID3v2 tag at the start of r into Chapter objects, returning no chapters when there is no tag
+func ParseID3Chapters(r io.Reader) ([]*Chapter, error) {
+	header := make([]byte, id3HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	if version != 3 && version != 4 {
+		// ID3v2.2 predates chapter frames
+		log.Debugf("ID3v2.%d tags don't support chapters", version)
+		return nil, nil
+	}
+
+	tag := make([]byte, syncsafeInt(header[6:10]))
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, fmt.Errorf("truncated ID3 tag: %v", err)
+	}
+	// version 2.3 unsynchronises the whole tag, version 2.4 each frame
+	if version == 3 && flags&id3FlagUnsynchronisation != 0 {
+		tag = removeUnsynchronisation(tag)
+	}
+
+	// skip the extended header, version 2.3 doesn't count the size bytes in its size
+	if flags&id3FlagExtendedHeader != 0 {
+		if len(tag) < 4 {
+			return nil, errors.New("truncated ID3 extended header")
+		}
+		extendedSize := int(binary.BigEndian.Uint32(tag[:4])) + 4
+		if version == 4 {
+			extendedSize = syncsafeInt(tag[:4])
+		}
+		if extendedSize > len(tag) {
+			return nil, errors.New("truncated ID3 extended header")
+		}
+		tag = tag[extendedSize:]
+	}
+
+	frames, err := parseID3Frames(tag, version)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make(map[string]*id3Chapter)
+	chapterOrder := make([]*id3Chapter, 0)
+	tocs := make(map[string]*id3Toc)
+	var topLevel *id3Toc
+	for _, frame := range frames {
+		switch frame.ID {
+		case "CHAP":
+			chapter, err := parseChapFrame(frame.Data, version)
+			if err != nil {
+				return nil, err
+			}
+			chapters[chapter.ID] = chapter
+			chapterOrder = append(chapterOrder, chapter)
+		case "CTOC":
+			toc, err := parseCtocFrame(frame.Data)
+			if err != nil {
+				return nil, err
+			}
+			tocs[toc.ID] = toc
+			if toc.TopLevel && topLevel == nil {
+				topLevel = toc
+			}
+		}
+	}
+	if len(chapterOrder) == 0 {
+		return nil, nil
+	}
+
+	// follow the table of contents, falling back to the start times without one
+	ordered := make([]*id3Chapter, 0, len(chapterOrder))
+	if topLevel != nil {
+		ordered = flattenID3Toc(topLevel, tocs, chapters, ordered, map[string]bool{})
+	}
+	if len(ordered) == 0 {
+		ordered = append(ordered, chapterOrder...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].StartMs < ordered[j].StartMs
+		})
+	}
+
+	result := make([]*Chapter, len(ordered))
+	for idx, chapter := range ordered {
+		endMs := chapter.EndMs
+		// fill in missing end times from the start of the next chapter
+		if endMs <= chapter.StartMs && idx < len(ordered)-1 {
+			endMs = ordered[idx+1].StartMs
+		}
+		result[idx] = &Chapter{
+			Number:   idx,
+			StartMs:  chapter.StartMs,
+			EndMs:    endMs,
+			LengthMs: endMs - chapter.StartMs,
+			Title:    chapter.Title,
+		}
+	}
+
+	return result, nil
+}
+
+// id3Frame holds the ID and data of an ID3v2 frame
+type id3Frame struct {
+	ID   string
+	Data []byte
+}
+
+// parseID3Frames splits the body of an ID3v2.3 or ID3v2.4 tag, or the sub-frames of a CHAP or CTOC frame, into frames
+func parseID3Frames(data []byte, version byte) ([]id3Frame, error) {
+	frames := make([]id3Frame, 0)
+	for len(data) >= id3HeaderSize {
+		// the rest of the tag is padding
+		if data[0] == 0 {
+			break
+		}
+
+		id := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if version == 4 {
+			size = syncsafeInt(data[4:8])
+		}
+		frameFlags := data[9]
+		if size > len(data)-id3HeaderSize {
+			return nil, fmt.Errorf("truncated %s frame", id)
+		}
+
+		body := data[id3HeaderSize : id3HeaderSize+size]
+		if version == 4 {
+			// skip the data length indicator and undo the unsynchronisation of the frame
+			if frameFlags&0x01 != 0 && len(body) >= 4 {
+				body = body[4:]
+			}
+			if frameFlags&0x02 != 0 {
+				body = removeUnsynchronisation(body)
+			}
+		}
+		frames = append(frames, id3Frame{ID: id, Data: body})
+		data = data[id3HeaderSize+size:]
+	}
+
+	return frames, nil
+}
+
+// parseChapFrame parses a CHAP frame body into its element ID, times, and title
+func parseChapFrame(data []byte, version byte) (*id3Chapter, error) {
+	id, rest, ok := cutNullTerminated(data)
+	if !ok || len(rest) < 16 {
+		return nil, errors.New("truncated CHAP frame")
+	}
+
+	chapter := &id3Chapter{
+		ID:      id,
+		StartMs: int64(binary.BigEndian.Uint32(rest[0:4])),
+		EndMs:   int64(binary.BigEndian.Uint32(rest[4:8])),
+	}
+
+	subFrames, err := parseID3Frames(rest[16:], version)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CHAP %s: %v", id, err)
+	}
+	chapter.Title = id3FrameText(subFrames, "TIT2")
+
+	return chapter, nil
+}
+
+// parseCtocFrame parses a CTOC frame body into its element ID, flags, and child element IDs
+func parseCtocFrame(data []byte) (*id3Toc, error) {
+	id, rest, ok := cutNullTerminated(data)
+	if !ok || len(rest) < 2 {
+		return nil, errors.New("truncated CTOC frame")
+	}
+
+	toc := &id3Toc{
+		ID:       id,
+		TopLevel: rest[0]&ctocFlagTopLevel != 0,
+	}
+	count := int(rest[1])
+	rest = rest[2:]
+	for i := 0; i < count; i++ {
+		child, remaining, ok := cutNullTerminated(rest)
+		if !ok {
+			return nil, fmt.Errorf("truncated CTOC %s entries", id)
+		}
+		toc.Children = append(toc.Children, child)
+		rest = remaining
+	}
+
+	return toc, nil
+}
+
+// flattenID3Toc appends the chapters of a table of contents in order, expanding nested tables of contents in place
+func flattenID3Toc(toc *id3Toc, tocs map[string]*id3Toc, chapters map[string]*id3Chapter, ordered []*id3Chapter, seen map[string]bool) []*id3Chapter {
+	// guard against tables of contents that contain themselves
+	if seen[toc.ID] {
+		return ordered
+	}
+	seen[toc.ID] = true
+
+	for _, child := range toc.Children {
+		if chapter, ok := chapters[child]; ok {
+			ordered = append(ordered, chapter)
+		} else if nested, ok := tocs[child]; ok {
+			ordered = flattenID3Toc(nested, tocs, chapters, ordered, seen)
+		} else {
+			log.Warnf("ID3 table of contents %s references missing element %s", toc.ID, child)
+		}
+	}
+
+	return ordered
+}
+
+// id3FrameText returns the decoded text of the first text frame with the ID
+func id3FrameText(frames []id3Frame, id string) string {
+	for _, frame := range frames {
+		if frame.ID == id && len(frame.Data) > 0 {
+			return strings.TrimSpace(decodeID3Text(frame.Data[0], frame.Data[1:]))
+		}
+	}
+	return ""
+}
+
+// decodeID3Text decodes ID3 text in the given encoding, ISO-8859-1, UTF-16 with a byte order mark, UTF-16BE, or UTF-8
+func decodeID3Text(encoding byte, data []byte) string {
+	var text string
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(data))
+		for idx, b := range data {
+			runes[idx] = rune(b)
+		}
+		text = string(runes)
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				bigEndian = false
+				data = data[2:]
+			} else if data[0] == 0xFE && data[1] == 0xFF {
+				bigEndian = true
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for idx := 0; idx+1 < len(data); idx += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[idx:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[idx:]))
+			}
+		}
+		text = string(utf16.Decode(units))
+	default:
+		text = string(data)
+	}
+
+	// text frames may hold multiple null separated values, keep the first
+	text, _, _ = strings.Cut(text, "\x00")
+	return text
+}
+
+// cutNullTerminated splits a null terminated ISO-8859-1 string from the start of data
+func cutNullTerminated(data []byte) (string, []byte, bool) {
+	idx := bytes.IndexByte(data, 0)
+	if idx < 0 {
+		return "", nil, false
+	}
+	return string(data[:idx]), data[idx+1:], true
+}
+
+// syncsafeInt decodes a 4 byte ID3 syncsafe integer, which uses 7 bits per byte
+func syncsafeInt(data []byte) int {
+	return int(data[0]&0x7f)<<21 | int(data[1]&0x7f)<<14 | int(data[2]&0x7f)<<7 | int(data[3]&0x7f)
+}
+
+// removeUnsynchronisation drops the zero bytes inserted after each 0xFF byte by ID3 unsynchronisation
+func removeUnsynchronisation(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for idx := 0; idx < len(data); idx++ {
+		out = append(out, data[idx])
+		if data[idx] == 0xFF && idx+1 < len(data) && data[idx+1] == 0x00 {
+			idx++
+		}
+	}
+	return out
+}
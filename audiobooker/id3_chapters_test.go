@@ -0,0 +1,150 @@
+package audiobooker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+)
+
+type ID3ChaptersTestSuite struct {
+	suite.Suite
+}
+
+// testID3Frame builds an ID3v2.3 or ID3v2.4 frame
+func testID3Frame(version byte, id string, body []byte) []byte {
+	frame := []byte(id)
+	if version == 4 {
+		frame = append(frame, syncsafeBytes(len(body))...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	}
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+// testChapFrame builds a CHAP frame with a UTF-8 title
+func testChapFrame(version byte, id string, startMs, endMs uint32, title string) []byte {
+	body := append([]byte(id), 0)
+	body = binary.BigEndian.AppendUint32(body, startMs)
+	body = binary.BigEndian.AppendUint32(body, endMs)
+	body = append(body, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	if title != "" {
+		body = append(body, testID3Frame(version, "TIT2", append([]byte{3}, title...))...)
+	}
+	return testID3Frame(version, "CHAP", body)
+}
+
+// testCtocFrame builds a CTOC frame listing its children
+func testCtocFrame(version byte, id string, topLevel bool, children ...string) []byte {
+	body := append([]byte(id), 0)
+	flags := byte(0x01)
+	if topLevel {
+		flags |= ctocFlagTopLevel
+	}
+	body = append(body, flags, byte(len(children)))
+	for _, child := range children {
+		body = append(append(body, child...), 0)
+	}
+	return testID3Frame(version, "CTOC", body)
+}
+
+// testID3Tag wraps frames in an ID3v2 tag with some padding and audio after it
+func testID3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 32)...)
+	tag := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafeBytes(len(body))...)
+	tag = append(tag, body...)
+	return append(tag, 0xff, 0xfb, 0x90, 0x00)
+}
+
+func (suite *ID3ChaptersTestSuite) TestParseID3ChaptersNestedToc() {
+	// the table of contents orders the chapters, not the frame order
+	data := testID3Tag(4,
+		testCtocFrame(4, "toc", true, "ch0", "part2"),
+		testCtocFrame(4, "part2", false, "ch1", "ch2"),
+		testChapFrame(4, "ch2", 90000, 150000, "Book Three"),
+		testChapFrame(4, "ch0", 0, 30000, "Book One"),
+		testChapFrame(4, "ch1", 30000, 90000, "Book Two — Of Ends"),
+	)
+
+	chapters, err := ParseID3Chapters(bytes.NewReader(data))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(chapters))
+	assert.Equal(suite.T(), "Book One", chapters[0].Title)
+	assert.Equal(suite.T(), "Book Two — Of Ends", chapters[1].Title)
+	assert.Equal(suite.T(), "Book Three", chapters[2].Title)
+	assert.Equal(suite.T(), int64(30000), chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(90000), chapters[1].EndMs)
+	assert.Equal(suite.T(), int64(60000), chapters[1].LengthMs)
+	assert.Equal(suite.T(), 2, chapters[2].Number)
+}
+
+func (suite *ID3ChaptersTestSuite) TestParseID3ChaptersV23() {
+	// UTF-16 titles with a byte order mark, no table of contents, and a missing end time
+	utf16Title := []byte{1, 0xff, 0xfe, 'P', 0, 'r', 0, 'o', 0, 'l', 0, 'o', 0, 'g', 0, 'u', 0, 'e', 0}
+	chap := append([]byte("intro"), 0)
+	chap = binary.BigEndian.AppendUint32(chap, 0)
+	chap = binary.BigEndian.AppendUint32(chap, 0)
+	chap = append(chap, make([]byte, 8)...)
+	chap = append(chap, testID3Frame(3, "TIT2", utf16Title)...)
+
+	data := testID3Tag(3,
+		testID3Frame(3, "TIT2", append([]byte{0}, "On War"...)),
+		testChapFrame(3, "ch2", 60000, 120000, ""),
+		testID3Frame(3, "CHAP", chap),
+		testChapFrame(3, "ch1", 15000, 60000, "Chapter 1"),
+	)
+
+	chapters, err := ParseID3Chapters(bytes.NewReader(data))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(chapters))
+	assert.Equal(suite.T(), "Prologue", chapters[0].Title)
+	assert.Equal(suite.T(), int64(15000), chapters[0].EndMs)
+	assert.Equal(suite.T(), "Chapter 1", chapters[1].Title)
+	// untitled chapters are left for the chapter title template
+	assert.Equal(suite.T(), "", chapters[2].Title)
+	assert.Equal(suite.T(), int64(60000), chapters[2].LengthMs)
+}
+
+func (suite *ID3ChaptersTestSuite) TestParseID3ChaptersWithoutChapters() {
+	// no ID3 tag
+	chapters, err := ParseID3Chapters(bytes.NewReader([]byte{0xff, 0xfb, 0x90, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}))
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), chapters)
+
+	// tag without chapters
+	chapters, err = ParseID3Chapters(bytes.NewReader(testID3Tag(4, testID3Frame(4, "TIT2", append([]byte{3}, "On War"...)))))
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), chapters)
+
+	// truncated tag
+	data := testID3Tag(4, testChapFrame(4, "ch0", 0, 1000, "Book One"))
+	_, err = ParseID3Chapters(bytes.NewReader(data[:20]))
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ID3ChaptersTestSuite) TestReadID3Chapters() {
+	filename := filepath.Join(UtScratchDirectory, "chapters.mp3")
+	err := os.WriteFile(filename, testID3Tag(4, testChapFrame(4, "ch0", 0, 1000, "Book One")), 0644)
+	assert.Nil(suite.T(), err)
+
+	chapters, err := ReadID3Chapters(filename)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(chapters))
+
+	chapters, err = readSourceChapters(context.Background(), filename)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "Book One", chapters[0].Title)
+
+	_, err = ReadID3Chapters(filepath.Join(UtScratchDirectory, "missing.mp3"))
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *ID3ChaptersTestSuite) TestRemoveUnsynchronisation() {
+	assert.Equal(suite.T(), []byte{0xff, 0xe0, 0xff, 0x00, 0x01}, removeUnsynchronisation([]byte{0xff, 0x00, 0xe0, 0xff, 0x00, 0x00, 0x01}))
+	assert.Equal(suite.T(), 0x0fffffff, syncsafeInt([]byte{0x7f, 0x7f, 0x7f, 0x7f}))
+}
@@ -0,0 +1,193 @@
+package audiobooker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// id3MaxTocEntries most entries a single CTOC frame can list
+	id3MaxTocEntries = 255
+	// id3MaxSize largest tag size a syncsafe integer can hold
+	id3MaxSize = 1<<28 - 1
+	// id3PictureFrontCover APIC picture type of a front cover
+	id3PictureFrontCover = 3
+	// id3TocID element ID of the top level table of contents
+	id3TocID = "toc"
+)
+
+// ID3Tag renders an ID3v2.4 tag holding the metadata and chapters of the book, and the cover image if given
+func (b *Book) ID3Tag(coverImage *string) ([]byte, error) {
+	// generate SortSlug if present
+	b.generateSortSlug()
+
+	var frames bytes.Buffer
+	frames.Write(id3TextFrame("TIT2", b.Title))
+	frames.Write(id3TextFrame("TALB", b.Title))
+	frames.Write(id3TextFrame("TPE1", b.Author))
+	if b.Narrator != nil {
+		frames.Write(id3TextFrame("TCOM", *b.Narrator))
+	}
+	genre := "Audiobooks"
+	if b.Genre != nil {
+		genre = *b.Genre
+	}
+	frames.Write(id3TextFrame("TCON", genre))
+	if b.Date != nil {
+		frames.Write(id3TextFrame("TDRC", *b.Date))
+	}
+	if b.SortSlug != nil {
+		frames.Write(id3TextFrame("TSOA", *b.SortSlug))
+		frames.Write(id3TextFrame("TSOT", *b.SortSlug))
+	}
+	if b.Description != nil {
+		frames.Write(id3CommentFrame(unescapeDescription(*b.Description)))
+	}
+
+	if coverImage != nil {
+		picture, err := id3PictureFrame(*coverImage)
+		if err != nil {
+			return nil, err
+		}
+		frames.Write(picture)
+	}
+
+	for _, frame := range id3ChapterFrames(b.Chapters) {
+		frames.Write(frame)
+	}
+
+	if frames.Len() > id3MaxSize {
+		return nil, fmt.Errorf("ID3 tag of %d bytes is too large", frames.Len())
+	}
+
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0}, syncsafeBytes(frames.Len())...)
+	return append(tag, frames.Bytes()...), nil
+}
+
+// WriteID3Tag writes the ID3 tag of the book followed by the audio of an untagged MP3 file to filename
+func (b *Book) WriteID3Tag(audioFile, filename string, coverImage *string) error {
+	tag, err := b.ID3Tag(coverImage)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(audioFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := out.Write(tag); err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// id3ChapterFrames renders a CHAP frame for each chapter, and the CTOC frames listing them in order, nesting tables of contents when there are too many chapters for one
+func id3ChapterFrames(chapters []*Chapter) [][]byte {
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	frames := make([][]byte, 0)
+	chapterIDs := make([]string, len(chapters))
+	chapterFrames := make([][]byte, len(chapters))
+	for idx, chapter := range chapters {
+		chapterIDs[idx] = fmt.Sprintf("chp%d", idx)
+		body := append([]byte(chapterIDs[idx]), 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(chapter.StartMs))
+		body = binary.BigEndian.AppendUint32(body, uint32(chapter.EndMs))
+		// byte offsets aren't used
+		body = append(body, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		body = append(body, id3TextFrame("TIT2", chapter.Title)...)
+		chapterFrames[idx] = renderID3Frame("CHAP", body)
+	}
+
+	if len(chapterIDs) <= id3MaxTocEntries {
+		frames = append(frames, id3TocFrame(id3TocID, true, chapterIDs))
+	} else {
+		// the top level table of contents lists nested ones of up to 255 chapters each
+		tocIDs := make([]string, 0)
+		nested := make([][]byte, 0)
+		for start := 0; start < len(chapterIDs); start += id3MaxTocEntries {
+			end := min(start+id3MaxTocEntries, len(chapterIDs))
+			tocID := fmt.Sprintf("%s%d", id3TocID, len(tocIDs)+1)
+			tocIDs = append(tocIDs, tocID)
+			nested = append(nested, id3TocFrame(tocID, false, chapterIDs[start:end]))
+		}
+		frames = append(frames, id3TocFrame(id3TocID, true, tocIDs))
+		frames = append(frames, nested...)
+	}
+
+	return append(frames, chapterFrames...)
+}
+
+// id3TocFrame renders an ordered CTOC frame listing the child element IDs
+func id3TocFrame(id string, topLevel bool, children []string) []byte {
+	body := append([]byte(id), 0)
+	// the entries are always ordered
+	flags := byte(0x01)
+	if topLevel {
+		flags |= ctocFlagTopLevel
+	}
+	body = append(body, flags, byte(len(children)))
+	for _, child := range children {
+		body = append(append(body, child...), 0)
+	}
+	return renderID3Frame("CTOC", body)
+}
+
+// id3TextFrame renders a UTF-8 text frame
+func id3TextFrame(id, text string) []byte {
+	return renderID3Frame(id, append([]byte{3}, text...))
+}
+
+// id3CommentFrame renders a UTF-8 COMM frame without a description
+func id3CommentFrame(text string) []byte {
+	body := []byte{3, 'e', 'n', 'g', 0}
+	return renderID3Frame("COMM", append(body, text...))
+}
+
+// id3PictureFrame renders an APIC frame holding an image file as the front cover
+func id3PictureFrame(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := "image/jpeg"
+	if strings.EqualFold(filepath.Ext(filename), ".png") {
+		mimeType = "image/png"
+	}
+
+	body := append([]byte{0}, mimeType...)
+	body = append(body, 0, id3PictureFrontCover, 0)
+	return renderID3Frame("APIC", append(body, data...)), nil
+}
+
+// renderID3Frame renders an ID3v2.4 frame
+func renderID3Frame(id string, body []byte) []byte {
+	frame := append([]byte(id), syncsafeBytes(len(body))...)
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+// syncsafeBytes encodes a 4 byte ID3 syncsafe integer, which uses 7 bits per byte
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
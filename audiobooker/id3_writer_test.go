@@ -0,0 +1,96 @@
+package audiobooker
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dhowden/tag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+)
+
+type ID3WriterTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ID3WriterTestSuite) TestID3TagChapters() {
+	b := Book{
+		Author: "Carl von Clausewitz",
+		Title:  "On War",
+		Chapters: []*Chapter{
+			{StartMs: 0, EndMs: 30000, LengthMs: 30000, Title: "Book One"},
+			{StartMs: 30000, EndMs: 95500, LengthMs: 65500, Title: "Book Two — Of Ends"},
+		},
+	}
+
+	data, err := b.ID3Tag(nil)
+	assert.Nil(suite.T(), err)
+	chapters, err := ParseID3Chapters(bytes.NewReader(data))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, len(chapters))
+	assert.Equal(suite.T(), "Book Two — Of Ends", chapters[1].Title)
+	assert.Equal(suite.T(), int64(30000), chapters[1].StartMs)
+	assert.Equal(suite.T(), int64(95500), chapters[1].EndMs)
+
+	// more chapters than a table of contents can list are split into nested ones
+	b.Chapters = make([]*Chapter, 300)
+	for idx := range b.Chapters {
+		b.Chapters[idx] = &Chapter{StartMs: int64(idx) * 1000, EndMs: int64(idx+1) * 1000, Title: fmt.Sprintf("Chapter %d", idx+1)}
+	}
+	data, err = b.ID3Tag(nil)
+	assert.Nil(suite.T(), err)
+	chapters, err = ParseID3Chapters(bytes.NewReader(data))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 300, len(chapters))
+	assert.Equal(suite.T(), "Chapter 256", chapters[255].Title)
+	assert.Equal(suite.T(), int64(299000), chapters[299].StartMs)
+}
+
+func (suite *ID3WriterTestSuite) TestWriteID3Tag() {
+	audioFile := filepath.Join(UtScratchDirectory, "untagged.mp3")
+	err := os.WriteFile(audioFile, []byte{0xff, 0xfb, 0x90, 0x00}, 0644)
+	assert.Nil(suite.T(), err)
+	coverImage := filepath.Join(UtScratchDirectory, "cover.png")
+	err = os.WriteFile(coverImage, []byte("\x89PNG\r\n\x1a\n"), 0644)
+	assert.Nil(suite.T(), err)
+
+	narrator := "Some Narrator"
+	description := escapeDescription("A treatise on\nmilitary strategy.")
+	b := Book{
+		Author:      "Carl von Clausewitz",
+		Title:       "On War",
+		Narrator:    &narrator,
+		Description: &description,
+		Chapters:    []*Chapter{{StartMs: 0, EndMs: 1000, LengthMs: 1000, Title: "Book One"}},
+	}
+
+	filename := filepath.Join(UtScratchDirectory, "tagged.mp3")
+	err = b.WriteID3Tag(audioFile, filename, &coverImage)
+	assert.Nil(suite.T(), err)
+
+	f, err := os.Open(filename)
+	assert.Nil(suite.T(), err)
+	defer f.Close()
+	metadata, err := tag.ReadFrom(f)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), tag.ID3v2_4, metadata.Format())
+	assert.Equal(suite.T(), "On War", metadata.Title())
+	assert.Equal(suite.T(), "On War", metadata.Album())
+	assert.Equal(suite.T(), "Carl von Clausewitz", metadata.Artist())
+	assert.Equal(suite.T(), "Some Narrator", metadata.Composer())
+	assert.Equal(suite.T(), "Audiobooks", metadata.Genre())
+	assert.Equal(suite.T(), "A treatise on\nmilitary strategy.", metadata.Comment())
+	assert.NotNil(suite.T(), metadata.Picture())
+	assert.Equal(suite.T(), "image/png", metadata.Picture().MIMEType)
+
+	// the audio follows the tag untouched
+	data, err := os.ReadFile(filename)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []byte{0xff, 0xfb, 0x90, 0x00}, data[len(data)-4:])
+
+	// missing cover image
+	missing := filepath.Join(UtScratchDirectory, "missing.jpg")
+	err = b.WriteID3Tag(audioFile, filename, &missing)
+	assert.NotNil(suite.T(), err)
+}
@@ -0,0 +1,154 @@
+package audiobooker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// loudnessTruePeakLimit highest true peak, in dBTP, the loudness correction may raise the audio to
+	loudnessTruePeakLimit = -1.5
+	// loudnessMinTarget quietest integrated loudness target loudnorm accepts
+	loudnessMinTarget = -70
+	// loudnessMaxTarget loudest integrated loudness target loudnorm accepts
+	loudnessMaxTarget = -5
+)
+
+// LoudnessMeasurement integrated loudness, true peak, and loudness range measured for a book, and the linear correction applied to reach the target
+type LoudnessMeasurement struct {
+	// Integrated integrated loudness in LUFS
+	Integrated float64
+	// TruePeak true peak in dBTP
+	TruePeak float64
+	// LRA loudness range in LU
+	LRA float64
+	// Target integrated loudness target in LUFS
+	Target float64
+	// Gain correction applied in dB
+	Gain float64
+	// PeakLimited the gain was lowered to keep the true peak under the limit
+	PeakLimited bool
+}
+
+// loudnormStats values printed by the loudnorm filter with print_format=json
+type loudnormStats struct {
+	InputI   string `json:"input_i"`
+	InputTP  string `json:"input_tp"`
+	InputLRA string `json:"input_lra"`
+}
+
+// CheckLoudnessTarget returns an error if the loudness target is outside the range loudnorm accepts
+func CheckLoudnessTarget(target float64) error {
+	if target < loudnessMinTarget || target > loudnessMaxTarget {
+		return fmt.Errorf("loudness target %g LUFS must be between %d and %d", target, loudnessMinTarget, loudnessMaxTarget)
+	}
+	return nil
+}
+
+// MeasureLoudness measures the loudness of all the source files of the book together in a first pass, and works out the gain to reach the loudness target, returns nil if no target is set
+func MeasureLoudness(ctx context.Context, config Config) (*LoudnessMeasurement, error) {
+	if config.LoudnessTarget == 0 {
+		return nil, nil
+	}
+	if err := CheckLoudnessTarget(config.LoudnessTarget); err != nil {
+		return nil, err
+	}
+	if len(config.sourceFiles) == 0 {
+		return nil, errors.New("no source files to measure the loudness of")
+	}
+
+	// the concat filter resamples the sources to a common format, so mixed sources are measured as one book
+	args := []string{"-hide_banner", "-nostats"}
+	inputs := ""
+	for idx, sourceFile := range config.sourceFiles {
+		args = append(args, "-i", sourceFile)
+		inputs += fmt.Sprintf("[%d:a:0]", idx)
+	}
+	filter := fmt.Sprintf("%sconcat=n=%d:v=0:a=1,loudnorm=I=%g:TP=%g:print_format=json", inputs, len(config.sourceFiles), config.LoudnessTarget, loudnessTruePeakLimit)
+	args = append(args, "-filter_complex", filter, "-f", "null", "-")
+
+	log.Infoln("Measuring the loudness of the book, this may take a minute.")
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	measurement, err := parseLoudnormOutput(string(output))
+	if err != nil {
+		return nil, err
+	}
+	measurement.applyTarget(config.LoudnessTarget)
+	log.Debugf("measured %+v", *measurement)
+
+	return measurement, nil
+}
+
+// parseLoudnormOutput parses the measured values from the JSON the loudnorm filter prints at the end of its output
+func parseLoudnormOutput(output string) (*LoudnessMeasurement, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no loudnorm measurement found in ffmpeg output")
+	}
+
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return nil, err
+	}
+
+	measurement := LoudnessMeasurement{}
+	var err error
+	// silence measures as -inf, which ParseFloat handles
+	if measurement.Integrated, err = strconv.ParseFloat(stats.InputI, 64); err != nil {
+		return nil, err
+	}
+	if measurement.TruePeak, err = strconv.ParseFloat(stats.InputTP, 64); err != nil {
+		return nil, err
+	}
+	if measurement.LRA, err = strconv.ParseFloat(stats.InputLRA, 64); err != nil {
+		return nil, err
+	}
+
+	return &measurement, nil
+}
+
+// applyTarget works out the linear gain that brings the integrated loudness to the target, lowered if it would push the true peak over the limit
+func (m *LoudnessMeasurement) applyTarget(target float64) {
+	m.Target = target
+	m.Gain = 0
+	m.PeakLimited = false
+	if math.IsInf(m.Integrated, 0) || math.IsNaN(m.Integrated) {
+		log.Warnln("the book measured as silent, skipping loudness correction")
+		return
+	}
+
+	m.Gain = target - m.Integrated
+	if !math.IsInf(m.TruePeak, 0) && m.TruePeak+m.Gain > loudnessTruePeakLimit {
+		m.Gain = loudnessTruePeakLimit - m.TruePeak
+		m.PeakLimited = true
+	}
+	// round to what the volume filter is given
+	m.Gain = math.Round(m.Gain*100) / 100
+}
+
+// volumeFilter returns the ffmpeg volume filter applying the gain
+func (m *LoudnessMeasurement) volumeFilter() string {
+	return fmt.Sprintf("volume=%.2fdB", m.Gain)
+}
+
+// String describes the measurement and the applied correction
+func (m *LoudnessMeasurement) String() string {
+	description := fmt.Sprintf("integrated %.1f LUFS, true peak %.1f dBTP, range %.1f LU, target %.1f LUFS, gain %+.2f dB", m.Integrated, m.TruePeak, m.LRA, m.Target, m.Gain)
+	if m.PeakLimited {
+		description += fmt.Sprintf(" (limited to keep the true peak under %.1f dBTP)", loudnessTruePeakLimit)
+	}
+	return description
+}
@@ -0,0 +1,109 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// testLoudnormOutput trimmed ffmpeg output of a loudnorm measurement pass
+const testLoudnormOutput = `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from '01.m4a':
+  Duration: 00:42:10.12, start: 0.000000, bitrate: 64 kb/s
+[Parsed_loudnorm_1 @ 0x55d5c8e0a2c0] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-18.06",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.20",
+	"output_thresh" : "-29.58",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.06"
+}
+`
+
+type LoudnessTestSuite struct {
+	suite.Suite
+}
+
+func (suite *LoudnessTestSuite) TestParseLoudnormOutput() {
+	measurement, err := parseLoudnormOutput(testLoudnormOutput)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), -27.61, measurement.Integrated)
+	assert.Equal(suite.T(), -4.47, measurement.TruePeak)
+	assert.Equal(suite.T(), 18.06, measurement.LRA)
+
+	_, err = parseLoudnormOutput("Input #0, mov,mp4,m4a,3gp,3g2,mj2, from '01.m4a':")
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *LoudnessTestSuite) TestApplyTarget() {
+	// quiet book, raised until the true peak hits the limit
+	measurement := LoudnessMeasurement{Integrated: -27.61, TruePeak: -4.47, LRA: 18.06}
+	measurement.applyTarget(-18)
+	assert.Equal(suite.T(), 2.97, measurement.Gain)
+	assert.True(suite.T(), measurement.PeakLimited)
+	assert.Equal(suite.T(), "volume=2.97dB", measurement.volumeFilter())
+	assert.Equal(suite.T(), "integrated -27.6 LUFS, true peak -4.5 dBTP, range 18.1 LU, target -18.0 LUFS, gain +2.97 dB (limited to keep the true peak under -1.5 dBTP)", measurement.String())
+
+	// loud book, lowered to the target
+	measurement = LoudnessMeasurement{Integrated: -12.3, TruePeak: 0.4, LRA: 6}
+	measurement.applyTarget(-18)
+	assert.Equal(suite.T(), -5.7, measurement.Gain)
+	assert.False(suite.T(), measurement.PeakLimited)
+
+	// silence isn't corrected
+	measurement = LoudnessMeasurement{Integrated: math.Inf(-1), TruePeak: math.Inf(-1)}
+	measurement.applyTarget(-18)
+	assert.Equal(suite.T(), float64(0), measurement.Gain)
+}
+
+func (suite *LoudnessTestSuite) TestCheckLoudnessTarget() {
+	assert.Nil(suite.T(), CheckLoudnessTarget(-18))
+	assert.NotNil(suite.T(), CheckLoudnessTarget(-4))
+	assert.NotNil(suite.T(), CheckLoudnessTarget(-71))
+}
+
+func (suite *LoudnessTestSuite) TestPlanTranscodeWithLoudness() {
+	sourceFiles := []string{"01.m4a", "02.mp3"}
+	streams := []*ffprobe.Stream{
+		{CodecName: "aac", Profile: "LC", SampleRate: "44100", Channels: 2},
+		{CodecName: "mp3", SampleRate: "44100", Channels: 2},
+	}
+
+	// files that would be stream copied are re-encoded to apply the gain
+	plans := planTranscode(defaultEncodingProfile, sourceFiles, streams, &LoudnessMeasurement{Gain: -5.7})
+	for _, plan := range plans {
+		assert.False(suite.T(), plan.Copy)
+		assert.Equal(suite.T(), "loudness correction of -5.70 dB", plan.Reason)
+		assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "aac", "ar": 44100, "ac": 2, "af": "volume=-5.70dB"}, plan.args)
+	}
+
+	// a book already at the target needs no correction
+	plans = planTranscode(defaultEncodingProfile, sourceFiles, streams, &LoudnessMeasurement{Gain: 0})
+	assert.True(suite.T(), plans[0].Copy)
+}
+
+func (suite *LoudnessTestSuite) TestBindCorrectedSingleSource() {
+	sourceDir := suite.T().TempDir()
+	sourceFile := filepath.Join(sourceDir, "book.mp3")
+	err := os.WriteFile(sourceFile, []byte("mp3"), 0644)
+	assert.Nil(suite.T(), err)
+
+	// the volume correction is only in the transcoded audio, so a single source file is bound from it rather than the source
+	config := Config{
+		LoudnessTarget:    -18,
+		SourceFilesPath:   sourceDir,
+		preOutputFilePath: filepath.Join(sourceDir, "out.m4b"),
+		sourceFiles:       []string{sourceFile},
+	}
+	inputFile, err := bindInputFile(config)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), config.preOutputFilePath, inputFile)
+}
@@ -82,11 +82,29 @@ func TestSuite(t *testing.T) {
 
 	setTestMacros()
 
+	suite.Run(t, new(BatchReportTestSuite))
+	suite.Run(t, new(BatchStateTestSuite))
 	suite.Run(t, new(BookTestSuite))
 	suite.Run(t, new(ChapterSuite))
+	suite.Run(t, new(ChapterExportTestSuite))
+	suite.Run(t, new(ChapterImportTestSuite))
+	suite.Run(t, new(ChapterProcessingTestSuite))
+	suite.Run(t, new(ChapterTitleTestSuite))
 	suite.Run(t, new(ConfigTestSuite))
+	suite.Run(t, new(CueTestSuite))
+	suite.Run(t, new(EncodingProfileTestSuite))
+	suite.Run(t, new(EpubTestSuite))
+	suite.Run(t, new(ID3ChaptersTestSuite))
+	suite.Run(t, new(ID3WriterTestSuite))
+	suite.Run(t, new(LoudnessTestSuite))
 	suite.Run(t, new(PathPatternTestSuite))
+	suite.Run(t, new(ProgressTestSuite))
+	suite.Run(t, new(StreamCheckTestSuite))
 	suite.Run(t, new(TrackTestSuite))
 	suite.Run(t, new(TranscodeTestSuite))
+	suite.Run(t, new(TranscodeCacheTestSuite))
+	suite.Run(t, new(TranscodeErrorsTestSuite))
+	suite.Run(t, new(TranscodePlanTestSuite))
+	suite.Run(t, new(VorbisCommentsTestSuite))
 	suite.Run(t, new(SilenceDetectionTestSuite))
 }
@@ -155,10 +155,10 @@ func OutputPathPattern(book Book, pathPattern string) (string, error) {
 	return outputPath, nil
 }
 
-// OutputFilePattern renders filename based on path pattern and Book data
-func OutputFilePattern(book Book, pathPattern string) string {
+// OutputFilePattern renders filename based on path pattern and Book data, ending with the extension of the output format
+func OutputFilePattern(book Book, pathPattern, extension string) string {
 	if pathPattern == "" {
-		return fmt.Sprintf("%s - %s.m4b", book.Author, book.Title)
+		return fmt.Sprintf("%s - %s%s", book.Author, book.Title, extension)
 	}
 
 	pathPattern = strings.ReplaceAll(pathPattern, Author, book.Author)
@@ -179,5 +179,5 @@ func OutputFilePattern(book Book, pathPattern string) string {
 	}
 	pathPattern = strings.ReplaceAll(pathPattern, Title, book.Title)
 
-	return fmt.Sprintf("%s.m4b", pathPattern)
+	return pathPattern + extension
 }
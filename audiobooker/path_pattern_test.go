@@ -149,20 +149,24 @@ func (suite *PathPatternTestSuite) TestOutputFilePattern() {
 
 	// just the title
 	pattern1 := "%t"
-	out1 := OutputFilePattern(b1, pattern1)
+	out1 := OutputFilePattern(b1, pattern1, M4b)
 	assert.Equal(suite.T(), "Some Title.m4b", out1)
 
 	// author name, space, title
 	pattern2 := "%a %t"
-	out2 := OutputFilePattern(b1, pattern2)
+	out2 := OutputFilePattern(b1, pattern2, M4b)
 	assert.Equal(suite.T(), "Some Author Some Title.m4b", out2)
 
 	// mix up patterns with characters
 	pattern3 := "%a - %s %p - %t"
-	out3 := OutputFilePattern(b1, pattern3)
+	out3 := OutputFilePattern(b1, pattern3, M4b)
 	assert.Equal(suite.T(), "Some Author - Some Series 3 - Some Title.m4b", out3)
 
 	// default title for no pattern
-	out4 := OutputFilePattern(b1, "")
+	out4 := OutputFilePattern(b1, "", M4b)
 	assert.Equal(suite.T(), "Some Author - Some Title.m4b", out4)
+
+	// extension of the output format
+	out5 := OutputFilePattern(b1, pattern1, Mp3)
+	assert.Equal(suite.T(), "Some Title.mp3", out5)
 }
@@ -0,0 +1,244 @@
+package audiobooker
+
+import (
+	"bytes"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stages of a bind that report progress
+const (
+	ProgressStageTranscode = "transcode"
+	ProgressStageCombine   = "combine"
+	ProgressStageBind      = "bind"
+)
+
+// progressStages stages of a book in the order they run, each processes the audio of the whole book
+var progressStages = []string{ProgressStageTranscode, ProgressStageCombine, ProgressStageBind}
+
+// progressArgs ffmpeg arguments that write machine readable progress to stdout in place of the stats line
+var progressArgs = ffmpeg_go.KwArgs{"progress": "pipe:1", "nostats": ""}
+
+// Progress snapshot of the progress of a stage of a book
+type Progress struct {
+	// Stage stage of the bind, transcode, combine, or bind
+	Stage string
+	// File file the update came from
+	File string
+	// FileProcessed audio time of the file processed so far
+	FileProcessed time.Duration
+	// FileDuration audio duration of the file, zero if unknown
+	FileDuration time.Duration
+	// Processed audio time of the book processed so far in this stage
+	Processed time.Duration
+	// Duration audio duration of the book, zero if unknown
+	Duration time.Duration
+	// Speed audio time processed per second of wall time in this stage
+	Speed float64
+	// ETA estimated time left in this stage, zero if unknown
+	ETA time.Duration
+	// BytesWritten bytes written so far in this stage
+	BytesWritten int64
+	// Done the stage has finished
+	Done bool
+	// BookProcessed audio time processed so far across the stages of the book, skipped stages count as processed
+	BookProcessed time.Duration
+	// BookDuration audio time processed by all the stages of the book, zero if unknown
+	BookDuration time.Duration
+	// BookETA estimated time left for the book, zero if unknown
+	BookETA time.Duration
+	// BatchBook number of the book in the batch, starting at 1, zero outside of a batch run
+	BatchBook int
+	// BatchBooks number of books in the batch, zero outside of a batch run
+	BatchBooks int
+	// BatchPercent how far through the batch the run is, from 0 to 100
+	BatchPercent float64
+	// BatchETA estimated time left for the batch, zero if unknown
+	BatchETA time.Duration
+}
+
+// Percent returns how far through the stage the book is, from 0 to 100, or -1 if the duration is unknown
+func (p Progress) Percent() float64 {
+	if p.Duration <= 0 {
+		return -1
+	}
+	return min(100, float64(p.Processed)/float64(p.Duration)*100)
+}
+
+// BookPercent returns how far through all the stages the book is, from 0 to 100, or -1 if the duration is unknown
+func (p Progress) BookPercent() float64 {
+	if p.BookDuration <= 0 {
+		return -1
+	}
+	return min(100, float64(p.BookProcessed)/float64(p.BookDuration)*100)
+}
+
+// ProgressReporter receives the progress of the ffmpeg operations of a book, calls are never made concurrently
+type ProgressReporter interface {
+	ReportProgress(progress Progress)
+}
+
+// ProgressReporterFunc adapts a function to a ProgressReporter
+type ProgressReporterFunc func(progress Progress)
+
+// ReportProgress calls f
+func (f ProgressReporterFunc) ReportProgress(progress Progress) {
+	f(progress)
+}
+
+// progressTracker combines the progress of the ffmpeg processes of a stage, which may run concurrently, into the progress of the book
+type progressTracker struct {
+	mu        sync.Mutex
+	reporter  ProgressReporter
+	stage     string
+	duration  time.Duration
+	start     time.Time
+	bookStart time.Time
+	processed map[string]time.Duration
+	written   map[string]int64
+}
+
+// newProgressTracker starts tracking the progress of a stage of the book, reporting to reporter if it isn't nil, the book-wide progress is measured from bookStart, or the start of the stage if it's zero
+func newProgressTracker(reporter ProgressReporter, stage string, duration time.Duration, bookStart time.Time) *progressTracker {
+	start := time.Now()
+	if bookStart.IsZero() {
+		bookStart = start
+	}
+	return &progressTracker{
+		reporter:  reporter,
+		stage:     stage,
+		duration:  duration,
+		start:     start,
+		bookStart: bookStart,
+		processed: make(map[string]time.Duration),
+		written:   make(map[string]int64),
+	}
+}
+
+// writer returns the writer to give ffmpeg's progress output for a file
+func (t *progressTracker) writer(file string, fileDuration time.Duration) io.Writer {
+	return &progressWriter{onUpdate: func(processed time.Duration, written int64, end bool) {
+		if end && fileDuration > 0 {
+			// the last reported time may fall short of the end
+			processed = fileDuration
+		}
+		t.update(file, processed, fileDuration, written)
+	}}
+}
+
+// update records the progress of a file and reports the progress of the book
+func (t *progressTracker) update(file string, processed, fileDuration time.Duration, written int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.processed[file] = processed
+	t.written[file] = written
+	if t.reporter == nil {
+		return
+	}
+
+	progress := t.progress(false)
+	progress.File = file
+	progress.FileProcessed = processed
+	progress.FileDuration = fileDuration
+	t.reporter.ReportProgress(progress)
+}
+
+// finish reports the stage as done
+func (t *progressTracker) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.reporter == nil {
+		return
+	}
+	t.reporter.ReportProgress(t.progress(true))
+}
+
+// progress totals the progress of the files, the lock must be held
+func (t *progressTracker) progress(done bool) Progress {
+	progress := Progress{Stage: t.stage, Duration: t.duration, Done: done}
+	for file, processed := range t.processed {
+		progress.Processed += processed
+		progress.BytesWritten += t.written[file]
+	}
+	if done && t.duration > 0 {
+		progress.Processed = t.duration
+	}
+
+	elapsed := time.Since(t.start)
+	if elapsed > 0 {
+		progress.Speed = float64(progress.Processed) / float64(elapsed)
+	}
+	if !done && progress.Speed > 0 && t.duration > progress.Processed {
+		progress.ETA = time.Duration(float64(t.duration-progress.Processed) / progress.Speed).Round(time.Second)
+	}
+
+	// the earlier stages of the book have processed its audio, or were skipped
+	stageIdx := 0
+	for idx, stage := range progressStages {
+		if stage == t.stage {
+			stageIdx = idx
+		}
+	}
+	progress.BookDuration = time.Duration(len(progressStages)) * t.duration
+	progress.BookProcessed = time.Duration(stageIdx)*t.duration + progress.Processed
+	if done && stageIdx == len(progressStages)-1 {
+		progress.BookProcessed = progress.BookDuration
+	}
+	if bookElapsed := time.Since(t.bookStart); bookElapsed > 0 && progress.BookProcessed > 0 && progress.BookDuration > progress.BookProcessed {
+		bookSpeed := float64(progress.BookProcessed) / float64(bookElapsed)
+		progress.BookETA = time.Duration(float64(progress.BookDuration-progress.BookProcessed) / bookSpeed).Round(time.Second)
+	}
+	return progress
+}
+
+// progressWriter parses the key=value progress blocks ffmpeg writes with -progress
+type progressWriter struct {
+	onUpdate func(processed time.Duration, written int64, end bool)
+	partial  []byte
+	// processed out_time of the current block
+	processed time.Duration
+	// written total_size of the current block
+	written int64
+}
+
+// Write parses the complete lines written, keeping a partial line for the next write
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		idx := bytes.IndexByte(w.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		w.parseLine(strings.TrimSpace(string(w.partial[:idx])))
+		w.partial = w.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+// parseLine records a key=value line, reporting the block at its closing progress line
+func (w *progressWriter) parseLine(line string) {
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return
+	}
+
+	switch key {
+	case "out_time_us", "out_time_ms":
+		// both are in microseconds, and N/A before the first frame
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			w.processed = time.Duration(us) * time.Microsecond
+		}
+	case "total_size":
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+			w.written = size
+		}
+	case "progress":
+		w.onUpdate(w.processed, w.written, value == "end")
+	}
+}
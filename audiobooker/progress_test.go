@@ -0,0 +1,144 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"time"
+)
+
+// testProgressOutput trimmed ffmpeg -progress output of a transcode
+const testProgressOutput = `bitrate=N/A
+total_size=48
+out_time_us=N/A
+out_time_ms=N/A
+out_time=N/A
+speed=N/A
+progress=continue
+bitrate=  64.1kbits/s
+total_size=262192
+out_time_us=32712993
+out_time_ms=32712993
+out_time=00:00:32.712993
+speed=65.4x
+progress=continue
+bitrate=  64.0kbits/s
+total_size=481107
+out_time_us=60093991
+out_time_ms=60093991
+out_time=00:01:00.093991
+speed=66.1x
+progress=end
+`
+
+type ProgressTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ProgressTestSuite) TestProgressWriter() {
+	updates := make([]Progress, 0)
+	tracker := newProgressTracker(ProgressReporterFunc(func(progress Progress) {
+		updates = append(updates, progress)
+	}), ProgressStageTranscode, 2*time.Minute, time.Time{})
+	// pretend the stage has been running long enough to measure its speed
+	tracker.start = time.Now().Add(-time.Second)
+	writer := tracker.writer("01.mp3", time.Minute+time.Second)
+
+	// split the output mid line, as the pipe may
+	_, err := io.WriteString(writer, testProgressOutput[:100])
+	assert.Nil(suite.T(), err)
+	_, err = io.WriteString(writer, testProgressOutput[100:])
+	assert.Nil(suite.T(), err)
+
+	assert.Len(suite.T(), updates, 3)
+	assert.Equal(suite.T(), time.Duration(0), updates[0].Processed)
+	assert.Equal(suite.T(), int64(48), updates[0].BytesWritten)
+
+	assert.Equal(suite.T(), ProgressStageTranscode, updates[1].Stage)
+	assert.Equal(suite.T(), "01.mp3", updates[1].File)
+	assert.Equal(suite.T(), 32712993*time.Microsecond, updates[1].FileProcessed)
+	assert.Equal(suite.T(), 32712993*time.Microsecond, updates[1].Processed)
+	assert.Equal(suite.T(), 2*time.Minute, updates[1].Duration)
+	assert.Equal(suite.T(), int64(262192), updates[1].BytesWritten)
+	assert.Greater(suite.T(), updates[1].Speed, float64(0))
+	assert.Greater(suite.T(), updates[1].ETA, time.Duration(0))
+	assert.False(suite.T(), updates[1].Done)
+
+	// the end of the file counts as all of it processed
+	assert.Equal(suite.T(), time.Minute+time.Second, updates[2].FileProcessed)
+	assert.Equal(suite.T(), int64(481107), updates[2].BytesWritten)
+}
+
+func (suite *ProgressTestSuite) TestProgressTrackerTotals() {
+	var last Progress
+	tracker := newProgressTracker(ProgressReporterFunc(func(progress Progress) {
+		last = progress
+	}), ProgressStageTranscode, 4*time.Minute, time.Time{})
+
+	tracker.update("01.mp3", time.Minute, 2*time.Minute, 1000)
+	tracker.update("02.mp3", 30*time.Second, 2*time.Minute, 500)
+	assert.Equal(suite.T(), 90*time.Second, last.Processed)
+	assert.Equal(suite.T(), int64(1500), last.BytesWritten)
+	assert.InDelta(suite.T(), 37.5, last.Percent(), 0.001)
+
+	// updates replace the earlier progress of the same file
+	tracker.update("01.mp3", 2*time.Minute, 2*time.Minute, 2000)
+	assert.Equal(suite.T(), 150*time.Second, last.Processed)
+	assert.Equal(suite.T(), int64(2500), last.BytesWritten)
+
+	tracker.finish()
+	assert.True(suite.T(), last.Done)
+	assert.Equal(suite.T(), 4*time.Minute, last.Processed)
+	assert.Equal(suite.T(), time.Duration(0), last.ETA)
+	assert.Equal(suite.T(), float64(100), last.Percent())
+}
+
+func (suite *ProgressTestSuite) TestProgressUnknownDuration() {
+	var last Progress
+	tracker := newProgressTracker(ProgressReporterFunc(func(progress Progress) {
+		last = progress
+	}), ProgressStageBind, 0, time.Time{})
+
+	tracker.update("book.m4b", time.Minute, 0, 1000)
+	assert.Equal(suite.T(), float64(-1), last.Percent())
+	assert.Equal(suite.T(), time.Duration(0), last.ETA)
+
+	// a tracker without a reporter only records the progress
+	tracker = newProgressTracker(nil, ProgressStageBind, 0, time.Time{})
+	tracker.update("book.m4b", time.Minute, 0, 1000)
+	tracker.finish()
+}
+
+func (suite *ProgressTestSuite) TestProgressBookTotals() {
+	var last Progress
+	reporter := ProgressReporterFunc(func(progress Progress) {
+		last = progress
+	})
+	// pretend the book has been running long enough to measure its speed
+	bookStart := time.Now().Add(-time.Minute)
+
+	// the transcode is the first of the three stages of the book
+	tracker := newProgressTracker(reporter, ProgressStageTranscode, 4*time.Minute, bookStart)
+	tracker.update("01.mp3", 2*time.Minute, 4*time.Minute, 1000)
+	assert.Equal(suite.T(), 2*time.Minute, last.BookProcessed)
+	assert.Equal(suite.T(), 12*time.Minute, last.BookDuration)
+	assert.InDelta(suite.T(), 16.667, last.BookPercent(), 0.001)
+	assert.Greater(suite.T(), last.BookETA, last.ETA)
+
+	// the book carries on through the combine, rather than starting again
+	tracker = newProgressTracker(reporter, ProgressStageCombine, 4*time.Minute, bookStart)
+	tracker.update("book.m4a", time.Minute, 4*time.Minute, 1000)
+	assert.Equal(suite.T(), time.Minute, last.Processed)
+	assert.Equal(suite.T(), 5*time.Minute, last.BookProcessed)
+	assert.Greater(suite.T(), last.BookETA, time.Duration(0))
+
+	// finishing the bind finishes the book
+	tracker = newProgressTracker(reporter, ProgressStageBind, 4*time.Minute, bookStart)
+	tracker.finish()
+	assert.Equal(suite.T(), last.BookDuration, last.BookProcessed)
+	assert.Equal(suite.T(), float64(100), last.BookPercent())
+	assert.Equal(suite.T(), time.Duration(0), last.BookETA)
+
+	// an unknown duration has no book-wide percent
+	assert.Equal(suite.T(), float64(-1), Progress{}.BookPercent())
+}
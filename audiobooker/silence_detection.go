@@ -1,36 +1,76 @@
 package audiobooker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"math"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+const (
+	// depthStepDb decrease, in dB, of the noise floor for each depth grading pass
+	depthStepDb = 10
+	// depthSteps number of extra silence detection passes used to grade depth
+	depthSteps = 2
+)
+
 // MarkerPoint tracks the marker points for silence detection
 type MarkerPoint struct {
+	// Depth in dB below the noise floor that the silence still registers as silence
+	Depth int
 	// Duration of the silence detected
 	Duration float64
 	// End in seconds of the silence
 	End float64
 }
 
+// MarkerSelection holds a candidate MarkerPoint and whether it was picked as a chapter boundary
+type MarkerSelection struct {
+	MarkerPoint
+	// Picked the marker point is used as a chapter boundary
+	Picked bool
+	// Reason the marker point was rejected
+	Reason string
+	// Score ranking of the marker point, higher is stronger
+	Score float64
+}
+
+// SilenceOptions holds the settings used when chaptering by silence detection
+type SilenceOptions struct {
+	// MinChapterLengthMs shortest chapter allowed, marker points that would create a shorter chapter are skipped
+	MinChapterLengthMs int64
+	// Chapters target number of chapters, picks the strongest marker points when greater than 0
+	Chapters int
+	// MinSilence minimum duration, in seconds, of silence to detect
+	MinSilence float64
+	// NoiseDb noise floor, in dB, below which audio is considered silence
+	NoiseDb int
+}
+
 // ParseEnd returns the endpoint of the silence trimming off some for better playback experience
 func (p MarkerPoint) ParseEnd() float64 {
 	return p.End - (p.Duration / 2)
 }
 
+// score ranks the marker point by its duration weighted by its depth
+func (p MarkerPoint) score() float64 {
+	return p.Duration * (1 + float64(p.Depth)/depthStepDb)
+}
+
 // GenerateVolMarkers parses file for silence detection marker points
-func GenerateVolMarkers(filename string, duration float64, dbFloor int) ([]MarkerPoint, error) {
+func GenerateVolMarkers(ctx context.Context, filename string, duration float64, dbFloor int) ([]MarkerPoint, error) {
 	log.Debugln("generating silence detection marker points")
 	if dbFloor >= 0 {
 		return nil, errors.New("dbFloor MUST be less than 0")
 	}
 
-	cmd := exec.Command("ffmpeg", "-i", filename, "-af", fmt.Sprintf("silencedetect=noise=%ddB:d=%f", dbFloor, duration), "-f", "null", "-")
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", filename, "-af", fmt.Sprintf("silencedetect=noise=%ddB:d=%f", dbFloor, duration), "-f", "null", "-")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, err
@@ -63,3 +103,91 @@ func GenerateVolMarkers(filename string, duration float64, dbFloor int) ([]Marke
 	log.Debugln("marker points found:", len(markers))
 	return markers, nil
 }
+
+// GradeMarkerDepth re-runs silence detection at lower noise floors and records how deep each marker point's silence goes
+func GradeMarkerDepth(ctx context.Context, filename string, points []MarkerPoint, duration float64, dbFloor int) error {
+	log.Debugln("grading depth of silence detection marker points")
+	for step := 1; step <= depthSteps; step++ {
+		depth := step * depthStepDb
+		// deeper silences are usually shorter than the original threshold, so loosen the duration
+		deepPoints, err := GenerateVolMarkers(ctx, filename, duration/2, dbFloor-depth)
+		if err != nil {
+			return err
+		}
+
+		for idx := range points {
+			for _, deep := range deepPoints {
+				// check if the deeper silence overlaps the marker point's silence
+				if deep.End-deep.Duration < points[idx].End && deep.End > points[idx].End-points[idx].Duration {
+					points[idx].Depth = depth
+					break
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// SelectMarkers picks the strongest marker points, keeping at least minSpacing seconds between them, to create the given number of chapters
+func SelectMarkers(points []MarkerPoint, chapters int, totalSeconds, minSpacing float64) ([]MarkerSelection, error) {
+	if chapters <= 0 {
+		return nil, errors.New("chapters must be greater than 0")
+	}
+	required := chapters - 1
+
+	selections := make([]MarkerSelection, len(points))
+	for idx, point := range points {
+		selections[idx] = MarkerSelection{MarkerPoint: point, Score: point.score()}
+	}
+
+	// rank candidates strongest first, keeping the earliest point first on a tie
+	ranked := make([]*MarkerSelection, len(selections))
+	for idx := range selections {
+		ranked[idx] = &selections[idx]
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	picked := make([]*MarkerSelection, 0, required)
+	for _, candidate := range ranked {
+		mark := candidate.ParseEnd()
+		if len(picked) == required {
+			candidate.Reason = "target chapter count reached"
+			continue
+		}
+		if mark < minSpacing || totalSeconds-mark < minSpacing {
+			candidate.Reason = "too close to the start or end of the book"
+			continue
+		}
+		for _, pick := range picked {
+			if math.Abs(pick.ParseEnd()-mark) < minSpacing {
+				candidate.Reason = fmt.Sprintf("too close to the mark at %.2fs", pick.ParseEnd())
+				break
+			}
+		}
+		if candidate.Reason != "" {
+			continue
+		}
+		candidate.Picked = true
+		picked = append(picked, candidate)
+	}
+
+	if len(picked) < required {
+		return selections, fmt.Errorf("only found %d of the %d chapter marks required for %d chapters", len(picked), required, chapters)
+	}
+
+	return selections, nil
+}
+
+// PickedMarkers returns the marker points that were picked as chapter boundaries
+func PickedMarkers(selections []MarkerSelection) []MarkerPoint {
+	points := make([]MarkerPoint, 0)
+	for _, selection := range selections {
+		if selection.Picked {
+			points = append(points, selection.MarkerPoint)
+		}
+	}
+	return points
+}
@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"context"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -38,21 +39,54 @@ func (suite *SilenceDetectionTestSuite) TestGenerateVolMarkers() {
 	file := filepath.Join(TestDataRoot, "misc", "3and5-sec-silence.mp3")
 
 	// Find the 3 and 5 second silence in track
-	points1, err := GenerateVolMarkers(file, 3, -30)
+	points1, err := GenerateVolMarkers(context.Background(), file, 3, -30)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 2, len(points1))
 
 	// Find the 5 seconds silence in the track
-	points2, err := GenerateVolMarkers(file, 4.5, -30)
+	points2, err := GenerateVolMarkers(context.Background(), file, 4.5, -30)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 1, len(points2))
 
 	// Find no silence point in track
-	points3, err := GenerateVolMarkers(file, 10, -30)
+	points3, err := GenerateVolMarkers(context.Background(), file, 10, -30)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 0, len(points3))
 
 	// Error case where dbFloor is positive
-	_, err = GenerateVolMarkers(file, 10, 30)
+	_, err = GenerateVolMarkers(context.Background(), file, 10, 30)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *SilenceDetectionTestSuite) TestSelectMarkers() {
+	points := []MarkerPoint{
+		{Duration: 2, End: 62},
+		{Duration: 4, End: 124, Depth: 10},
+		{Duration: 6, End: 136},
+		{Duration: 3, End: 243},
+		{Duration: 1, End: 299},
+	}
+
+	// pick the two strongest marks that are far enough apart
+	selections, err := SelectMarkers(points, 3, 300, 30)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 5, len(selections))
+	picked := PickedMarkers(selections)
+	assert.Equal(suite.T(), 2, len(picked))
+	assert.Equal(suite.T(), float64(124), picked[0].End)
+	assert.Equal(suite.T(), float64(243), picked[1].End)
+	// rejected marks record why they were passed over
+	assert.False(suite.T(), selections[2].Picked)
+	assert.Contains(suite.T(), selections[2].Reason, "too close to the mark")
+	assert.Equal(suite.T(), "target chapter count reached", selections[0].Reason)
+
+	// not enough spaced out marks for the requested chapters
+	selections, err = SelectMarkers(points, 6, 300, 30)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(PickedMarkers(selections)))
+	assert.Equal(suite.T(), "too close to the start or end of the book", selections[4].Reason)
+
+	// invalid chapter count
+	_, err = SelectMarkers(points, 0, 300, 30)
 	assert.Error(suite.T(), err)
 }
@@ -0,0 +1,156 @@
+package audiobooker
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// streamFormat codec parameters that must match for files to be combined by stream copying
+type streamFormat struct {
+	codec      string
+	profile    string
+	sampleRate int
+	channels   int
+}
+
+// String describes the format like "aac (LC), 44100 Hz, 2 channels"
+func (f streamFormat) String() string {
+	codec := f.codec
+	if f.profile != "" {
+		codec += " (" + f.profile + ")"
+	}
+	return fmt.Sprintf("%s, %d Hz, %d channels", codec, f.sampleRate, f.channels)
+}
+
+// StreamMismatch a file whose codec parameters differ from the rest of the files being combined
+type StreamMismatch struct {
+	// File path of the file
+	File string
+	// Differences how the file differs from the common format
+	Differences []string
+}
+
+// streamFormatOf returns the format of a probed audio stream
+func streamFormatOf(stream *ffprobe.Stream) streamFormat {
+	if stream == nil {
+		return streamFormat{}
+	}
+	sampleRate, _ := strconv.Atoi(stream.SampleRate)
+	return streamFormat{codec: stream.CodecName, profile: stream.Profile, sampleRate: sampleRate, channels: stream.Channels}
+}
+
+// probeStreamFormats probes the format of the first audio stream of each file
+func probeStreamFormats(ctx context.Context, files []string) ([]streamFormat, error) {
+	formats := make([]streamFormat, len(files))
+	for idx, file := range files {
+		data, err := ffprobe.ProbeURL(ctx, file)
+		if err != nil {
+			return nil, fmt.Errorf("probing %s: %w", file, err)
+		}
+		formats[idx] = streamFormatOf(data.FirstAudioStream())
+	}
+	return formats, nil
+}
+
+// streamMismatches returns the format most of the files share, ties going to the earliest file, and the files that differ from it
+func streamMismatches(files []string, formats []streamFormat) (streamFormat, []StreamMismatch) {
+	counts := make(map[streamFormat]int)
+	var common streamFormat
+	for _, format := range formats {
+		counts[format]++
+		if counts[format] > counts[common] {
+			common = format
+		}
+	}
+
+	mismatches := make([]StreamMismatch, 0)
+	for idx, format := range formats {
+		if format == common {
+			continue
+		}
+		differences := make([]string, 0)
+		if format.codec != common.codec {
+			differences = append(differences, fmt.Sprintf("codec %s, expected %s", format.codec, common.codec))
+		}
+		if format.profile != common.profile {
+			differences = append(differences, fmt.Sprintf("profile %s, expected %s", format.profile, common.profile))
+		}
+		if format.sampleRate != common.sampleRate {
+			differences = append(differences, fmt.Sprintf("sample rate %d Hz, expected %d Hz", format.sampleRate, common.sampleRate))
+		}
+		if format.channels != common.channels {
+			differences = append(differences, fmt.Sprintf("%d channels, expected %d", format.channels, common.channels))
+		}
+		mismatches = append(mismatches, StreamMismatch{File: files[idx], Differences: differences})
+	}
+
+	return common, mismatches
+}
+
+// streamMismatchReport lists the files that differ from the common format and how
+func streamMismatchReport(common streamFormat, mismatches []StreamMismatch) string {
+	lines := []string{fmt.Sprintf("%d files differ from the common format of %s", len(mismatches), common)}
+	for _, mismatch := range mismatches {
+		lines = append(lines, fmt.Sprintf("  %s: %s", filepath.Base(mismatch.File), strings.Join(mismatch.Differences, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NormalizeTranscodedFiles makes sure the transcoded files can be combined by stream copying, re-encoding the ones that differ from the common format, and returns an error reporting the files that still differ afterwards
+func NormalizeTranscodedFiles(ctx context.Context, config Config) error {
+	formats, err := probeStreamFormats(ctx, config.transcodeFiles)
+	if err != nil {
+		return err
+	}
+	common, mismatches := streamMismatches(config.transcodeFiles, formats)
+	if len(mismatches) == 0 {
+		return nil
+	}
+	log.Warnln(streamMismatchReport(common, mismatches))
+
+	profile, err := GetEncodingProfile(config.EncodingProfile)
+	if err != nil {
+		return err
+	}
+	normalizeArgs := ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{
+		profile.ffmpegArgs(),
+		{"ar": common.sampleRate, "ac": common.channels, "vn": "", "f": "mp4"},
+	})
+
+	for _, mismatch := range mismatches {
+		log.Infoln("re-encoding to match the other files:", filepath.Base(mismatch.File))
+		normalizedFile := strings.TrimSuffix(mismatch.File, filepath.Ext(mismatch.File)) + ".normalized.m4a"
+		normalizeCmd := ffmpegInput(ctx, mismatch.File).
+			Output(normalizedFile, normalizeArgs).
+			OverWriteOutput()
+		// check if verbose output should be shown
+		if config.VerboseTranscode {
+			normalizeCmd = normalizeCmd.ErrorToStdOut()
+		}
+		if err := normalizeCmd.Run(); err != nil {
+			return fmt.Errorf("re-encoding %s: %w", mismatch.File, err)
+		}
+		if err := os.Rename(normalizedFile, mismatch.File); err != nil {
+			return err
+		}
+	}
+
+	// check the re-encoded files came out matching
+	formats, err = probeStreamFormats(ctx, config.transcodeFiles)
+	if err != nil {
+		return err
+	}
+	common, mismatches = streamMismatches(config.transcodeFiles, formats)
+	if len(mismatches) > 0 {
+		return fmt.Errorf("files can't be combined without re-encoding, %s", streamMismatchReport(common, mismatches))
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+type StreamCheckTestSuite struct {
+	suite.Suite
+}
+
+func (suite *StreamCheckTestSuite) TestStreamMismatches() {
+	stereo := streamFormat{codec: "aac", profile: "LC", sampleRate: 44100, channels: 2}
+	mono := streamFormat{codec: "aac", profile: "LC", sampleRate: 22050, channels: 1}
+	files := []string{"/tmp/out/intro.m4a", "/tmp/out/01.m4a", "/tmp/out/02.m4a", "/tmp/out/03.m4a"}
+
+	// the 22k mono chapters outnumber the stereo intro
+	common, mismatches := streamMismatches(files, []streamFormat{stereo, mono, mono, mono})
+	assert.Equal(suite.T(), mono, common)
+	assert.Equal(suite.T(), []StreamMismatch{{
+		File:        "/tmp/out/intro.m4a",
+		Differences: []string{"sample rate 44100 Hz, expected 22050 Hz", "2 channels, expected 1"},
+	}}, mismatches)
+	assert.Equal(suite.T(), "1 files differ from the common format of aac (LC), 22050 Hz, 1 channels\n  intro.m4a: sample rate 44100 Hz, expected 22050 Hz, 2 channels, expected 1", streamMismatchReport(common, mismatches))
+
+	// ties go to the earliest file
+	common, mismatches = streamMismatches(files[:2], []streamFormat{stereo, mono})
+	assert.Equal(suite.T(), stereo, common)
+	assert.Equal(suite.T(), "/tmp/out/01.m4a", mismatches[0].File)
+
+	// matching files
+	_, mismatches = streamMismatches(files, []streamFormat{stereo, stereo, stereo, stereo})
+	assert.Empty(suite.T(), mismatches)
+}
+
+func (suite *StreamCheckTestSuite) TestStreamFormatOf() {
+	format := streamFormatOf(&ffprobe.Stream{CodecName: "aac", Profile: "HE-AAC", SampleRate: "44100", Channels: 2})
+	assert.Equal(suite.T(), streamFormat{codec: "aac", profile: "HE-AAC", sampleRate: 44100, channels: 2}, format)
+	assert.Equal(suite.T(), "aac (HE-AAC), 44100 Hz, 2 channels", format.String())
+
+	// files without audio never match ones with it
+	assert.Equal(suite.T(), streamFormat{}, streamFormatOf(nil))
+}
@@ -13,14 +13,14 @@ type TrackFile struct {
 }
 
 // Parse loads the metadata from file including the file name and length
-func (t *TrackFile) Parse(filename string) error {
+func (t *TrackFile) Parse(ctx context.Context, filename string) error {
 	var err error
 	t.File, err = os.Open(filename)
 	if err != nil {
 		return err
 	}
 
-	lenMs, err := ffprobe.ProbeURL(context.Background(), t.File.Name())
+	lenMs, err := ffprobe.ProbeURL(ctx, t.File.Name())
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"context"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -30,7 +31,7 @@ func (suite *TrackTestSuite) TestParse() {
 	var err error
 	// failed file action
 	t1 := TrackFile{}
-	err = t1.Parse("no-file.txt")
+	err = t1.Parse(context.Background(), "no-file.txt")
 	assert.Error(suite.T(), err)
 
 	// failed probe action
@@ -40,12 +41,12 @@ func (suite *TrackTestSuite) TestParse() {
 		return
 	}
 	t2 := TrackFile{File: testFile}
-	err = t2.Parse(testFile.Name())
+	err = t2.Parse(context.Background(), testFile.Name())
 	assert.Error(suite.T(), err)
 
 	// successful probe action
 	t3 := TrackFile{}
-	err = t3.Parse(filepath.Join(TestDataRoot, "misc/60-min.m4a"))
+	err = t3.Parse(context.Background(), filepath.Join(TestDataRoot, "misc/60-min.m4a"))
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), int64(3600000), t3.LengthMs)
 }
@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,21 +9,36 @@ import (
 	log "github.com/sirupsen/logrus"
 	ffmpeg_go "github.com/u2takey/ffmpeg-go"
 	"gopkg.in/vansante/go-ffprobe.v2"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// ffmpegInput creates an ffmpeg input stream whose commands are killed when ctx is cancelled
+func ffmpegInput(ctx context.Context, filename string, kwargs ...ffmpeg_go.KwArgs) *ffmpeg_go.Stream {
+	input := ffmpeg_go.Input(filename, kwargs...)
+	input.Context = ctx
+	return input
+}
+
+// withProgressArgs adds the arguments that make ffmpeg write its progress to stdout
+func withProgressArgs(args ffmpeg_go.KwArgs) ffmpeg_go.KwArgs {
+	return ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{args, progressArgs})
+}
+
 // Combine transcode and combines source files into m4a file
-func Combine(config Config) error {
-	combineCmd := ffmpeg_go.Input(config.TracksFile.Name(), ffmpeg_go.KwArgs{"f": "concat", "safe": 0}).
-		//Output(config.preOutputFilePath, ffmpeg_go.KwArgs{"b:a": "64k", "acodec": "aac", "ac": 2, "vn": ""}).
-		Output(config.preOutputFilePath, ffmpeg_go.KwArgs{"codec": "copy", "vn": "", "f": "mp4"}).
-		OverWriteOutput()
+func Combine(ctx context.Context, config Config) error {
+	tracker := newProgressTracker(config.Progress, ProgressStageCombine, config.bookDuration, config.bookStart)
+	combineCmd := ffmpegInput(ctx, config.TracksFile.Name(), ffmpeg_go.KwArgs{"f": "concat", "safe": 0}).
+		Output(config.preOutputFilePath, withProgressArgs(ffmpeg_go.KwArgs{"codec": "copy", "vn": "", "f": "mp4"})).
+		OverWriteOutput().
+		WithOutput(tracker.writer(config.preOutputFilePath, config.bookDuration))
 	// check if verbose output should be shown
 	if config.VerboseTranscode {
 		combineCmd = combineCmd.ErrorToStdOut()
@@ -31,18 +47,34 @@ func Combine(config Config) error {
 	if err != nil {
 		return err
 	}
+	tracker.finish()
 
 	return nil
 }
 
-// SplitSingleFile splits single file into chunks for later transcoding
-func SplitSingleFile(config *Config) error {
+// SplitSourceFiles splits a single source file into chunks for later transcoding, multiple source files are already split into parts and transcoded as they are
+func SplitSourceFiles(ctx context.Context, config *Config) error {
+	if len(config.sourceFiles) > 1 {
+		log.Debugln("multiple source files found, skipping pre-splitting")
+		return nil
+	}
+
+	return SplitSingleFile(ctx, config)
+}
+
+// SplitSingleFile splits single file into chunks for later transcoding, the chunks are stream copied and encoded with the encoding profile when transcoded
+func SplitSingleFile(ctx context.Context, config *Config) error {
 	if len(config.sourceFiles) > 1 {
 		return errors.New("may only have one source file for pre-splitting for now")
 	}
 
 	srcFile := config.sourceFiles[0]
 
+	// fail before splitting rather than after if the profile doesn't exist
+	if _, err := GetEncodingProfile(config.EncodingProfile); err != nil {
+		return err
+	}
+
 	// get file extension for later use
 	fileExt := filepath.Ext(srcFile)
 	if fileExt == "" {
@@ -62,7 +94,7 @@ func SplitSingleFile(config *Config) error {
 	}
 	defer f.Close()
 
-	fileData, err := ffprobe.ProbeURL(context.Background(), f.Name())
+	fileData, err := ffprobe.ProbeURL(ctx, f.Name())
 	if err != nil {
 		return err
 	}
@@ -82,7 +114,7 @@ func SplitSingleFile(config *Config) error {
 
 	outFile := filepath.Join(splitDir, fmt.Sprintf("tc-part-%%03d%s", fileExt))
 
-	splitCmd := ffmpeg_go.Input(srcFile).
+	splitCmd := ffmpegInput(ctx, srcFile).
 		Output(outFile, ffmpeg_go.KwArgs{
 			"f":                "segment",
 			"segment_time":     splitLength,
@@ -111,7 +143,7 @@ func SplitSingleFile(config *Config) error {
 				return err
 			}
 			defer pFile.Close()
-			pData, err := ffprobe.ProbeURL(context.Background(), pFile.Name())
+			pData, err := ffprobe.ProbeURL(ctx, pFile.Name())
 			if err != nil {
 				return err
 			}
@@ -131,8 +163,8 @@ func SplitSingleFile(config *Config) error {
 	return nil
 }
 
-// Bind apply metadata and output m4b file
-func Bind(config Config, book Book) error {
+// Bind apply metadata and output the m4b, mp3, or opus file
+func Bind(ctx context.Context, config Config, book Book) error {
 	var err error
 	var tempOutFile *os.File
 
@@ -142,59 +174,74 @@ func Bind(config Config, book Book) error {
 		return err
 	}
 
-	if len(config.sourceFiles) == 1 {
-		//config.preOutputFilePath = config.sourceFiles[0]
-		// check if the source file is a directory or regular file, return single element if it's a directory
-		config.preOutputFilePath, err = config.CheckForSourceFile(config.SourceFilesPath)
-		if err != nil {
-			return err
-		}
+	config.preOutputFilePath, err = bindInputFile(config)
+	if err != nil {
+		return err
+	}
+
+	// Create full output path
+	if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+		return err
+	}
+
+	// books that weren't transcoded get their length from the chapters
+	duration := config.bookDuration
+	if duration == 0 && len(book.Chapters) > 0 {
+		duration = time.Duration(book.Chapters[len(book.Chapters)-1].EndMs) * time.Millisecond
+	}
+	tracker := newProgressTracker(config.Progress, ProgressStageBind, duration, config.bookStart)
+	progress := tracker.writer(filepath.Join(config.OutputPath, config.OutputFile), duration)
+
+	switch config.OutputFormat {
+	case OutputFormatMp3:
+		err = bindMp3(ctx, config, book, tempOutFile.Name(), progress)
+	case OutputFormatOpus:
+		err = bindOpus(ctx, config, book, tempOutFile.Name(), progress)
+	default:
+		err = bindM4b(ctx, config, book, tempOutFile.Name(), progress)
+	}
+	if err != nil {
+		return err
+	}
+	tracker.finish()
 
-		// Create full output path
-		if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+	// write the chapters alongside the bound book if requested
+	if len(config.ExportChapterFormats) > 0 {
+		if err := ExportBookChapters(ctx, config, book); err != nil {
+			log.Errorln("error exporting chapters")
 			return err
 		}
 	}
 
-	// run general bind operation
-	bindCmd := ffmpeg_go.Input(config.ChaptersFile.Name(), ffmpeg_go.KwArgs{"i": config.preOutputFilePath}).
-		Output(tempOutFile.Name(), ffmpeg_go.KwArgs{"map_metadata": 1, "codec": "copy", "f": "mp4"}).
-		OverWriteOutput()
+	return nil
+}
+
+// bindInputFile returns the audio file the book is bound from, the combined audio unless the source file is embedded without transcoding
+func bindInputFile(config Config) (string, error) {
+	if !config.EmbedSourceFile {
+		return config.preOutputFilePath, nil
+	}
+	// check if the source file is a directory or regular file, return single element if it's a directory
+	return config.CheckForSourceFile(config.SourceFilesPath)
+}
+
+// bindM4b applies the metadata, chapters, and cover to the combined audio as an m4b file
+func bindM4b(ctx context.Context, config Config, book Book, tempOutFile string, progress io.Writer) error {
+	// run general bind operation, taking the chapters from the metadata file rather than any embedded in the audio
+	bindCmd := ffmpegInput(ctx, config.ChaptersFile.Name(), ffmpeg_go.KwArgs{"i": config.preOutputFilePath}).
+		Output(tempOutFile, withProgressArgs(ffmpeg_go.KwArgs{"map_metadata": 1, "map_chapters": 1, "codec": "copy", "f": "mp4"})).
+		OverWriteOutput().
+		WithOutput(progress)
 	// check if verbose output should be shown
 	if config.VerboseTranscode {
 		bindCmd = bindCmd.ErrorToStdOut()
 	}
-	err = bindCmd.Run()
+	err := bindCmd.Run()
 	if err != nil {
 		log.Errorln("errored binding files:", err)
 		return err
 	}
 
-	// if configured to use external chapters, do so now
-	if config.ExternalChapters {
-		// create new temp output file
-		temp2, err := os.CreateTemp(config.scratchDir, "tempOutFile")
-		if err != nil {
-			return err
-		}
-		// map the chapters from the external chapters file
-		embedCmd := ffmpeg_go.Input(filepath.Join(config.scratchDir, "extracted-chapters.ini"), ffmpeg_go.KwArgs{"i": tempOutFile.Name()}).
-			Output(temp2.Name(), ffmpeg_go.KwArgs{"map_chapters": 1, "f": "mp4", "codec": "copy"}).
-			OverWriteOutput()
-		if config.VerboseTranscode {
-			embedCmd = embedCmd.ErrorToStdOut()
-		}
-		err = embedCmd.Run()
-		if err != nil {
-			log.Errorln("error embedding external chapters")
-			return err
-		}
-		// move the new temp file to overwrite the old one for continued processing
-		if err := os.Rename(temp2.Name(), tempOutFile.Name()); err != nil {
-			return err
-		}
-	}
-
 	// if a cover image was found, add it here
 	if config.coverImage != nil {
 		// create new temp output file
@@ -202,9 +249,9 @@ func Bind(config Config, book Book) error {
 		if err != nil {
 			return err
 		}
-		s1 := ffmpeg_go.Input(tempOutFile.Name())
-		s2 := ffmpeg_go.Input(*config.coverImage)
-		out := ffmpeg_go.Output([]*ffmpeg_go.Stream{s1, s2}, temp2.Name(), ffmpeg_go.KwArgs{"c": "copy", "disposition:v:0": "attached_pic", "f": "mp4"})
+		s1 := ffmpegInput(ctx, tempOutFile)
+		s2 := ffmpegInput(ctx, *config.coverImage)
+		out := ffmpeg_go.OutputContext(ctx, []*ffmpeg_go.Stream{s1, s2}, temp2.Name(), ffmpeg_go.KwArgs{"c": "copy", "disposition:v:0": "attached_pic", "f": "mp4"})
 		log.Debugln(out.GetArgs())
 		coverCmd := out.OverWriteOutput()
 		// check if verbose output should be shown
@@ -217,13 +264,13 @@ func Bind(config Config, book Book) error {
 			return err
 		}
 
-		if err := os.Rename(temp2.Name(), tempOutFile.Name()); err != nil {
+		if err := os.Rename(temp2.Name(), tempOutFile); err != nil {
 			return err
 		}
 	}
 
 	// copy the bound book to the output directory
-	if err := os.Rename(tempOutFile.Name(), filepath.Join(config.OutputPath, config.OutputFile)); err != nil {
+	if err := os.Rename(tempOutFile, filepath.Join(config.OutputPath, config.OutputFile)); err != nil {
 		return err
 	}
 
@@ -248,12 +295,115 @@ func Bind(config Config, book Book) error {
 	return nil
 }
 
-// TranscodeSourceFiles runs concurrent transcode of source media into mp4 audio files for combination later
-func TranscodeSourceFiles(config *Config) error {
+// bindMp3 transcodes the combined audio to an MP3 file tagged with the metadata, chapters, and cover as ID3v2.4 frames
+func bindMp3(ctx context.Context, config Config, book Book, tempOutFile string, progress io.Writer) error {
+	profile, err := GetEncodingProfile(config.EncodingProfile)
+	if err != nil {
+		return err
+	}
+
+	// write the audio without any tags, the ID3 tag is written separately
+	mp3Args := ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{profile.mp3Args(), {
+		"map":           "0:a",
+		"map_metadata":  -1,
+		"map_chapters":  -1,
+		"id3v2_version": 0,
+		"write_id3v1":   0,
+		"write_xing":    1,
+		"f":             "mp3",
+	}})
+	mp3Cmd := ffmpegInput(ctx, config.preOutputFilePath).
+		Output(tempOutFile, withProgressArgs(mp3Args)).
+		OverWriteOutput().
+		WithOutput(progress)
+	// check if verbose output should be shown
+	if config.VerboseTranscode {
+		mp3Cmd = mp3Cmd.ErrorToStdOut()
+	}
+	if err := mp3Cmd.Run(); err != nil {
+		log.Errorln("errored transcoding to mp3:", err)
+		return err
+	}
+
+	// create full output path
+	if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+		return err
+	}
+
+	if err := book.WriteID3Tag(tempOutFile, filepath.Join(config.OutputPath, config.OutputFile), config.coverImage); err != nil {
+		log.Errorln("error writing ID3 tag")
+		return err
+	}
+
+	return os.Remove(tempOutFile)
+}
+
+// bindOpus transcodes the combined audio to an Ogg Opus file tagged with the metadata, chapters, and cover as Vorbis comments
+func bindOpus(ctx context.Context, config Config, book Book, tempOutFile string, progress io.Writer) error {
+	profile, err := GetEncodingProfile(config.EncodingProfile)
+	if err != nil {
+		return err
+	}
+
+	commentsFile := filepath.Join(config.scratchDir, "opus-comments.ini")
+	if err := book.WriteVorbisCommentsFile(commentsFile, config.coverImage); err != nil {
+		log.Errorln("error writing vorbis comments")
+		return err
+	}
+
+	// the chapters are written as comments, so ffmpeg isn't left to write its own copy of them
+	opusCmd := ffmpegInput(ctx, commentsFile, ffmpeg_go.KwArgs{"i": config.preOutputFilePath}).
+		Output(tempOutFile, withProgressArgs(ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{profile.opusArgs(), {
+			"map":              "0:a",
+			"map_metadata":     1,
+			"map_metadata:s:a": "1:g",
+			"map_chapters":     -1,
+			"f":                "ogg",
+		}}))).
+		OverWriteOutput().
+		WithOutput(progress)
+	// check if verbose output should be shown
+	if config.VerboseTranscode {
+		opusCmd = opusCmd.ErrorToStdOut()
+	}
+	if err := opusCmd.Run(); err != nil {
+		log.Errorln("errored transcoding to opus:", err)
+		return err
+	}
+
+	// create full output path
+	if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tempOutFile, filepath.Join(config.OutputPath, config.OutputFile))
+}
+
+// TranscodeSourceFiles runs concurrent transcode of source media into mp4 audio files for combination later, stream copying the files that already match the encoding profile
+func TranscodeSourceFiles(ctx context.Context, config *Config) error {
 	// define conversion holder
 	type conversion struct {
 		srcFile  string
 		destFile string
+		args     ffmpeg_go.KwArgs
+		duration time.Duration
+		copy     bool
+	}
+
+	// measure the loudness of the whole book before any of it is encoded
+	loudness, err := MeasureLoudness(ctx, *config)
+	if err != nil {
+		return err
+	}
+	if loudness != nil {
+		log.Infoln("loudness:", loudness)
+	}
+	config.loudness = loudness
+
+	// decide which files need re-encoding
+	plans, err := PlanTranscode(ctx, *config, loudness)
+	if err != nil {
+		return err
 	}
 
 	// create the temporary output direction
@@ -266,6 +416,7 @@ func TranscodeSourceFiles(config *Config) error {
 	}
 
 	// Create a temporary slice for the conversions
+	config.bookDuration = 0
 	conversionFiles := make([]conversion, len(config.sourceFiles))
 	// Create a slice of the output files
 	config.transcodeFiles = make([]string, len(config.sourceFiles))
@@ -276,18 +427,33 @@ func TranscodeSourceFiles(config *Config) error {
 		newFile := strings.TrimSuffix(config.sourceFiles[idx], path.Ext(config.sourceFiles[idx]))
 		newFile += ".m4a"
 		// create conversion entry
-		conversionFiles[idx] = conversion{srcFile: config.sourceFiles[idx], destFile: path.Join(tmpDir, path.Base(newFile))}
-		// write transcode file to tracks list
-		if err := config.addToFileList(path.Join(tmpDir, path.Base(newFile))); err != nil {
-			return err
+		conversionFiles[idx] = conversion{
+			srcFile:  config.sourceFiles[idx],
+			destFile: path.Join(tmpDir, path.Base(newFile)),
+			args:     ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{plans[idx].args, {"vn": "", "f": "mp4"}}),
+			duration: plans[idx].Duration,
+			copy:     plans[idx].Copy,
+		}
+		config.bookDuration += plans[idx].Duration
+		if plans[idx].Copy {
+			log.Debugln("stream copying:", config.sourceFiles[idx])
+		} else {
+			log.Debugf("re-encoding %s: %s", config.sourceFiles[idx], plans[idx].Reason)
 		}
 		// add new path to the config struct
 		config.transcodeFiles[idx] = path.Join(tmpDir, path.Base(newFile))
 	}
 
 	var wg sync.WaitGroup
-	// track completed transcode operations
-	completedTranscode := 0
+	// track the progress of the concurrent transcode operations
+	tracker := newProgressTracker(config.Progress, ProgressStageTranscode, config.bookDuration, config.bookStart)
+
+	// collect the failures of the workers
+	var failuresMu sync.Mutex
+	failures := make([]*TranscodeError, 0)
+	// cancelled on the first failure to kill the running transcodes and stop handing out files, unless failed files are retried
+	workerCtx, cancelWorkers := context.WithCancel(ctx)
+	defer cancelWorkers()
 
 	// Create worker queue based on the number of jobs specified
 	var queue = make(chan conversion, config.Jobs-1)
@@ -305,24 +471,39 @@ func TranscodeSourceFiles(config *Config) error {
 					log.Debugln("transcoding routine completed")
 					return
 				}
+				// drain the queue without transcoding once a file has failed
+				if workerCtx.Err() != nil {
+					continue
+				}
 				log.Debugln("transcoding:", inputFile.srcFile)
-				// Transcode file
-				transcodeCmd := ffmpeg_go.Input(inputFile.srcFile).
-					Output(inputFile.destFile, ffmpeg_go.KwArgs{"c:a": "aac", "vn": "", "f": "mp4"}).
-					OverWriteOutput()
-				// check if verbose output should be shown
-				if config.VerboseTranscode {
-					transcodeCmd = transcodeCmd.ErrorToStdOut()
+				// Transcode file, reusing an earlier transcode of it when caching, stream copies are quicker to redo than to cache
+				progress := tracker.writer(inputFile.srcFile, inputFile.duration)
+				var transcodeErr *TranscodeError
+				if config.CacheDir != "" && !inputFile.copy {
+					var cached bool
+					if cached, transcodeErr = transcodeFileCached(workerCtx, *config, inputFile.srcFile, inputFile.destFile, inputFile.args, progress); cached {
+						tracker.update(inputFile.srcFile, inputFile.duration, inputFile.duration, 0)
+					}
+				} else {
+					transcodeErr = transcodeFile(workerCtx, *config, inputFile.srcFile, inputFile.destFile, inputFile.args, progress)
 				}
-				err := transcodeCmd.Run()
-				if err != nil {
+				if transcodeErr != nil {
+					// transcodes killed by the cancellation aren't failures of their own
+					if workerCtx.Err() != nil {
+						log.Debugln("cancelled converting:", inputFile.srcFile)
+						continue
+					}
 					log.Errorln("failed to convert:", inputFile.srcFile)
-					log.Errorln("Maybe I should bail?")
+					failuresMu.Lock()
+					failures = append(failures, transcodeErr)
+					failuresMu.Unlock()
+					if config.TranscodeRetries == 0 {
+						cancelWorkers()
+					}
+					continue
 				}
 
 				log.Debugln("converted to:", inputFile.destFile)
-				completedTranscode++
-				fmt.Printf("...%d%%", int((float64(completedTranscode) / float64(len(conversionFiles)) * 100)))
 			}
 		}()
 	}
@@ -331,23 +512,88 @@ func TranscodeSourceFiles(config *Config) error {
 	start := time.Now()
 	fmt.Printf("Starting the transcoding of %d files!\n", len(conversionFiles))
 
-	// loop through the files list to convert
+	// loop through the files list to convert, stopping at the first failure or cancellation
+sendFiles:
 	for _, f := range conversionFiles {
 		log.Debugln("sending:", f)
-		queue <- f
-		time.Sleep(10 * time.Millisecond)
+		select {
+		case <-workerCtx.Done():
+			break sendFiles
+		case queue <- f:
+		}
 	}
 
 	// close channel and wait for completion
 	close(queue)
 	wg.Wait()
 
-	fmt.Printf("\nFinished the transcode of all files\n")
+	// only a cancellation of the parent context was asked for by the user, the workers are also cancelled by a failure
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// never combine a partial set of files
+	if len(failures) > 0 {
+		fmt.Println()
+		sort.Slice(failures, func(i, j int) bool { return failures[i].SourceFile < failures[j].SourceFile })
+		errs := make([]error, len(failures))
+		for idx, failure := range failures {
+			errs[idx] = failure
+		}
+		return fmt.Errorf("%d of %d files failed to transcode:\n%w", len(failures), len(conversionFiles), errors.Join(errs...))
+	}
+
+	tracker.finish()
+	fmt.Printf("Finished the transcode of all files\n")
 	log.Debugln("transcoding took:", time.Now().Sub(start))
 
+	// mixed sample rates or channel counts combine without error, but play back at the wrong speed
+	if err := NormalizeTranscodedFiles(ctx, *config); err != nil {
+		return err
+	}
+
+	// write transcoded files to tracks list
+	for _, transcodeFile := range config.transcodeFiles {
+		if err := config.addToFileList(transcodeFile); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// transcodeFile runs the transcode of a single file, retrying it as many times as configured, and returns the error of the last attempt with the end of ffmpeg's output, ffmpeg's progress is written to progress if it isn't nil
+func transcodeFile(ctx context.Context, config Config, srcFile, destFile string, args ffmpeg_go.KwArgs, progress io.Writer) *TranscodeError {
+	var transcodeErr *TranscodeError
+	for attempt := 1; attempt <= config.TranscodeRetries+1; attempt++ {
+		var stderr bytes.Buffer
+		var errorOutput io.Writer = &stderr
+		// check if verbose output should be shown
+		if config.VerboseTranscode {
+			errorOutput = io.MultiWriter(os.Stdout, &stderr)
+		}
+		transcodeCmd := ffmpegInput(ctx, srcFile).
+			Output(destFile, withProgressArgs(args)).
+			OverWriteOutput().
+			WithOutput(progress, errorOutput)
+		err := transcodeCmd.Run()
+		if err == nil {
+			return nil
+		}
+
+		transcodeErr = &TranscodeError{SourceFile: srcFile, Attempts: attempt, Err: err, Stderr: stderrTail(stderr.String(), stderrTailLines)}
+		// a cancelled transcode isn't retried
+		if ctx.Err() != nil {
+			break
+		}
+		if attempt <= config.TranscodeRetries {
+			log.Warnf("failed to convert %s, retrying (%d of %d)", srcFile, attempt, config.TranscodeRetries)
+		}
+	}
+
+	return transcodeErr
+}
+
 // shouldTranscode returns a bool if transcoding is needed
 func shouldTranscode(stream *ffprobe.Stream) bool {
 	if stream.CodecName == "aac" {
@@ -357,7 +603,7 @@ func shouldTranscode(stream *ffprobe.Stream) bool {
 }
 
 // TranscodeWithMarkers generates individual output files from a single file listed in MarkerPoint slice
-func TranscodeWithMarkers(config *Config, points []MarkerPoint) error {
+func TranscodeWithMarkers(ctx context.Context, config *Config, points []MarkerPoint) error {
 	log.Debugln("transcoding using marker points")
 	if len(config.sourceFiles) > 1 {
 		return errors.New("may only have one source file for pre-splitting for now")
@@ -365,19 +611,21 @@ func TranscodeWithMarkers(config *Config, points []MarkerPoint) error {
 
 	// parse the source file
 	srcFile := config.sourceFiles[0]
-	sourceFileMeta, err := ffprobe.ProbeURL(context.Background(), srcFile)
+	sourceFileMeta, err := ffprobe.ProbeURL(ctx, srcFile)
+	if err != nil {
+		return err
+	}
+
+	profile, err := GetEncodingProfile(config.EncodingProfile)
 	if err != nil {
 		return err
 	}
 
 	// determine if codec transcoding is required
-	var audioCodec string
-	if shouldTranscode(sourceFileMeta.FirstAudioStream()) {
-		// if it does, use aac
-		audioCodec = "aac"
-	} else {
-		// if it's already aac, then just use copy
-		audioCodec = "copy"
+	audioArgs := ffmpeg_go.KwArgs{"c:a": "copy"}
+	if config.EncodingProfile != "" || shouldTranscode(sourceFileMeta.FirstAudioStream()) {
+		// if it does, or a profile was selected, encode with the profile
+		audioArgs = profile.ffmpegArgs()
 	}
 
 	// create temporary directory for splitting single files
@@ -391,12 +639,12 @@ func TranscodeWithMarkers(config *Config, points []MarkerPoint) error {
 	for idx := 0; idx < len(points); idx++ {
 		endMark := fmt.Sprintf("%f", points[idx].ParseEnd())
 		outFile := filepath.Join(splitDir, fmt.Sprintf("Track-%03d.aac", idx+1))
-		cmd := ffmpeg_go.Input(srcFile).
-			Output(outFile, ffmpeg_go.KwArgs{
-				"ss":  fmt.Sprintf("%f", startingPoint),
-				"c:a": audioCodec,
-				"to":  endMark,
-			}).OverWriteOutput().ErrorToStdOut()
+		outArgs := ffmpeg_go.MergeKwArgs([]ffmpeg_go.KwArgs{audioArgs, {
+			"ss": fmt.Sprintf("%f", startingPoint),
+			"to": endMark,
+		}})
+		cmd := ffmpegInput(ctx, srcFile).
+			Output(outFile, outArgs).OverWriteOutput().ErrorToStdOut()
 		if err := cmd.Run(); err != nil {
 			return err
 		}
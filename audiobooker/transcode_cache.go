@@ -0,0 +1,277 @@
+package audiobooker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// transcodeCacheVersion changes the key of every entry when the way files are transcoded changes
+	transcodeCacheVersion = "1"
+	// transcodeCacheExt extension of the cached transcoded files
+	transcodeCacheExt = ".m4a"
+	// transcodeCacheTempExt extension of files being written to the cache
+	transcodeCacheTempExt = ".tmp"
+	// transcodeCacheTempAge age after which a file still being written is left over from an interrupted run
+	transcodeCacheTempAge = 24 * time.Hour
+)
+
+// CacheEntry a transcoded file in the transcode cache
+type CacheEntry struct {
+	// Path path of the cached file
+	Path string
+	// Size size of the cached file in bytes
+	Size int64
+	// LastUsed when the file was cached or last reused
+	LastUsed time.Time
+}
+
+// CachePruneOptions which entries to remove from the transcode cache
+type CachePruneOptions struct {
+	// OlderThan remove entries that haven't been used for longer than this, kept regardless of age when zero
+	OlderThan time.Duration
+	// MaxSize remove the least recently used entries until the cache is no bigger than this many bytes, no limit when zero
+	MaxSize int64
+	// DryRun only return the entries that would be removed
+	DryRun bool
+}
+
+// transcodeCacheKey returns the key of a transcode, made from the content of the source file and the ffmpeg arguments encoding it
+func transcodeCacheKey(sourceFile string, args ffmpeg_go.KwArgs) (string, error) {
+	f, err := os.Open(sourceFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(hash, "\nversion=%s\n", transcodeCacheVersion)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%v\n", key, args[key])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// transcodeCachePath returns the path of a cache entry, spread across subdirectories by the start of the key
+func transcodeCachePath(cacheDir, key string) string {
+	return filepath.Join(cacheDir, key[:2], key+transcodeCacheExt)
+}
+
+// fetchCachedTranscode copies the cached transcode to destFile, returns false if there isn't one
+func fetchCachedTranscode(cacheDir, key, destFile string) (bool, error) {
+	cachedFile := transcodeCachePath(cacheDir, key)
+	if _, err := os.Stat(cachedFile); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := copyFile(cachedFile, destFile); err != nil {
+		return false, err
+	}
+	// mark the entry used, so pruning removes the least recently used entries first
+	now := time.Now()
+	if err := os.Chtimes(cachedFile, now, now); err != nil {
+		log.Debugln("error marking cache entry used:", err)
+	}
+	return true, nil
+}
+
+// storeCachedTranscode copies a transcoded file into the cache, writing it under a temporary name first so an interrupted copy is never used
+func storeCachedTranscode(cacheDir, key, transcodedFile string) error {
+	cachedFile := transcodeCachePath(cacheDir, key)
+	if err := os.MkdirAll(filepath.Dir(cachedFile), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(cachedFile), key+"-*"+transcodeCacheTempExt)
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	if err := copyFile(transcodedFile, temp.Name()); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	return os.Rename(temp.Name(), cachedFile)
+}
+
+// copyFile copies the content of src to dest, replacing dest
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// transcodeFileCached reuses the cached transcode of the file if there is one, otherwise transcodes it and caches the result, problems with the cache are logged and only skip it
+func transcodeFileCached(ctx context.Context, config Config, srcFile, destFile string, args ffmpeg_go.KwArgs, progress io.Writer) (bool, *TranscodeError) {
+	key, err := transcodeCacheKey(srcFile, args)
+	if err != nil {
+		log.Warnf("skipping the transcode cache for %s: %v", srcFile, err)
+		return false, transcodeFile(ctx, config, srcFile, destFile, args, progress)
+	}
+
+	hit, err := fetchCachedTranscode(config.CacheDir, key, destFile)
+	if err != nil {
+		log.Warnf("error reading the transcode cache for %s: %v", srcFile, err)
+	} else if hit {
+		log.Debugln("reusing cached transcode of:", srcFile)
+		return true, nil
+	}
+
+	if transcodeErr := transcodeFile(ctx, config, srcFile, destFile, args, progress); transcodeErr != nil {
+		return false, transcodeErr
+	}
+	if err := storeCachedTranscode(config.CacheDir, key, destFile); err != nil {
+		log.Warnf("error caching the transcode of %s: %v", srcFile, err)
+	}
+
+	return false, nil
+}
+
+// ListCache returns the entries of the transcode cache, least recently used first
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	entries := make([]CacheEntry, 0)
+	// nothing has been cached yet
+	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+		return entries, nil
+	}
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != transcodeCacheExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, CacheEntry{Path: path, Size: info.Size(), LastUsed: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.Before(entries[j].LastUsed) })
+	return entries, nil
+}
+
+// CacheSize returns the number of entries in the transcode cache and their total size in bytes
+func CacheSize(cacheDir string) (int, int64, error) {
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	return len(entries), size, nil
+}
+
+// PruneCache removes the entries of the transcode cache selected by the options, and files left over from interrupted runs, returns the removed entries
+func PruneCache(cacheDir string, options CachePruneOptions) ([]CacheEntry, error) {
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	pruned := selectCachePrune(entries, options, time.Now())
+	if options.DryRun {
+		return pruned, nil
+	}
+
+	for _, entry := range pruned {
+		if err := os.Remove(entry.Path); err != nil {
+			return nil, err
+		}
+	}
+	if err := removeStaleCacheFiles(cacheDir); err != nil {
+		return nil, err
+	}
+
+	return pruned, nil
+}
+
+// selectCachePrune returns the entries, sorted least recently used first, to remove to satisfy the options
+func selectCachePrune(entries []CacheEntry, options CachePruneOptions, now time.Time) []CacheEntry {
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	pruned := make([]CacheEntry, 0)
+	for _, entry := range entries {
+		expired := options.OlderThan > 0 && now.Sub(entry.LastUsed) > options.OlderThan
+		oversized := options.MaxSize > 0 && size > options.MaxSize
+		if !expired && !oversized {
+			// the rest of the entries are more recently used
+			break
+		}
+		pruned = append(pruned, entry)
+		size -= entry.Size
+	}
+
+	return pruned
+}
+
+// removeStaleCacheFiles removes files interrupted runs left partly written to the cache
+func removeStaleCacheFiles(cacheDir string) error {
+	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, transcodeCacheTempExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) > transcodeCacheTempAge {
+			log.Debugln("removing stale cache file:", path)
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
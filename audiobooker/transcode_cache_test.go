@@ -0,0 +1,121 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type TranscodeCacheTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TranscodeCacheTestSuite) TestTranscodeCacheKey() {
+	sourceFile := filepath.Join(UtScratchDirectory, "cache-source.mp3")
+	assert.Nil(suite.T(), os.WriteFile(sourceFile, []byte("some audio"), 0644))
+	args := ffmpeg_go.KwArgs{"c:a": "aac", "b:a": "48k", "vn": "", "f": "mp4"}
+
+	key, err := transcodeCacheKey(sourceFile, args)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), key, 64)
+
+	// the same content and settings always make the same key
+	sameKey, err := transcodeCacheKey(sourceFile, ffmpeg_go.KwArgs{"f": "mp4", "vn": "", "b:a": "48k", "c:a": "aac"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), key, sameKey)
+
+	// other settings make another key
+	otherKey, err := transcodeCacheKey(sourceFile, ffmpeg_go.KwArgs{"c:a": "aac", "b:a": "64k", "vn": "", "f": "mp4"})
+	assert.Nil(suite.T(), err)
+	assert.NotEqual(suite.T(), key, otherKey)
+
+	// other content makes another key
+	assert.Nil(suite.T(), os.WriteFile(sourceFile, []byte("other audio"), 0644))
+	otherKey, err = transcodeCacheKey(sourceFile, args)
+	assert.Nil(suite.T(), err)
+	assert.NotEqual(suite.T(), key, otherKey)
+
+	_, err = transcodeCacheKey(filepath.Join(UtScratchDirectory, "missing.mp3"), args)
+	assert.NotNil(suite.T(), err)
+}
+
+func (suite *TranscodeCacheTestSuite) TestStoreAndFetchCachedTranscode() {
+	cacheDir := filepath.Join(UtScratchDirectory, "transcode-cache")
+	transcodedFile := filepath.Join(UtScratchDirectory, "cache-transcoded.m4a")
+	destFile := filepath.Join(UtScratchDirectory, "cache-fetched.m4a")
+	key := "ab0123456789"
+	assert.Nil(suite.T(), os.WriteFile(transcodedFile, []byte("transcoded audio"), 0644))
+
+	hit, err := fetchCachedTranscode(cacheDir, key, destFile)
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), hit)
+
+	assert.Nil(suite.T(), storeCachedTranscode(cacheDir, key, transcodedFile))
+	assert.FileExists(suite.T(), filepath.Join(cacheDir, "ab", key+".m4a"))
+
+	hit, err = fetchCachedTranscode(cacheDir, key, destFile)
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), hit)
+	content, err := os.ReadFile(destFile)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "transcoded audio", string(content))
+
+	count, size, err := CacheSize(cacheDir)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 1, count)
+	assert.Equal(suite.T(), int64(len("transcoded audio")), size)
+
+	// a leftover partial write isn't an entry, and is only pruned once it's stale
+	staleFile := filepath.Join(cacheDir, "ab", key+"-123.tmp")
+	assert.Nil(suite.T(), os.WriteFile(staleFile, []byte("partial"), 0644))
+	entries, err := ListCache(cacheDir)
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), entries, 1)
+	stale := time.Now().Add(-2 * transcodeCacheTempAge)
+	assert.Nil(suite.T(), os.Chtimes(staleFile, stale, stale))
+
+	pruned, err := PruneCache(cacheDir, CachePruneOptions{MaxSize: 1, DryRun: true})
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), pruned, 1)
+	assert.FileExists(suite.T(), pruned[0].Path)
+	assert.FileExists(suite.T(), staleFile)
+
+	pruned, err = PruneCache(cacheDir, CachePruneOptions{MaxSize: 1})
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), pruned, 1)
+	assert.NoFileExists(suite.T(), pruned[0].Path)
+	assert.NoFileExists(suite.T(), staleFile)
+
+	// a cache that was never written to is empty
+	count, size, err = CacheSize(filepath.Join(UtScratchDirectory, "no-cache"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 0, count)
+	assert.Equal(suite.T(), int64(0), size)
+}
+
+func (suite *TranscodeCacheTestSuite) TestSelectCachePrune() {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	entries := []CacheEntry{
+		{Path: "a.m4a", Size: 100, LastUsed: now.Add(-72 * time.Hour)},
+		{Path: "b.m4a", Size: 200, LastUsed: now.Add(-48 * time.Hour)},
+		{Path: "c.m4a", Size: 300, LastUsed: now.Add(-1 * time.Hour)},
+	}
+
+	assert.Empty(suite.T(), selectCachePrune(entries, CachePruneOptions{}, now))
+
+	pruned := selectCachePrune(entries, CachePruneOptions{OlderThan: 24 * time.Hour}, now)
+	assert.Equal(suite.T(), entries[:2], pruned)
+
+	pruned = selectCachePrune(entries, CachePruneOptions{MaxSize: 450}, now)
+	assert.Equal(suite.T(), entries[:2], pruned)
+
+	pruned = selectCachePrune(entries, CachePruneOptions{MaxSize: 500}, now)
+	assert.Equal(suite.T(), entries[:1], pruned)
+
+	// either limit removes an entry
+	pruned = selectCachePrune(entries, CachePruneOptions{OlderThan: 60 * time.Hour, MaxSize: 600}, now)
+	assert.Equal(suite.T(), entries[:1], pruned)
+}
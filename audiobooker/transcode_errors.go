@@ -0,0 +1,51 @@
+package audiobooker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// stderrTailLines number of lines at the end of ffmpeg's output kept for failure reports
+const stderrTailLines = 10
+
+// TranscodeError a source file that failed to transcode, with the end of ffmpeg's output
+type TranscodeError struct {
+	// SourceFile path of the source file
+	SourceFile string
+	// Attempts number of times the transcode was run
+	Attempts int
+	// Err error of the last attempt
+	Err error
+	// Stderr tail of ffmpeg's output from the last attempt
+	Stderr string
+}
+
+// Error describes the failure, followed by the indented tail of ffmpeg's output
+func (e *TranscodeError) Error() string {
+	message := fmt.Sprintf("%s failed to transcode after %d attempt(s): %v", filepath.Base(e.SourceFile), e.Attempts, e.Err)
+	if e.Stderr == "" {
+		return message
+	}
+	return message + "\n    " + strings.ReplaceAll(e.Stderr, "\n", "\n    ")
+}
+
+// Unwrap returns the error of the last attempt
+func (e *TranscodeError) Unwrap() error {
+	return e.Err
+}
+
+// stderrTail returns the last lines of ffmpeg's output, treating the carriage returns of its progress line as line breaks
+func stderrTail(output string, lines int) string {
+	tail := make([]string, 0, lines)
+	for _, line := range strings.FieldsFunc(output, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(tail) == lines {
+			tail = tail[1:]
+		}
+		tail = append(tail, strings.TrimRight(line, " "))
+	}
+	return strings.Join(tail, "\n")
+}
@@ -0,0 +1,48 @@
+package audiobooker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"path/filepath"
+)
+
+type TranscodeErrorsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TranscodeErrorsTestSuite) TestStderrTail() {
+	output := "ffmpeg version 6.0\n  built with gcc\nsize=     256kB time=00:00:10.00\rsize=     512kB time=00:00:20.00\r\n\n[aac @ 0x1] Too many bits\nConversion failed!\n"
+	assert.Equal(suite.T(), "size=     512kB time=00:00:20.00\n[aac @ 0x1] Too many bits\nConversion failed!", stderrTail(output, 3))
+	assert.Equal(suite.T(), "", stderrTail("", 3))
+}
+
+func (suite *TranscodeErrorsTestSuite) TestTranscodeErrorMessage() {
+	err := &TranscodeError{SourceFile: "/books/On War/03.mp3", Attempts: 2, Err: errors.New("exit status 1"), Stderr: "[mp3 @ 0x1] invalid frame\nConversion failed!"}
+	assert.Equal(suite.T(), "03.mp3 failed to transcode after 2 attempt(s): exit status 1\n    [mp3 @ 0x1] invalid frame\n    Conversion failed!", err.Error())
+	assert.Equal(suite.T(), "exit status 1", errors.Unwrap(err).Error())
+}
+
+func (suite *TranscodeErrorsTestSuite) TestTranscodeFileRetries() {
+	srcFile := filepath.Join(UtScratchDirectory, "missing.mp3")
+	destFile := filepath.Join(UtScratchDirectory, "missing.m4a")
+	args := ffmpeg_go.KwArgs{"c:a": "aac", "vn": "", "f": "mp4"}
+
+	transcodeErr := transcodeFile(context.Background(), Config{}, srcFile, destFile, args, nil)
+	assert.NotNil(suite.T(), transcodeErr)
+	assert.Equal(suite.T(), srcFile, transcodeErr.SourceFile)
+	assert.Equal(suite.T(), 1, transcodeErr.Attempts)
+
+	transcodeErr = transcodeFile(context.Background(), Config{TranscodeRetries: 2}, srcFile, destFile, args, nil)
+	assert.NotNil(suite.T(), transcodeErr)
+	assert.Equal(suite.T(), 3, transcodeErr.Attempts)
+
+	// cancelled transcodes aren't retried
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transcodeErr = transcodeFile(ctx, Config{TranscodeRetries: 2}, srcFile, destFile, args, nil)
+	assert.NotNil(suite.T(), transcodeErr)
+	assert.Equal(suite.T(), 1, transcodeErr.Attempts)
+}
@@ -0,0 +1,152 @@
+package audiobooker
+
+import (
+	"context"
+	"fmt"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"gopkg.in/vansante/go-ffprobe.v2"
+	"strconv"
+	"time"
+)
+
+// ffprobeAACProfiles names ffprobe reports for the AAC encoder profiles
+var ffprobeAACProfiles = map[string]string{
+	"":          "LC",
+	"aac_low":   "LC",
+	"aac_he":    "HE-AAC",
+	"aac_he_v2": "HE-AACv2",
+}
+
+// TranscodePlan how a source file is prepared for combining
+type TranscodePlan struct {
+	// SourceFile path of the source file
+	SourceFile string
+	// Copy the audio is stream copied instead of re-encoded
+	Copy bool
+	// Reason why the file is re-encoded
+	Reason string
+	// Duration audio duration of the source file
+	Duration time.Duration
+	// args ffmpeg output arguments for the audio
+	args ffmpeg_go.KwArgs
+}
+
+// audioFormat sample rate and channel count all the files being combined must share
+type audioFormat struct {
+	sampleRate int
+	channels   int
+}
+
+// PlanTranscode probes the source files and decides which already match the encoding profile, and can be stream copied, and which must be re-encoded, every file is re-encoded when a loudness correction is given
+func PlanTranscode(ctx context.Context, config Config, loudness *LoudnessMeasurement) ([]TranscodePlan, error) {
+	profile, err := GetEncodingProfile(config.EncodingProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]*ffprobe.Stream, len(config.sourceFiles))
+	durations := make([]time.Duration, len(config.sourceFiles))
+	for idx, sourceFile := range config.sourceFiles {
+		data, err := ffprobe.ProbeURL(ctx, sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		streams[idx] = data.FirstAudioStream()
+		if data.Format != nil {
+			durations[idx] = data.Format.Duration()
+		}
+	}
+
+	plans := planTranscode(profile, config.sourceFiles, streams, loudness)
+	for idx := range plans {
+		plans[idx].Duration = durations[idx]
+	}
+	return plans, nil
+}
+
+// planTranscode plans the transcode of each source file from its probed audio stream
+func planTranscode(profile EncodingProfile, sourceFiles []string, streams []*ffprobe.Stream, loudness *LoudnessMeasurement) []TranscodePlan {
+	target := transcodeTarget(profile, streams)
+
+	// re-encoded files are encoded to the same format as the copied ones, so they can all be combined without re-encoding
+	encodeArgs := profile.ffmpegArgs()
+	if target.sampleRate > 0 {
+		encodeArgs["ar"] = target.sampleRate
+	}
+	if target.channels > 0 {
+		encodeArgs["ac"] = target.channels
+	}
+	// the same gain is applied to every file, so the correction stays linear across the book
+	correct := loudness != nil && loudness.Gain != 0
+	if correct {
+		encodeArgs["af"] = loudness.volumeFilter()
+	}
+
+	plans := make([]TranscodePlan, len(sourceFiles))
+	for idx, sourceFile := range sourceFiles {
+		plans[idx] = TranscodePlan{SourceFile: sourceFile}
+		if correct {
+			plans[idx].Reason = fmt.Sprintf("loudness correction of %+.2f dB", loudness.Gain)
+			plans[idx].args = encodeArgs
+		} else if reason := profile.incompatibility(streams[idx], target); reason != "" {
+			plans[idx].Reason = reason
+			plans[idx].args = encodeArgs
+		} else {
+			plans[idx].Copy = true
+			plans[idx].args = ffmpeg_go.KwArgs{"c:a": "copy"}
+		}
+	}
+
+	return plans
+}
+
+// transcodeTarget returns the format of the profile, filling in what it leaves to the source with the most common format of the sources
+func transcodeTarget(profile EncodingProfile, streams []*ffprobe.Stream) audioFormat {
+	target := audioFormat{sampleRate: profile.SampleRate, channels: profile.Channels}
+	if target.sampleRate > 0 && target.channels > 0 {
+		return target
+	}
+
+	counts := make(map[audioFormat]int)
+	var common audioFormat
+	for _, stream := range streams {
+		if stream == nil {
+			continue
+		}
+		sampleRate, _ := strconv.Atoi(stream.SampleRate)
+		format := audioFormat{sampleRate: sampleRate, channels: stream.Channels}
+		counts[format]++
+		// ties go to the earliest file
+		if counts[format] > counts[common] {
+			common = format
+		}
+	}
+
+	if target.sampleRate == 0 {
+		target.sampleRate = common.sampleRate
+	}
+	if target.channels == 0 {
+		target.channels = common.channels
+	}
+	return target
+}
+
+// incompatibility returns why a stream can't be stream copied in place of encoding it with the profile, or an empty string if it can
+func (p EncodingProfile) incompatibility(stream *ffprobe.Stream, target audioFormat) string {
+	if stream == nil {
+		return "no audio stream found"
+	}
+	if stream.CodecName != "aac" {
+		return fmt.Sprintf("codec is %s, not aac", stream.CodecName)
+	}
+	if profile := ffprobeAACProfiles[p.Profile]; stream.Profile != profile {
+		return fmt.Sprintf("AAC profile is %s, not %s", stream.Profile, profile)
+	}
+	if sampleRate, _ := strconv.Atoi(stream.SampleRate); sampleRate != target.sampleRate {
+		return fmt.Sprintf("sample rate is %s Hz, not %d Hz", stream.SampleRate, target.sampleRate)
+	}
+	if stream.Channels != target.channels {
+		return fmt.Sprintf("has %d channels, not %d", stream.Channels, target.channels)
+	}
+	return ""
+}
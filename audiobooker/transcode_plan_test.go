@@ -0,0 +1,64 @@
+package audiobooker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+type TranscodePlanTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TranscodePlanTestSuite) TestPlanTranscodeDefaultProfile() {
+	sourceFiles := []string{"01.m4a", "02.m4a", "03.mp3", "04.m4a", "05.m4b"}
+	streams := []*ffprobe.Stream{
+		{CodecName: "aac", Profile: "LC", SampleRate: "44100", Channels: 2},
+		{CodecName: "aac", Profile: "LC", SampleRate: "44100", Channels: 2},
+		{CodecName: "mp3", SampleRate: "44100", Channels: 2},
+		{CodecName: "aac", Profile: "LC", SampleRate: "22050", Channels: 1},
+		{CodecName: "aac", Profile: "HE-AAC", SampleRate: "44100", Channels: 2},
+	}
+
+	plans := planTranscode(defaultEncodingProfile, sourceFiles, streams, nil)
+	assert.Equal(suite.T(), 5, len(plans))
+	assert.True(suite.T(), plans[0].Copy)
+	assert.True(suite.T(), plans[1].Copy)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "copy"}, plans[0].args)
+	assert.False(suite.T(), plans[2].Copy)
+	assert.Equal(suite.T(), "codec is mp3, not aac", plans[2].Reason)
+	// the odd ones out are re-encoded to match the most common format
+	assert.False(suite.T(), plans[3].Copy)
+	assert.Equal(suite.T(), "sample rate is 22050 Hz, not 44100 Hz", plans[3].Reason)
+	assert.Equal(suite.T(), ffmpeg_go.KwArgs{"c:a": "aac", "ar": 44100, "ac": 2}, plans[3].args)
+	assert.False(suite.T(), plans[4].Copy)
+	assert.Equal(suite.T(), "AAC profile is HE-AAC, not LC", plans[4].Reason)
+}
+
+func (suite *TranscodePlanTestSuite) TestPlanTranscodeWithProfile() {
+	profile, err := GetEncodingProfile("spoken-mono-48k")
+	assert.Nil(suite.T(), err)
+
+	sourceFiles := []string{"01.m4a", "02.m4a", "03.m4a"}
+	streams := []*ffprobe.Stream{
+		{CodecName: "aac", Profile: "LC", SampleRate: "44100", Channels: 1},
+		{CodecName: "aac", Profile: "LC", SampleRate: "44100", Channels: 2},
+		nil,
+	}
+
+	plans := planTranscode(profile, sourceFiles, streams, nil)
+	assert.True(suite.T(), plans[0].Copy)
+	// the profile decides the format, not the sources
+	assert.False(suite.T(), plans[1].Copy)
+	assert.Equal(suite.T(), "has 2 channels, not 1", plans[1].Reason)
+	assert.Equal(suite.T(), profile.ffmpegArgs(), plans[1].args)
+	assert.False(suite.T(), plans[2].Copy)
+	assert.Equal(suite.T(), "no audio stream found", plans[2].Reason)
+
+	// HE-AAC sources are only copied for an HE-AAC profile
+	profile, err = GetEncodingProfile("he-aac-32k")
+	assert.Nil(suite.T(), err)
+	plans = planTranscode(profile, sourceFiles[:1], []*ffprobe.Stream{{CodecName: "aac", Profile: "HE-AAC", SampleRate: "44100", Channels: 2}}, nil)
+	assert.True(suite.T(), plans[0].Copy)
+}
@@ -1,6 +1,7 @@
 package audiobooker
 
 import (
+	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -45,9 +46,9 @@ func (suite *TranscodeTestSuite) TestTranscodeSourceFiles() {
 	c1.ScratchFilesPath = suite.ScratchPath
 	c1.SourceFilesPath = TestFilesMp3
 	c1.Jobs = 3
-	err = c1.New()
+	err = c1.New(context.Background())
 	assert.Nil(suite.T(), err)
-	err = TranscodeSourceFiles(&c1)
+	err = TranscodeSourceFiles(context.Background(), &c1)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 2, len(c1.transcodeFiles))
 	f1, err := os.Stat(c1.transcodeFiles[0])
@@ -58,7 +59,7 @@ func (suite *TranscodeTestSuite) TestTranscodeSourceFiles() {
 	assert.Greater(suite.T(), f2.Size(), int64(0))
 
 	// successful combine
-	err = Combine(c1)
+	err = Combine(context.Background(), c1)
 	assert.Nil(suite.T(), err)
 	f3, err := os.Stat(c1.preOutputFilePath)
 	assert.Greater(suite.T(), f3.Size(), int64(0))
@@ -103,7 +104,7 @@ func (suite *TranscodeTestSuite) TestBind() {
 		VerboseTranscode:  true,
 	}
 
-	err = Bind(c1, book)
+	err = Bind(context.Background(), c1, book)
 	assert.Nil(suite.T(), err)
 
 	c2 := Config{
@@ -112,10 +113,34 @@ func (suite *TranscodeTestSuite) TestBind() {
 		preOutputFile:     filepath.Join(suite.ScratchPath, "output-2.m4b"),
 		preOutputFilePath: testAudioFile.Name(),
 	}
-	err = Bind(c2, book)
+	err = Bind(context.Background(), c2, book)
 	assert.Nil(suite.T(), err)
 }
 
+func (suite *TranscodeTestSuite) TestBindInputFile() {
+	sourceFile := filepath.Join(suite.ScratchPath, "single-source.flac")
+	err := os.WriteFile(sourceFile, []byte("flac"), 0644)
+	assert.Nil(suite.T(), err)
+	combinedFile := filepath.Join(suite.ScratchPath, "out.m4b")
+
+	// a single source file is bound from the combined audio like any other book
+	c1 := Config{
+		SourceFilesPath:   suite.ScratchPath,
+		preOutputFilePath: combinedFile,
+		sourceFiles:       []string{sourceFile},
+	}
+	inputFile, err := bindInputFile(c1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), combinedFile, inputFile)
+
+	// the source file is only bound as it is when embedding without transcoding
+	c2 := c1
+	c2.EmbedSourceFile = true
+	inputFile, err = bindInputFile(c2)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), sourceFile, inputFile)
+}
+
 func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 	var err error
 
@@ -133,7 +158,7 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/60-min.m4a")},
 	}
 
-	err = SplitSingleFile(&c1)
+	err = SplitSingleFile(context.Background(), &c1)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 6, len(c1.sourceFiles))
 
@@ -145,7 +170,7 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/8-min.m4a")},
 	}
 
-	err = SplitSingleFile(&c2)
+	err = SplitSingleFile(context.Background(), &c2)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 2, len(c2.sourceFiles))
 
@@ -158,7 +183,7 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/8-min.m4a"), "no-file.mp3"},
 	}
 
-	err = SplitSingleFile(&c3)
+	err = SplitSingleFile(context.Background(), &c3)
 	assert.Error(suite.T(), err)
 
 	// success on splitting multi-hour-file into even parts
@@ -168,7 +193,7 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 		VerboseTranscode: true,
 	}
 
-	err = SplitSingleFile(&c4)
+	err = SplitSingleFile(context.Background(), &c4)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 1, len(c4.sourceFiles))
 
@@ -181,7 +206,7 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/3-hour.m4a")},
 	}
 
-	err = SplitSingleFile(&c5)
+	err = SplitSingleFile(context.Background(), &c5)
 	assert.Nil(suite.T(), err)
 	assert.Equal(suite.T(), 2, len(c5.sourceFiles))
 
@@ -189,6 +214,19 @@ func (suite *TranscodeTestSuite) TestSplitSingleFile() {
 	cleanSplitDir()
 }
 
+func (suite *TranscodeTestSuite) TestSplitSourceFiles() {
+	// multiple source files are left as they are
+	c1 := Config{
+		scratchDir:  suite.ScratchPath,
+		sourceFiles: []string{filepath.Join(TestDataRoot, "misc/8-min.m4a"), filepath.Join(TestDataRoot, "misc/4-min.m4a")},
+	}
+
+	err := SplitSourceFiles(context.Background(), &c1)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{filepath.Join(TestDataRoot, "misc/8-min.m4a"), filepath.Join(TestDataRoot, "misc/4-min.m4a")}, c1.sourceFiles)
+	assert.NoDirExists(suite.T(), filepath.Join(suite.ScratchPath, "split"))
+}
+
 func (suite *TranscodeTestSuite) TestTranscodeWithMarkers() {
 	var err error
 
@@ -216,7 +254,7 @@ func (suite *TranscodeTestSuite) TestTranscodeWithMarkers() {
 		},
 	}
 
-	err = TranscodeWithMarkers(&c1, points1)
+	err = TranscodeWithMarkers(context.Background(), &c1, points1)
 	assert.Nil(suite.T(), err)
 	files, err := filepath.Glob(fmt.Sprintf("%s/split/*.aac", suite.ScratchPath))
 	assert.Nil(suite.T(), err)
@@ -240,7 +278,7 @@ func (suite *TranscodeTestSuite) TestTranscodeWithMarkers() {
 		},
 	}
 
-	err = TranscodeWithMarkers(&c2, points2)
+	err = TranscodeWithMarkers(context.Background(), &c2, points2)
 	assert.Nil(suite.T(), err)
 	files, err = filepath.Glob(fmt.Sprintf("%s/split/*.aac", suite.ScratchPath))
 	assert.Nil(suite.T(), err)
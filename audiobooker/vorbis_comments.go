@@ -0,0 +1,117 @@
+package audiobooker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// flacPictureDepth colour depth recorded for cover images, players only use it as a hint
+const flacPictureDepth = 24
+
+// VorbisComments returns the Vorbis comments holding the metadata and chapters of the book, and the cover image if given, as KEY=value pairs
+func (b *Book) VorbisComments(coverImage *string) ([]string, error) {
+	// generate SortSlug if present
+	b.generateSortSlug()
+
+	comments := []string{
+		"TITLE=" + b.Title,
+		"ALBUM=" + b.Title,
+		"ARTIST=" + b.Author,
+	}
+	if b.Narrator != nil {
+		comments = append(comments, "COMPOSER="+*b.Narrator, "PERFORMER="+*b.Narrator)
+	}
+	genre := "Audiobooks"
+	if b.Genre != nil {
+		genre = *b.Genre
+	}
+	comments = append(comments, "GENRE="+genre)
+	if b.Date != nil {
+		comments = append(comments, "DATE="+*b.Date)
+	}
+	if b.Language != nil {
+		comments = append(comments, "LANGUAGE="+*b.Language)
+	}
+	if b.SortSlug != nil {
+		comments = append(comments, "ALBUMSORT="+*b.SortSlug, "TITLESORT="+*b.SortSlug)
+	}
+	if b.Description != nil {
+		comments = append(comments, "DESCRIPTION="+unescapeDescription(*b.Description))
+	}
+
+	if coverImage != nil {
+		picture, err := flacPictureBlock(*coverImage)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(picture))
+	}
+
+	// chapters follow the CHAPTERxxx and CHAPTERxxxNAME convention, numbered from zero like ffmpeg writes them
+	for idx, chapter := range b.Chapters {
+		comments = append(comments,
+			fmt.Sprintf("CHAPTER%03d=%s", idx, formatTimestamp(chapter.StartMs)),
+			fmt.Sprintf("CHAPTER%03dNAME=%s", idx, chapter.Title),
+		)
+	}
+
+	return comments, nil
+}
+
+// WriteVorbisCommentsFile writes the Vorbis comments of the book as an ffmetadata file, which keeps large values like the cover image off the ffmpeg command line
+func (b *Book) WriteVorbisCommentsFile(filename string, coverImage *string) error {
+	comments, err := b.VorbisComments(coverImage)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	out.WriteString(";FFMETADATA1\n")
+	for _, comment := range comments {
+		key, value, _ := strings.Cut(comment, "=")
+		fmt.Fprintf(&out, "%s=%s\n", key, escapeFFMetadata(value))
+	}
+
+	return os.WriteFile(filename, []byte(out.String()), 0644)
+}
+
+// flacPictureBlock renders an image file as a FLAC picture metadata block holding the front cover
+func flacPictureBlock(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := "image/jpeg"
+	if strings.EqualFold(filepath.Ext(filename), ".png") {
+		mimeType = "image/png"
+	}
+
+	// the dimensions are informational, so an image that can't be decoded is still embedded
+	width, height, depth := 0, 0, 0
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		width, height, depth = config.Width, config.Height, flacPictureDepth
+	}
+
+	block := binary.BigEndian.AppendUint32(nil, id3PictureFrontCover)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(mimeType)))
+	block = append(block, mimeType...)
+	// no description
+	block = binary.BigEndian.AppendUint32(block, 0)
+	block = binary.BigEndian.AppendUint32(block, uint32(width))
+	block = binary.BigEndian.AppendUint32(block, uint32(height))
+	block = binary.BigEndian.AppendUint32(block, uint32(depth))
+	// not an indexed colour image
+	block = binary.BigEndian.AppendUint32(block, 0)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(data)))
+
+	return append(block, data...), nil
+}
@@ -0,0 +1,95 @@
+package audiobooker
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type VorbisCommentsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *VorbisCommentsTestSuite) TestVorbisComments() {
+	narrator := "Some Narrator"
+	description := escapeDescription("A treatise on\nmilitary strategy.")
+	b := Book{
+		Author:      "Carl von Clausewitz",
+		Title:       "On War",
+		Narrator:    &narrator,
+		Description: &description,
+		Chapters: []*Chapter{
+			{StartMs: 0, EndMs: 30000, Title: "Book One"},
+			{StartMs: 30000, EndMs: 3725500, Title: "Book Two"},
+		},
+	}
+
+	comments, err := b.VorbisComments(nil)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []string{
+		"TITLE=On War",
+		"ALBUM=On War",
+		"ARTIST=Carl von Clausewitz",
+		"COMPOSER=Some Narrator",
+		"PERFORMER=Some Narrator",
+		"GENRE=Audiobooks",
+		"DESCRIPTION=A treatise on\nmilitary strategy.",
+		"CHAPTER000=00:00:00.000",
+		"CHAPTER000NAME=Book One",
+		"CHAPTER001=00:00:30.000",
+		"CHAPTER001NAME=Book Two",
+	}, comments)
+
+	// the comments file escapes values for ffmetadata
+	filename := filepath.Join(UtScratchDirectory, "opus-comments.ini")
+	err = b.WriteVorbisCommentsFile(filename, nil)
+	assert.Nil(suite.T(), err)
+	data, err := os.ReadFile(filename)
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), strings.HasPrefix(string(data), ";FFMETADATA1\nTITLE=On War\n"))
+	assert.Contains(suite.T(), string(data), "DESCRIPTION=A treatise on\\\nmilitary strategy.\n")
+
+	// the chapters can be read back as an OGM chapter list
+	chapters, format, err := ParseChapterList(strings.Join(comments[7:], "\n"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), ChapterFormatOgm, format)
+	assert.Equal(suite.T(), 2, len(chapters))
+	assert.Equal(suite.T(), "Book Two", chapters[1].Title)
+}
+
+func (suite *VorbisCommentsTestSuite) TestFlacPictureBlock() {
+	coverImage := filepath.Join(UtScratchDirectory, "cover.png")
+	f, err := os.Create(coverImage)
+	assert.Nil(suite.T(), err)
+	err = png.Encode(f, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), f.Close())
+	imageData, err := os.ReadFile(coverImage)
+	assert.Nil(suite.T(), err)
+
+	block, err := flacPictureBlock(coverImage)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), uint32(3), binary.BigEndian.Uint32(block[0:4]))
+	assert.Equal(suite.T(), uint32(9), binary.BigEndian.Uint32(block[4:8]))
+	assert.Equal(suite.T(), "image/png", string(block[8:17]))
+	assert.Equal(suite.T(), uint32(0), binary.BigEndian.Uint32(block[17:21]))
+	assert.Equal(suite.T(), uint32(40), binary.BigEndian.Uint32(block[21:25]))
+	assert.Equal(suite.T(), uint32(30), binary.BigEndian.Uint32(block[25:29]))
+	assert.Equal(suite.T(), uint32(len(imageData)), binary.BigEndian.Uint32(block[37:41]))
+	assert.Equal(suite.T(), imageData, block[41:])
+
+	// the cover is base64 encoded into the comments
+	b := Book{Author: "Carl von Clausewitz", Title: "On War"}
+	comments, err := b.VorbisComments(&coverImage)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(block), comments[len(comments)-1])
+
+	_, err = flacPictureBlock(filepath.Join(UtScratchDirectory, "missing.jpg"))
+	assert.NotNil(suite.T(), err)
+}
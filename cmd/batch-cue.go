@@ -0,0 +1,168 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// batchCueCmd represents the cue command
+var batchCueCmd = &cobra.Command{
+	Use:   "cue",
+	Short: `Bind audiobook using a CUE sheet for the chapters`,
+	Long: `Bind audiobook, per book directory, using the standalone '.cue' file found in the directory for the chapters.
+
+Each TRACK of the CUE sheet becomes a chapter, with tracks spanning multiple FILE entries offset by the length of the files before them.  The source files are bound in the order they're listed in the CUE sheet.  The title, performer, genre, and date of the CUE sheet are used for any book metadata not supplied by the path pattern.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("Starting batch from CUE sheets\n\n")
+		processStart := time.Now()
+		var err error
+
+		// Parse scoped options
+		sourceFilesRoot, err := cmd.Flags().GetString("source-files-root")
+		if err != nil {
+			return err
+		}
+
+		pathPattern, err := cmd.Flags().GetString("path-pattern")
+		if err != nil {
+			return err
+		}
+
+		err = runBatch(cmd, func(ctx context.Context, dir string, report *audiobooker.BookReport) (string, error) {
+			startTime := time.Now()
+
+			// create config struct and parse ENV variables for configs
+			config := audiobooker.Config{}
+			defer config.Cleanup()
+			if err := config.Parse(); err != nil {
+				return "", err
+			}
+
+			// generate and validate flags
+			if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
+				return "", err
+			}
+
+			// validate full path formatting
+			var fullPath string
+			if strings.HasSuffix(sourceFilesRoot, "/") {
+				fullPath = sourceFilesRoot + pathPattern
+			} else {
+				fullPath = sourceFilesRoot + "/" + pathPattern
+			}
+			// parse source based on pattern
+			pathTags, err := audiobooker.ParsePathTags(dir, fullPath)
+			if err != nil {
+				return "", err
+			}
+
+			// get the source files path to current book directory
+			config.SourceFilesPath = dir
+			// a relative EPUB file is named within each book directory
+			if config.EpubFile != "" && !filepath.IsAbs(config.EpubFile) {
+				config.EpubFile = filepath.Join(dir, config.EpubFile)
+			}
+
+			// create book instance and generate metadata from path
+			book := audiobooker.Book{}
+			book.ParseFromPattern(pathTags)
+
+			// initialize config
+			if err := config.New(ctx); err != nil {
+				return "", err
+			}
+
+			// parse the CUE sheet into chapters and fill in missing metadata
+			if err := book.ChapterByCueSheet(ctx, &config); err != nil {
+				return "", err
+			}
+
+			// fill in missing metadata from an EPUB, the CUE sheet titles its own chapters
+			if err := book.ParseFromEpub(config); err != nil {
+				return "", err
+			}
+			log.Debugln(book)
+
+			// compute output filename from metadata and patterns
+			if err := config.SetOutputFilename(book); err != nil {
+				return "", err
+			}
+
+			fmt.Println("book found at:", dir)
+			for k, v := range pathTags {
+				fmt.Printf("%+15s: %s\n", k, v)
+			}
+			outputPath := filepath.Join(config.OutputPath, config.OutputFile)
+			fmt.Printf("output filepath: %s\n\n", outputPath)
+			// describe the book as it's left, bound, planned, or failed
+			defer func() { report.Describe(ctx, config, book, pathTags) }()
+
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return outputPath, err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+
+			// if dry-run flag is given, output metadata for validation but don't convert
+			if dryRun {
+				if err := printTranscodePlan(ctx, config); err != nil {
+					return outputPath, err
+				}
+				fmt.Printf("dry-run flag was set, skipping conversion\n\n")
+				return outputPath, nil
+			}
+
+			log.Debugln("Beginning conversion")
+
+			// make output directory paths
+			if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+				return outputPath, err
+			}
+			if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+				return outputPath, err
+			}
+
+			// generate chapters metadata
+			if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+				return outputPath, err
+			}
+
+			// combine pre-transcode files
+			if err := audiobooker.Combine(ctx, config); err != nil {
+				return outputPath, err
+			}
+
+			// Apply metadata to output file
+			if err := audiobooker.Bind(ctx, config, book); err != nil {
+				return outputPath, err
+			}
+
+			notifyFinishedBook(book, startTime)
+			return outputPath, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Entire process took:", time.Now().Sub(processStart))
+		fmt.Println("fin.")
+		return nil
+	},
+}
+
+func init() {
+	batchCmd.AddCommand(batchCueCmd)
+}
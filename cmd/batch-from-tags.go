@@ -4,12 +4,11 @@ Copyright © 2023 Chris Slamar chris@slamar.com
 package cmd
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/cslamar/audiobooker/audiobooker"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,56 +36,19 @@ var batchFromTagsCmd = &cobra.Command{
 			return err
 		}
 
-		// slice of directories that contain books
-		bookDirs := make([]string, 0)
-		log.Debugln("src files root:", sourceFilesRoot)
-		err = filepath.WalkDir(sourceFilesRoot, func(path string, d fs.DirEntry, err error) error {
-			// return if not a directory
-			if !d.IsDir() {
-				return nil
-			}
-			// scan files in path
-			dirs, err := os.ReadDir(path)
-			if err != nil {
-				return err
-			}
-			// if this directory contains directories, skip
-			for _, dir := range dirs {
-				if dir.Type().IsDir() {
-					return nil
-				}
-			}
-			// output the last level directories
-			log.Debugln("found book directory at:", path)
-			bookDirs = append(bookDirs, path)
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-
-		// if no book directories were found, error out
-		if len(bookDirs) == 0 {
-			return errors.New("no book directories found in path")
-		}
-
-		// loop through found books
-		for _, dir := range bookDirs {
+		err = runBatch(cmd, func(ctx context.Context, dir string, report *audiobooker.BookReport) (string, error) {
 			startTime := time.Now()
 
 			// create config struct and parse ENV variables for configs
 			config := audiobooker.Config{}
 			defer config.Cleanup()
 			if err := config.Parse(); err != nil {
-				return err
+				return "", err
 			}
 
-			// watch for early terminations
-			go watchForTermSignals(&config)
-
 			// generate and validate configs
 			if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
-				return err
+				return "", err
 			}
 
 			// validate full path formatting
@@ -100,73 +62,103 @@ var batchFromTagsCmd = &cobra.Command{
 			// parse source based on pattern
 			pathTags, err := audiobooker.ParsePathTags(dir, fullPath)
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			// get the source files path to current book directory
 			config.SourceFilesPath = dir
+			// a relative EPUB file is named within each book directory
+			if config.EpubFile != "" && !filepath.IsAbs(config.EpubFile) {
+				config.EpubFile = filepath.Join(dir, config.EpubFile)
+			}
 
 			// create book instance and generate metadata from path
 			book := audiobooker.Book{}
 			book.ParseFromPattern(pathTags)
 
 			// initialize config
-			if err := config.New(); err != nil {
-				return err
+			if err := config.New(ctx); err != nil {
+				return "", err
+			}
+
+			// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+			if err := book.ParseFromEpub(config); err != nil {
+				return "", err
 			}
 			log.Debugln(book)
 
 			// compute output filename from metadata and patterns
 			if err := config.SetOutputFilename(book); err != nil {
-				return err
+				return "", err
 			}
 
 			fmt.Println("book found at:", dir)
 			for k, v := range pathTags {
 				log.Printf("%+15s: %s\n", k, v)
 			}
-			fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
+			outputPath := filepath.Join(config.OutputPath, config.OutputFile)
+			fmt.Printf("output filepath: %s\n\n", outputPath)
+			// describe the book as it's left, bound, planned, or failed
+			defer func() { report.Describe(ctx, config, book, pathTags) }()
 
 			// if dry-run flag is given, output metadata for validation but don't convert
 			if dryRun {
+				if err := printTranscodePlan(ctx, config); err != nil {
+					return outputPath, err
+				}
+				// list the chapters the book would get from its source files
+				config.PlanFromSourceFiles()
+				if err := book.ParseToChapters(ctx, config); err != nil {
+					return outputPath, err
+				}
+				changes, err := book.FinalizeChapters(ctx, config)
+				if err != nil {
+					return outputPath, err
+				}
+				printChapterChanges(changes)
+				printChapters(book.Chapters)
 				fmt.Printf("dry-run flag was set, skipping conversion\n\n")
-				continue
+				return outputPath, nil
 			}
 			log.Debugln("Beginning conversion")
 			// make output directory paths
 			if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
-				return err
+				return outputPath, err
 			}
 
 			// pre-transcode files
-			if err := audiobooker.TranscodeSourceFiles(&config); err != nil {
-				return err
+			if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+				return outputPath, err
 			}
 
 			// Parse files to chapters inside Book struct/object
-			if err := book.ParseToChapters(config); err != nil {
-				return err
+			if err := book.ParseToChapters(ctx, config); err != nil {
+				return outputPath, err
 			}
 
 			log.Debugln(book)
 
 			// Generate metadata for book
-			if err := book.GenerateMetaTemplate(config); err != nil {
-				return err
+			if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+				return outputPath, err
 			}
 
 			// combine pre-transcode files
-			if err := audiobooker.Combine(config); err != nil {
-				return err
+			if err := audiobooker.Combine(ctx, config); err != nil {
+				return outputPath, err
 			}
 
 			// Apply metadata to output file
-			if err := audiobooker.Bind(config, book); err != nil {
-				return err
+			if err := audiobooker.Bind(ctx, config, book); err != nil {
+				return outputPath, err
 			}
 			log.Debugln("that one is done")
 
 			notifyFinishedBook(book, startTime)
+			return outputPath, nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Println("Entire process took:", time.Now().Sub(processStart))
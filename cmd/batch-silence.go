@@ -0,0 +1,189 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// batchSilenceCmd represents the silence command
+var batchSilenceCmd = &cobra.Command{
+	Use:   "silence",
+	Short: `Splits a single audio file into chapters at detected silences`,
+	Long: `Batch silence will split a single file, per book directory, into a chapter marked audiobook file using the silences detected in the audio.
+
+Any silence quieter than '--noise-db' and longer than '--min-silence' (in seconds) becomes a chapter mark, placed in the middle of the silence.  Marks that would create a chapter shorter than '--min-chapter-length' (in minutes) are skipped.
+
+When the number of chapters is known, '--chapters' will rank every detected silence by its length and depth and only use the strongest ones, keeping at least '--min-chapter-length' between them, to create exactly that many chapters.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("Starting batch silence chapters\n\n")
+		processStart := time.Now()
+		var err error
+
+		// Parse scoped options
+		silenceOpts, err := generateSilenceOpts(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		sourceFilesRoot, err := cmd.Flags().GetString("source-files-root")
+		if err != nil {
+			return err
+		}
+
+		pathPattern, err := cmd.Flags().GetString("path-pattern")
+		if err != nil {
+			return err
+		}
+
+		err = runBatch(cmd, func(ctx context.Context, dir string, report *audiobooker.BookReport) (string, error) {
+			startTime := time.Now()
+
+			// create config struct and parse ENV variables for configs
+			config := audiobooker.Config{}
+			defer config.Cleanup()
+			if err := config.Parse(); err != nil {
+				return "", err
+			}
+
+			// generate and validate flags
+			if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
+				return "", err
+			}
+
+			// validate full path formatting
+			var fullPath string
+			if strings.HasSuffix(sourceFilesRoot, "/") {
+				fullPath = sourceFilesRoot + pathPattern
+			} else {
+				fullPath = sourceFilesRoot + "/" + pathPattern
+			}
+			// parse source based on pattern
+			pathTags, err := audiobooker.ParsePathTags(dir, fullPath)
+			if err != nil {
+				return "", err
+			}
+
+			// get the source files path to current book directory
+			config.SourceFilesPath = dir
+			// a relative EPUB file is named within each book directory
+			if config.EpubFile != "" && !filepath.IsAbs(config.EpubFile) {
+				config.EpubFile = filepath.Join(dir, config.EpubFile)
+			}
+
+			// create book instance and generate metadata from path
+			book := audiobooker.Book{}
+			book.ParseFromPattern(pathTags)
+
+			// initialize config
+			if err := config.New(ctx); err != nil {
+				return "", err
+			}
+
+			// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+			if err := book.ParseFromEpub(config); err != nil {
+				return "", err
+			}
+			log.Debugln(book)
+
+			// compute output filename from metadata and patterns
+			if err := config.SetOutputFilename(book); err != nil {
+				return "", err
+			}
+
+			fmt.Println("book found at:", dir)
+			for k, v := range pathTags {
+				fmt.Printf("%+15s: %s\n", k, v)
+			}
+			outputPath := filepath.Join(config.OutputPath, config.OutputFile)
+			fmt.Printf("output filepath: %s\n\n", outputPath)
+			// describe the book as it's left, bound, planned, or failed
+			defer func() { report.Describe(ctx, config, book, pathTags) }()
+
+			// detect the silences and create the chapters from them
+			selections, err := book.ChapterBySilence(ctx, config, config.SourceFilesPath, silenceOpts)
+			if dryRun {
+				printMarkerSelections(selections)
+			}
+			if err != nil {
+				return outputPath, err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return outputPath, err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+
+			// if dry-run flag is given, output metadata for validation but don't convert
+			if dryRun {
+				if err := printTranscodePlan(ctx, config); err != nil {
+					return outputPath, err
+				}
+				fmt.Printf("dry-run flag was set, skipping conversion\n\n")
+				return outputPath, nil
+			}
+
+			log.Debugln("Beginning conversion")
+
+			// make output directory paths
+			if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+				return outputPath, err
+			}
+			if err := audiobooker.SplitSingleFile(ctx, &config); err != nil {
+				return outputPath, err
+			}
+
+			if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+				return outputPath, err
+			}
+
+			log.Debugln(book)
+
+			// generate chapters metadata
+			if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+				return outputPath, err
+			}
+
+			// combine pre-transcode files
+			if err := audiobooker.Combine(ctx, config); err != nil {
+				return outputPath, err
+			}
+
+			// Apply metadata to output file
+			if err := audiobooker.Bind(ctx, config, book); err != nil {
+				return outputPath, err
+			}
+
+			notifyFinishedBook(book, startTime)
+			return outputPath, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Entire process took:", time.Now().Sub(processStart))
+		fmt.Println("fin.")
+		return nil
+	},
+}
+
+func init() {
+	batchCmd.AddCommand(batchSilenceCmd)
+
+	batchSilenceCmd.Flags().Int("chapters", 0, "target number of chapters, picks the strongest silences as chapter marks (0 uses every detected silence)")
+	batchSilenceCmd.Flags().Int("noise-db", -30, "noise floor (in dB) below which audio is considered silence")
+	batchSilenceCmd.Flags().Float64("min-silence", 2.5, "minimum length of silence (in seconds) to use as a chapter mark")
+	batchSilenceCmd.Flags().Float64("min-chapter-length", 1, "minimum chapter length in minutes")
+}
@@ -4,11 +4,10 @@ Copyright © 2023 Chris Slamar chris@slamar.com
 package cmd
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/cslamar/audiobooker/audiobooker"
 	log "github.com/sirupsen/logrus"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,7 +24,7 @@ var batchSplitCmd = &cobra.Command{
 
 First a static number (in minutes) can be passed in to make hard chapter marks at the specified duration.  Each mark will result in chapter metadata being created at those increments with the name "Chapter X" (where X in the index).
 
-The other way that split-chapters can be used is if the existing file already has metadata embedded.  Passing in the '--use-embedded' flag will use that metadata when creating the chapters for the new audiobook file.`,
+The other way that split-chapters can be used is if the existing file already has metadata embedded.  Passing in the '--use-embedded' flag will use that metadata when creating the chapters for the new audiobook file.  When a book is a directory of chaptered files, like one file per part, the chapters of every file are kept, and '--prefix-part-names' adds the name of each file to its chapter titles.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Starting batch splitting chapters\n\n")
@@ -53,63 +52,33 @@ The other way that split-chapters can be used is if the existing file already ha
 			return err
 		}
 
-		generateChapters, err := cmd.Flags().GetBool("generate-chapters")
+		prefixPartNames, err := cmd.Flags().GetBool("prefix-part-names")
 		if err != nil {
 			return err
 		}
 
-		// slice of directories that contain books
-		bookDirs := make([]string, 0)
-
-		log.Debugln("src files root:", sourceFilesRoot)
-		err = filepath.WalkDir(sourceFilesRoot, func(path string, d fs.DirEntry, err error) error {
-			// return if not a directory
-			if !d.IsDir() {
-				return nil
-			}
-			// scan files in path
-			dirs, err := os.ReadDir(path)
-			if err != nil {
-				return err
-			}
-			// if this directory contains directories, skip
-			for _, dir := range dirs {
-				if dir.Type().IsDir() {
-					return nil
-				}
-			}
-			// output the last level directories
-			log.Debugln("found book directory at:", path)
-			bookDirs = append(bookDirs, path)
-			return nil
-		})
+		generateChapters, err := cmd.Flags().GetBool("generate-chapters")
 		if err != nil {
 			return err
 		}
 
-		// if no book directories were found, error out
-		if len(bookDirs) == 0 {
-			return errors.New("no book directories found in path")
-		}
-
-		for _, dir := range bookDirs {
+		err = runBatch(cmd, func(ctx context.Context, dir string, report *audiobooker.BookReport) (string, error) {
 			startTime := time.Now()
 
 			// create config struct and parse ENV variables for configs
 			config := audiobooker.Config{}
 			defer config.Cleanup()
 			if err := config.Parse(); err != nil {
-				return err
+				return "", err
 			}
 
 			config.ExternalChapters = useEmbedded
-
-			// watch for early terminations
-			go watchForTermSignals(&config)
+			config.PrefixPartNames = prefixPartNames
+			config.EmbedSourceFile = generateChapters
 
 			// generate and validate flags
 			if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
-				return err
+				return "", err
 			}
 
 			// validate full path formatting
@@ -122,83 +91,126 @@ The other way that split-chapters can be used is if the existing file already ha
 			// parse source based on pattern
 			pathTags, err := audiobooker.ParsePathTags(dir, fullPath)
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			// get the source files path to current book directory
 			config.SourceFilesPath = dir
+			// a relative EPUB file is named within each book directory
+			if config.EpubFile != "" && !filepath.IsAbs(config.EpubFile) {
+				config.EpubFile = filepath.Join(dir, config.EpubFile)
+			}
 
 			// create book instance and generate metadata from path
 			book := audiobooker.Book{}
 			book.ParseFromPattern(pathTags)
 
 			// initialize config
-			if err := config.New(); err != nil {
-				return err
+			if err := config.New(ctx); err != nil {
+				return "", err
+			}
+
+			// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+			if err := book.ParseFromEpub(config); err != nil {
+				return "", err
 			}
 			log.Debugln(book)
 
 			// compute output filename from metadata and patterns
 			if err := config.SetOutputFilename(book); err != nil {
-				return err
+				return "", err
 			}
 
 			fmt.Println("book found at:", dir)
 			for k, v := range pathTags {
 				fmt.Printf("%+15s: %s\n", k, v)
 			}
-			fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
+			outputPath := filepath.Join(config.OutputPath, config.OutputFile)
+			fmt.Printf("output filepath: %s\n\n", outputPath)
+			// describe the book as it's left, bound, planned, or failed
+			defer func() { report.Describe(ctx, config, book, pathTags) }()
+
+			// extract embedded chapters if instructed
+			if config.ExternalChapters {
+				fmt.Println("extracting existing chapters metadata instead of generating static chapters")
+				if err := book.ExtractChapters(ctx, config); err != nil {
+					return outputPath, err
+				}
+				changes, err := book.FinalizeChapters(ctx, config)
+				if err != nil {
+					return outputPath, err
+				}
+				printChapterChanges(changes)
+				printChapters(book.Chapters)
+			}
 
 			// if dry-run flag is given, output metadata for validation but don't convert
 			if dryRun {
+				// generated chapters are embedded without transcoding
+				if !generateChapters {
+					if err := printTranscodePlan(ctx, config); err != nil {
+						return outputPath, err
+					}
+				}
+				// list the chapters the book would get from its source files
+				if !config.ExternalChapters {
+					srcFile := config.SourceFilesPath
+					if !generateChapters {
+						srcFile = ""
+						config.PlanFromSourceFiles()
+					}
+					if err := book.GenerateStaticChapters(ctx, config, chapterLength, srcFile); err != nil {
+						return outputPath, err
+					}
+					changes, err := book.FinalizeChapters(ctx, config)
+					if err != nil {
+						return outputPath, err
+					}
+					printChapterChanges(changes)
+					printChapters(book.Chapters)
+				}
 				fmt.Printf("dry-run flag was set, skipping conversion\n\n")
-				continue
+				return outputPath, nil
 			}
 
 			// adds static chapters to .m4b audiobook file without transcoding
 			if generateChapters {
 				log.Infoln("Generating/Embedding static chapters and metadata")
-				if err := book.GenerateStaticChapters(config, chapterLength, config.SourceFilesPath); err != nil {
-					return err
+				if !config.ExternalChapters {
+					if err := book.GenerateStaticChapters(ctx, config, chapterLength, config.SourceFilesPath); err != nil {
+						return outputPath, err
+					}
 				}
 
 				// generate chapters metadata
-				if err := book.GenerateMetaTemplate(config); err != nil {
+				if err := book.GenerateMetaTemplate(ctx, config); err != nil {
 					log.Errorln(err)
-					return err
+					return outputPath, err
 				}
 
 				log.Debugln(book.Chapters)
 
 				// embed metadata
-				if err := audiobooker.Bind(config, book); err != nil {
+				if err := audiobooker.Bind(ctx, config, book); err != nil {
 					log.Errorln(err)
-					return err
+					return outputPath, err
 				}
 
-				continue
+				return outputPath, nil
 			}
 
 			log.Debugln("Beginning conversion")
 
-			// extract embedded chapters if instructed
-			if config.ExternalChapters {
-				fmt.Println("extracting exiting chapters metadata instead of generating static chapters")
-				if err := book.ExtractChapters(config); err != nil {
-					return err
-				}
-			}
-
 			// make output directory paths
 			if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
-				return err
+				return outputPath, err
 			}
-			if err := audiobooker.SplitSingleFile(&config); err != nil {
-				return err
+			if err := audiobooker.SplitSourceFiles(ctx, &config); err != nil {
+				return outputPath, err
 			}
 
-			if err := audiobooker.TranscodeSourceFiles(&config); err != nil {
-				return err
+			if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+				return outputPath, err
 			}
 
 			log.Debugln(book)
@@ -206,27 +218,31 @@ The other way that split-chapters can be used is if the existing file already ha
 			// Generate static chapters metadata for book
 			if !config.ExternalChapters {
 				fmt.Println("generating static chapters based on specified chapter length")
-				if err := book.GenerateStaticChapters(config, chapterLength, ""); err != nil {
-					return err
+				if err := book.GenerateStaticChapters(ctx, config, chapterLength, ""); err != nil {
+					return outputPath, err
 				}
 			}
 
 			// generate chapters metadata
-			if err := book.GenerateMetaTemplate(config); err != nil {
-				return err
+			if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+				return outputPath, err
 			}
 
 			// combine pre-transcode files
-			if err := audiobooker.Combine(config); err != nil {
-				return err
+			if err := audiobooker.Combine(ctx, config); err != nil {
+				return outputPath, err
 			}
 
 			// Apply metadata to output file
-			if err := audiobooker.Bind(config, book); err != nil {
-				return err
+			if err := audiobooker.Bind(ctx, config, book); err != nil {
+				return outputPath, err
 			}
 
 			notifyFinishedBook(book, startTime)
+			return outputPath, nil
+		})
+		if err != nil {
+			return err
 		}
 
 		fmt.Println("Entire process took:", time.Now().Sub(processStart))
@@ -240,5 +256,6 @@ func init() {
 
 	batchSplitCmd.Flags().IntP("chapter-length", "c", 5, "chapter length in minutes")
 	batchSplitCmd.Flags().Bool("use-embedded", false, "use existing embedded chapters")
+	batchSplitCmd.Flags().Bool("prefix-part-names", false, "prefix embedded chapter titles with the name of the source file they came from (with use-embedded)")
 	batchSplitCmd.Flags().Bool("generate-chapters", false, "generate chapters and embed them in and existing .m4b audiobook (no transcoding required)")
 }
@@ -85,8 +85,8 @@ var batchTagCmd = &cobra.Command{
 				return err
 			}
 
-			// watch for early terminations
-			go watchForTermSignals(&config)
+			// cancelled by early termination signals, which kills any running ffmpeg processes
+			ctx := cmd.Context()
 
 			// generate and validate flags, get around validation with hardcoded "none" for output file dest
 			if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
@@ -114,7 +114,7 @@ var batchTagCmd = &cobra.Command{
 			book.ParseFromPattern(pathTags)
 
 			// initialize config
-			if err := config.New(); err != nil {
+			if err := config.New(ctx); err != nil {
 				return err
 			}
 			log.Debugln(book)
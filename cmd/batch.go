@@ -4,10 +4,18 @@ Copyright © 2023 Chris Slamar chris@slamar.com
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -26,12 +34,30 @@ var batchCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(batchCmd)
 
+	batchCmd.PersistentFlags().String("cache-dir", "", "A directory to keep transcoded files in, so re-runs reuse them instead of transcoding the same source files again")
+	batchCmd.PersistentFlags().String("chapter-language", "", "The language of generated chapter titles (de, en, es, fr)")
+	batchCmd.PersistentFlags().String("chapter-title-template", "", "The template for generated chapter titles, supports {chapter}, {n}, {n:3} (zero padded), {words}, {roman}, {file}, and {tag} (default \"{chapter} {n}\")")
+	batchCmd.PersistentFlags().String("epub", "", "An EPUB file, relative to each book directory, whose table of contents titles the chapters, and whose metadata fills in what the path pattern doesn't (CUE sheets keep their own chapter titles)")
+	batchCmd.PersistentFlags().String("encoding-profile", "", "The encoding profile used when transcoding (he-aac-32k, high-quality-stereo-128k, spoken-mono-48k, spoken-mono-vbr) (default ffmpeg AAC defaults)")
+	batchCmd.PersistentFlags().StringSlice("export-chapters", nil, "Also write the chapters next to the output file in these formats (audacity, cue, ffmetadata, json, mp4chaps)")
+	batchCmd.PersistentFlags().Bool("keep-going", false, "Record the books that fail and carry on with the rest, exiting with an error at the end if any failed")
+	batchCmd.PersistentFlags().Float64("loudness-target", 0, "Measure the loudness of each book and correct it to this integrated loudness in LUFS (e.g. -18)")
+	batchCmd.PersistentFlags().Bool("merge-duplicate-titles", false, "Merge adjacent chapters whose titles match, ignoring case and punctuation")
+	batchCmd.PersistentFlags().Duration("merge-shorter-than", 0, "Merge chapters shorter than this (e.g. 30s) into the chapter after them")
+	batchCmd.PersistentFlags().Bool("force", false, "Bind every book again, even the ones the batch state file records as already bound")
 	batchCmd.PersistentFlags().StringP("file-pattern", "f", "", "The output filename, can be a combination of literal values and patterns")
 	batchCmd.PersistentFlags().IntP("jobs", "j", 1, "The number of concurrent transcoding process to run for conversion (don't exceed your cpu count)")
 	batchCmd.PersistentFlags().StringP("output-directory", "o", "", "The output directory for the final directory, can be combination of absolute values and path patterns")
+	batchCmd.PersistentFlags().String("output-format", "", "The format of the bound book (m4b, mp3, opus) (default \"m4b\")")
 	batchCmd.PersistentFlags().StringP("path-pattern", "p", "", "The pattern for metadata picked up via paths (starts from base of source-files-root)")
+	batchCmd.PersistentFlags().String("progress", "", "How to show the progress of transcoding and binding (bar, json, none) (default \"bar\")")
+	batchCmd.PersistentFlags().String("report", "", "Write a report of each book to this file, as JSON or CSV by its extension (.json, .csv), the planned books with --dry-run")
+	batchCmd.PersistentFlags().Bool("retry-failed", false, "Retry the books that failed on earlier runs, which are skipped otherwise")
 	batchCmd.PersistentFlags().String("scratch-files-path", "", "The location to generate the scratch directory")
 	batchCmd.PersistentFlags().StringP("source-files-root", "s", "", "The path to directory of source files (must match path-pattern for metadata to work)")
+	batchCmd.PersistentFlags().Bool("split-at-silence", false, "Move the splits of long chapters to the strongest nearby silence (requires split-longer-than)")
+	batchCmd.PersistentFlags().Duration("split-longer-than", 0, "Split chapters longer than this (e.g. 1h) into even parts")
+	batchCmd.PersistentFlags().Int("transcode-retries", 0, "Retry files that fail to transcode this many times, and keep transcoding the rest, instead of stopping at the first failure")
 	batchCmd.PersistentFlags().Bool("verbose-transcode", false, "Enable output of all ffmpeg commands/operations")
 
 	batchCmd.MarkPersistentFlagRequired("source-files-root")
@@ -58,6 +84,86 @@ func generateBatchOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 		config.PathPattern = pathPattern
 	}
 
+	// get chapter title template and language
+	chapterTitleTemplate, err := flags.GetString("chapter-title-template")
+	if err != nil {
+		return err
+	} else if chapterTitleTemplate != "" {
+		config.ChapterTitleTemplate = chapterTitleTemplate
+	}
+	chapterLanguage, err := flags.GetString("chapter-language")
+	if err != nil {
+		return err
+	} else if chapterLanguage != "" {
+		config.ChapterLanguage = chapterLanguage
+	}
+
+	// get chapter post-processing options
+	mergeDuplicates, err := flags.GetBool("merge-duplicate-titles")
+	if err != nil {
+		return err
+	} else if mergeDuplicates {
+		config.MergeDuplicateTitles = true
+	}
+	mergeShorter, err := flags.GetDuration("merge-shorter-than")
+	if err != nil {
+		return err
+	} else if mergeShorter > 0 {
+		config.MinChapterLength = mergeShorter
+	}
+	splitLonger, err := flags.GetDuration("split-longer-than")
+	if err != nil {
+		return err
+	} else if splitLonger > 0 {
+		config.MaxChapterLength = splitLonger
+	}
+	splitAtSilence, err := flags.GetBool("split-at-silence")
+	if err != nil {
+		return err
+	} else if splitAtSilence {
+		config.SplitAtSilence = true
+	}
+
+	// get chapter export formats
+	exportFormats, err := flags.GetStringSlice("export-chapters")
+	if err != nil {
+		return err
+	} else if len(exportFormats) > 0 {
+		config.ExportChapterFormats = exportFormats
+	}
+
+	// get transcode cache directory
+	cacheDir, err := flags.GetString("cache-dir")
+	if err != nil {
+		return err
+	} else if cacheDir != "" {
+		config.CacheDir = cacheDir
+	}
+
+	// get encoding profile
+	encodingProfile, err := flags.GetString("encoding-profile")
+	if err != nil {
+		return err
+	} else if encodingProfile != "" {
+		config.EncodingProfile = encodingProfile
+	}
+
+	// get loudness target
+	loudnessTarget, err := flags.GetFloat64("loudness-target")
+	if err != nil {
+		return err
+	} else if loudnessTarget != 0 {
+		config.LoudnessTarget = loudnessTarget
+	}
+
+	// get output format
+	outputFormat, err := flags.GetString("output-format")
+	if err != nil {
+		return err
+	} else if outputFormat != "" {
+		config.OutputFormat = outputFormat
+	}
+
 	// get file pattern
 	filePatten, err := flags.GetString("file-pattern")
 	if err != nil {
@@ -66,6 +172,20 @@ func generateBatchOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 		config.OutputFilePattern = filePatten
 	}
 
+	// get progress mode
+	progressMode, err := flags.GetString("progress")
+	if err != nil {
+		return err
+	}
+
+	// get transcode retries
+	transcodeRetries, err := flags.GetInt("transcode-retries")
+	if err != nil {
+		return err
+	} else if transcodeRetries != 0 {
+		config.TranscodeRetries = transcodeRetries
+	}
+
 	// get jobs count
 	jobs, err := flags.GetInt("jobs")
 	if err != nil {
@@ -83,6 +203,14 @@ func generateBatchOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 		config.OutputPathPattern = outputDir
 	}
 
+	// get EPUB file
+	epubFile, err := flags.GetString("epub")
+	if err != nil {
+		return err
+	} else if epubFile != "" {
+		config.EpubFile = epubFile
+	}
+
 	// get scratch directory
 	scratchFilesPath, err := flags.GetString("scratch-files-path")
 	if err != nil {
@@ -105,10 +233,52 @@ func generateBatchOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 	if config.PathPattern == "" && pathPattern == "" {
 		return errors.New("path pattern must be defined")
 	}
+	// validate chapter language
+	if config.ChapterLanguage != "" {
+		if err := audiobooker.CheckChapterLanguage(config.ChapterLanguage); err != nil {
+			return err
+		}
+	}
+	// validate chapter post-processing options
+	if err := config.ValidateChapterProcessing(); err != nil {
+		return err
+	}
+	// validate chapter export formats
+	for _, format := range config.ExportChapterFormats {
+		if err := audiobooker.CheckChapterFormat(format); err != nil {
+			return err
+		}
+	}
+	// validate encoding profile
+	if config.EncodingProfile != "" {
+		if err := audiobooker.CheckEncodingProfile(config.EncodingProfile); err != nil {
+			return err
+		}
+	}
+	// validate loudness target
+	if config.LoudnessTarget != 0 {
+		if err := audiobooker.CheckLoudnessTarget(config.LoudnessTarget); err != nil {
+			return err
+		}
+	}
+	// validate output format
+	if config.OutputFormat != "" {
+		if err := audiobooker.CheckOutputFormat(config.OutputFormat); err != nil {
+			return err
+		}
+	}
 	// validate jobs
 	if config.Jobs <= 0 {
 		return errors.New("jobs must be greater than 0")
 	}
+	// validate transcode retries
+	if config.TranscodeRetries < 0 {
+		return errors.New("transcode-retries must not be negative")
+	}
+	// validate progress mode
+	if err := setProgressReporter(config, progressMode); err != nil {
+		return err
+	}
 
 	// validate output destination in config struct TODO move this validation somewhere not global
 	//if config.OutputFileDest == "" {
@@ -117,3 +287,272 @@ func generateBatchOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 
 	return nil
 }
+
+// outcomes of the books of a batch run
+const (
+	batchStatusBound   = "bound"
+	batchStatusPlanned = "planned"
+	batchStatusSkipped = "skipped"
+	batchStatusFailed  = "failed"
+)
+
+// batchResult outcome of a book of a batch run
+type batchResult struct {
+	dir      string
+	status   string
+	duration time.Duration
+	reason   string
+	err      error
+	report   audiobooker.BookReport
+}
+
+// batchBook binds the book in a source directory, describing it in the report, and returns the path of the bound book once it's known
+type batchBook func(ctx context.Context, dir string, report *audiobooker.BookReport) (string, error)
+
+// findBookDirs returns the directories under the source files root that contain books, the directories without any subdirectories
+func findBookDirs(sourceFilesRoot string) ([]string, error) {
+	// slice of directories that contain books
+	bookDirs := make([]string, 0)
+
+	log.Debugln("src files root:", sourceFilesRoot)
+	err := filepath.WalkDir(sourceFilesRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// return if not a directory
+		if !d.IsDir() {
+			return nil
+		}
+		// scan files in path
+		dirs, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		// if this directory contains directories, skip
+		for _, dir := range dirs {
+			if dir.Type().IsDir() {
+				return nil
+			}
+		}
+		// output the last level directories
+		log.Debugln("found book directory at:", path)
+		bookDirs = append(bookDirs, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// if no book directories were found, error out
+	if len(bookDirs) == 0 {
+		return nil, errors.New("no book directories found in path")
+	}
+
+	return bookDirs, nil
+}
+
+// runBatch binds the book of each book directory under the source files root, recording the state of each book in the batch state file of the output root, and skipping the books whose sources haven't changed since they were bound or failed
+func runBatch(cmd *cobra.Command, bindBook batchBook) error {
+	sourceFilesRoot, err := cmd.Flags().GetString("source-files-root")
+	if err != nil {
+		return err
+	}
+	retryFailed, err := cmd.Flags().GetBool("retry-failed")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	keepGoing, err := cmd.Flags().GetBool("keep-going")
+	if err != nil {
+		return err
+	}
+	reportPath, err := cmd.Flags().GetString("report")
+	if err != nil {
+		return err
+	} else if reportPath != "" {
+		// fail before binding anything rather than after
+		if err := audiobooker.CheckReportFormat(reportPath); err != nil {
+			return err
+		}
+	}
+
+	bookDirs, err := findBookDirs(sourceFilesRoot)
+	if err != nil {
+		return err
+	}
+
+	// the state file is kept in the directory every book is bound under
+	config := audiobooker.Config{}
+	if err := config.Parse(); err != nil {
+		return err
+	}
+	if err := generateBatchOpts(&config, cmd.Flags()); err != nil {
+		return err
+	}
+	statePath := filepath.Join(audiobooker.BatchOutputRoot(config.OutputPathPattern), audiobooker.BatchStateFilename)
+	state, err := audiobooker.LoadBatchState(statePath)
+	if err != nil {
+		return err
+	}
+	log.Debugln("batch state file:", statePath)
+
+	// cancelled by early termination signals, which kills any running ffmpeg processes
+	ctx := cmd.Context()
+
+	// the progress of each book is reported with the totals of the batch
+	activeBatch = &batchProgress{books: len(bookDirs)}
+	defer func() { activeBatch = nil }()
+
+	results := make([]batchResult, 0, len(bookDirs))
+	for idx, dir := range bookDirs {
+		activeBatch.startBook(idx + 1)
+		result, err := bindBatchBook(ctx, state, dir, bindBook, retryFailed, force)
+		if err != nil {
+			// the state file can't be trusted anymore
+			return err
+		}
+		results = append(results, result)
+		if result.err != nil && (!keepGoing || ctx.Err() != nil) {
+			break
+		}
+		if result.err != nil {
+			log.Errorf("failed to bind book at %s, carrying on with the next book: %v", dir, result.err)
+		}
+	}
+	printBatchSummary(results, len(bookDirs))
+	if reportPath != "" {
+		reports := make([]audiobooker.BookReport, len(results))
+		for idx, result := range results {
+			reports[idx] = result.report
+		}
+		if err := audiobooker.WriteBatchReport(reportPath, reports); err != nil {
+			return err
+		}
+		fmt.Printf("report written to: %s\n\n", reportPath)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			if !keepGoing {
+				return result.err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d books failed", failed, len(bookDirs))
+	}
+
+	return nil
+}
+
+// bindBatchBook binds the book of a directory unless the batch state says to skip it, recording the outcome in the state, errors are only returned when the state file can't be written
+func bindBatchBook(ctx context.Context, state *audiobooker.BatchState, dir string, bindBook batchBook, retryFailed, force bool) (result batchResult, err error) {
+	result = batchResult{dir: dir, status: batchStatusFailed, report: audiobooker.BookReport{SourceDir: dir}}
+	start := time.Now()
+	defer func() {
+		result.duration = time.Since(start)
+		result.report.Status = result.status
+		result.report.Reason = result.reason
+		result.report.Elapsed = result.duration
+		if result.status == batchStatusBound {
+			result.report.MeasureOutputSize()
+		}
+		if result.err != nil {
+			result.report.Error = result.err.Error()
+		}
+	}()
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		result.err = err
+		return result, nil
+	}
+	result.report.SourceDir = absDir
+	fingerprint, err := audiobooker.SourceFingerprint(dir)
+	if err != nil {
+		result.err = err
+		return result, nil
+	}
+	process, reason := state.ShouldProcess(absDir, fingerprint, retryFailed, force)
+	result.reason = reason
+	if !process {
+		fmt.Printf("skipping book at %s: %s\n\n", dir, reason)
+		result.status = batchStatusSkipped
+		if previous := state.Books[absDir]; previous != nil {
+			result.report.OutputFile = previous.OutputPath
+		}
+		return result, nil
+	}
+	log.Debugf("binding book at %s: %s", dir, reason)
+
+	// a dry-run leaves the state as it was
+	if dryRun {
+		if _, result.err = bindBook(ctx, dir, &result.report); result.err == nil {
+			result.status = batchStatusPlanned
+		}
+		return result, nil
+	}
+
+	previousOutput := ""
+	if previous := state.Books[absDir]; previous != nil {
+		previousOutput = previous.OutputPath
+	}
+	if err := state.Update(absDir, audiobooker.BookStatusPending, previousOutput, fingerprint, nil); err != nil {
+		return result, err
+	}
+
+	outputPath, err := bindBook(ctx, dir, &result.report)
+	// the bound book is checked for from wherever later runs are started
+	if outputPath != "" {
+		if absOutput, absErr := filepath.Abs(outputPath); absErr == nil {
+			outputPath = absOutput
+		}
+	}
+	if err != nil {
+		result.err = err
+		// an interrupted book stays pending, and is bound again on the next run
+		if ctx.Err() != nil {
+			return result, nil
+		}
+		return result, state.Update(absDir, audiobooker.BookStatusFailed, outputPath, fingerprint, err)
+	}
+
+	result.status = batchStatusBound
+	return result, state.Update(absDir, audiobooker.BookStatusDone, outputPath, fingerprint, nil)
+}
+
+// printBatchSummary outputs a table of the outcome of each book of the batch run, with the number of books left unprocessed
+func printBatchSummary(results []batchResult, total int) {
+	counts := make(map[string]int)
+	fmt.Println("\nbatch summary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tBOOK\tDURATION\tREASON")
+	for _, result := range results {
+		counts[result.status]++
+		duration := "-"
+		if result.status != batchStatusSkipped {
+			duration = result.duration.Round(time.Second).String()
+		}
+		reason := result.reason
+		if result.err != nil {
+			// only the first line of multi-line errors, such as transcode failures, fits the table
+			reason, _, _ = strings.Cut(result.err.Error(), "\n")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.status, result.dir, duration, reason)
+	}
+	w.Flush()
+
+	fmt.Printf("%d bound, %d planned, %d skipped, %d failed", counts[batchStatusBound], counts[batchStatusPlanned], counts[batchStatusSkipped], counts[batchStatusFailed])
+	if remaining := total - len(results); remaining > 0 {
+		fmt.Printf(", %d not started", remaining)
+	}
+	fmt.Printf("\n\n")
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// bindCueCmd represents the cue command
+var bindCueCmd = &cobra.Command{
+	Use:   "cue",
+	Short: "Bind audiobook using a CUE sheet for the chapters",
+	Long: `Bind audiobook using the standalone '.cue' file found in the source files path for the chapters.
+
+Each TRACK of the CUE sheet becomes a chapter, with tracks spanning multiple FILE entries offset by the length of the files before them.  The source files are bound in the order they're listed in the CUE sheet.  The title, performer, genre, and date of the CUE sheet are used for any book metadata not supplied by the path pattern.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("Starting bind from CUE sheet\n\n")
+		processStart := time.Now()
+		var err error
+
+		// create config struct and parse ENV variables for configs
+		config := audiobooker.Config{}
+		defer config.Cleanup()
+		if err := config.Parse(); err != nil {
+			return err
+		}
+
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
+
+		// generate and validate configs
+		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
+			return err
+		}
+		// populate Config
+		if err := config.New(ctx); err != nil {
+			return err
+		}
+
+		pathTags, err := audiobooker.ParsePathTags(config.SourceFilesPath, config.PathPattern) // TODO change this to pass in just the config struct
+		if err != nil {
+			return err
+		}
+
+		book := audiobooker.Book{}
+		book.ParseFromPattern(pathTags)
+
+		// parse the CUE sheet into chapters and fill in missing metadata
+		if err := book.ChapterByCueSheet(ctx, &config); err != nil {
+			return err
+		}
+
+		// fill in missing metadata from an EPUB, the CUE sheet titles its own chapters
+		if err := book.ParseFromEpub(config); err != nil {
+			return err
+		}
+
+		if err := config.SetOutputFilename(book); err != nil {
+			return err
+		}
+
+		for k, v := range pathTags {
+			fmt.Printf("%+15s: %s\n", k, v)
+		}
+		fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
+		changes, err := book.FinalizeChapters(ctx, config)
+		if err != nil {
+			return err
+		}
+		printChapterChanges(changes)
+		printChapters(book.Chapters)
+
+		// if dry-run flag is given, output metadata for validation but don't convert
+		if dryRun {
+			if err := printTranscodePlan(ctx, config); err != nil {
+				return err
+			}
+			fmt.Println("dry-run flag was set, skipping conversion, but outputting meta")
+			return nil
+		}
+		log.Debugln(book)
+
+		// make output directory paths
+		if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+			return err
+		}
+
+		if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+			return err
+		}
+
+		// Generate metadata for book
+		if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+			return err
+		}
+
+		// combine pre-transcode files
+		if err := audiobooker.Combine(ctx, config); err != nil {
+			return err
+		}
+
+		// Apply metadata to output file
+		if err := audiobooker.Bind(ctx, config, book); err != nil {
+			return err
+		}
+
+		notifyFinishedBook(book, processStart)
+		fmt.Println("fin.")
+
+		return nil
+	},
+}
+
+func init() {
+	bindCmd.AddCommand(bindCueCmd)
+}
@@ -4,6 +4,7 @@ Copyright © 2022 Chris Slamar chris@slamar.com
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cslamar/audiobooker/audiobooker"
 	log "github.com/sirupsen/logrus"
@@ -17,7 +18,9 @@ import (
 var filesCmd = &cobra.Command{
 	Use:   "files",
 	Short: "Bind audiobook using each file as a chapter",
-	Long:  `Bind audiobook using each file as a chapter using either the source audio filename as the chapter name, or the source audio file's "title" metadata tag as the chapter name.'`,
+	Long: `Bind audiobook using each file as a chapter using either the source audio filename as the chapter name, or the source audio file's "title" metadata tag as the chapter name.'
+
+When the source files already have chapters, like a book released in parts, passing the '--use-embedded' flag keeps the chapters of every file instead, and '--prefix-part-names' adds the name of each file to its chapter titles.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Starting bind by filename\n\n")
 		processStart := time.Now()
@@ -32,6 +35,21 @@ var filesCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		chapterListFile, err := cmd.Flags().GetString("chapters-file")
+		if err != nil {
+			return err
+		}
+		useEmbedded, err := cmd.Flags().GetBool("use-embedded")
+		if err != nil {
+			return err
+		}
+		prefixPartNames, err := cmd.Flags().GetBool("prefix-part-names")
+		if err != nil {
+			return err
+		}
+		if useEmbedded && chapterListFile != "" {
+			return errors.New("use-embedded and chapters-file can't be used together")
+		}
 
 		// create config struct and parse ENV variables for configs
 		config := audiobooker.Config{}
@@ -40,15 +58,19 @@ var filesCmd = &cobra.Command{
 			return err
 		}
 
-		// watch for early terminations
-		go watchForTermSignals(&config)
+		config.ChapterListFile = chapterListFile
+		config.ExternalChapters = useEmbedded
+		config.PrefixPartNames = prefixPartNames
+
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
 
 		// generate and validate configs
 		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
 			return err
 		}
 		// populate Config
-		if err := config.New(); err != nil {
+		if err := config.New(ctx); err != nil {
 			return err
 		}
 
@@ -59,6 +81,12 @@ var filesCmd = &cobra.Command{
 
 		book := audiobooker.Book{}
 		book.ParseFromPattern(pathTags)
+
+		// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+		if err := book.ParseFromEpub(config); err != nil {
+			return err
+		}
+
 		if err := config.SetOutputFilename(book); err != nil {
 			return err
 		}
@@ -68,8 +96,37 @@ var filesCmd = &cobra.Command{
 		}
 		fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
 
+		// use the chapters from the chapter list file instead of generating them
+		if config.ChapterListFile != "" {
+			if err := book.ChapterByList(ctx, config); err != nil {
+				return err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+		}
+
+		// keep the chapters embedded in the source files instead of generating them
+		if config.ExternalChapters {
+			if err := book.ExtractChapters(ctx, config); err != nil {
+				return err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+		}
+
 		// if dry-run flag is given, output metadata for validation but don't convert
 		if dryRun {
+			if err := printTranscodePlan(ctx, config); err != nil {
+				return err
+			}
 			fmt.Println("dry-run flag was set, skipping conversion, but outputting meta")
 			return nil
 		}
@@ -80,28 +137,30 @@ var filesCmd = &cobra.Command{
 			return err
 		}
 
-		if err := audiobooker.TranscodeSourceFiles(&config); err != nil {
+		if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
 			return err
 		}
 
-		if err := book.ChapterByFile(config, useFileNames, useTitleTag); err != nil {
-			return err
+		if config.ChapterListFile == "" && !config.ExternalChapters {
+			if err := book.ChapterByFile(ctx, config, useFileNames, useTitleTag); err != nil {
+				return err
+			}
 		}
 
 		log.Debugln(book)
 
 		// Generate metadata for book
-		if err := book.GenerateMetaTemplate(config); err != nil {
+		if err := book.GenerateMetaTemplate(ctx, config); err != nil {
 			return err
 		}
 
 		// combine pre-transcode files
-		if err := audiobooker.Combine(config); err != nil {
+		if err := audiobooker.Combine(ctx, config); err != nil {
 			return err
 		}
 
 		// Apply metadata to output file
-		if err := audiobooker.Bind(config, book); err != nil {
+		if err := audiobooker.Bind(ctx, config, book); err != nil {
 			return err
 		}
 
@@ -115,8 +174,11 @@ var filesCmd = &cobra.Command{
 
 func init() {
 	bindCmd.AddCommand(filesCmd)
+	filesCmd.Flags().String("chapters-file", "", "A chapter list file (audacity labels, cue, ffmetadata, json, mp4chaps, ogm, or \"HH:MM:SS Title\" lines) to use instead of generating chapters")
 	filesCmd.Flags().Bool("file-name", false, "Use the name of the file as the chapter name")
+	filesCmd.Flags().Bool("prefix-part-names", false, "Prefix embedded chapter titles with the name of the file they came from (with use-embedded)")
 	filesCmd.Flags().Bool("title-tag", false, "Use the file's title tag as the chapter name")
+	filesCmd.Flags().Bool("use-embedded", false, "Keep the chapters embedded in each source file instead of making a chapter per file")
 
 	// Here you will define your flags and configuration settings.
 
@@ -22,6 +22,12 @@ var bindFromTagsCmd = &cobra.Command{
 		processStart := time.Now()
 		var err error
 
+		// Parse scoped options
+		chapterListFile, err := cmd.Flags().GetString("chapters-file")
+		if err != nil {
+			return err
+		}
+
 		// create config struct and parse ENV variables for configs
 		config := audiobooker.Config{}
 		defer config.Cleanup()
@@ -29,14 +35,16 @@ var bindFromTagsCmd = &cobra.Command{
 			return err
 		}
 
-		// watch for early terminations
-		go watchForTermSignals(&config)
+		config.ChapterListFile = chapterListFile
+
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
 
 		// generate and validate configs
 		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
 			return err
 		}
-		if err := config.New(); err != nil {
+		if err := config.New(ctx); err != nil {
 			return err
 		}
 
@@ -47,6 +55,12 @@ var bindFromTagsCmd = &cobra.Command{
 
 		book := audiobooker.Book{}
 		book.ParseFromPattern(pathTags)
+
+		// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+		if err := book.ParseFromEpub(config); err != nil {
+			return err
+		}
+
 		if err := config.SetOutputFilename(book); err != nil {
 			return err
 		}
@@ -56,35 +70,53 @@ var bindFromTagsCmd = &cobra.Command{
 		}
 		fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
 
+		// use the chapters from the chapter list file instead of generating them
+		if config.ChapterListFile != "" {
+			if err := book.ChapterByList(ctx, config); err != nil {
+				return err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+		}
+
 		if dryRun {
+			if err := printTranscodePlan(ctx, config); err != nil {
+				return err
+			}
 			fmt.Println("dry-run flag was set, skipping conversion, but outputting meta")
 			return nil
 		}
 		log.Debugln(book)
 
-		if err := audiobooker.TranscodeSourceFiles(&config); err != nil {
+		if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
 			return err
 		}
 
 		// Parse files to chapters inside Book struct/object
-		if err := book.ParseToChapters(config); err != nil {
-			return err
+		if config.ChapterListFile == "" {
+			if err := book.ParseToChapters(ctx, config); err != nil {
+				return err
+			}
 		}
 
 		log.Debugln(book)
 
 		// Generate metadata for book
-		if err := book.GenerateMetaTemplate(config); err != nil {
+		if err := book.GenerateMetaTemplate(ctx, config); err != nil {
 			return err
 		}
 
 		// combine pre-transcode files
-		if err := audiobooker.Combine(config); err != nil {
+		if err := audiobooker.Combine(ctx, config); err != nil {
 			return err
 		}
 
 		// Apply metadata to output file
-		if err := audiobooker.Bind(config, book); err != nil {
+		if err := audiobooker.Bind(ctx, config, book); err != nil {
 			return err
 		}
 
@@ -97,6 +129,7 @@ var bindFromTagsCmd = &cobra.Command{
 
 func init() {
 	bindCmd.AddCommand(bindFromTagsCmd)
+	bindFromTagsCmd.Flags().String("chapters-file", "", "A chapter list file (audacity labels, cue, ffmetadata, json, mp4chaps, ogm, or \"HH:MM:SS Title\" lines) to use instead of generating chapters")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,195 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// bindSilenceCmd represents the silence command
+var bindSilenceCmd = &cobra.Command{
+	Use:   "silence",
+	Short: "Splits a single audio file into chapters at detected silences",
+	Long: `Bind silence will split a single file into a chapter marked audiobook file using the silences detected in the audio.
+
+Any silence quieter than '--noise-db' and longer than '--min-silence' (in seconds) becomes a chapter mark, placed in the middle of the silence.  Marks that would create a chapter shorter than '--min-chapter-length' (in minutes) are skipped.
+
+When the number of chapters is known, '--chapters' will rank every detected silence by its length and depth and only use the strongest ones, keeping at least '--min-chapter-length' between them, to create exactly that many chapters.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("Starting silence chapter bind\n\n")
+		processStart := time.Now()
+		var err error
+
+		silenceOpts, err := generateSilenceOpts(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		// create config struct and parse ENV variables for configs
+		config := audiobooker.Config{}
+		defer config.Cleanup()
+		if err := config.Parse(); err != nil {
+			return err
+		}
+
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
+
+		// generate and validate configs
+		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
+			return err
+		}
+		// populate Config
+		if err := config.New(ctx); err != nil {
+			return err
+		}
+		pathTags, err := audiobooker.ParsePathTags(config.SourceFilesPath, config.PathPattern) // TODO change this to pass in just the config struct
+		if err != nil {
+			return err
+		}
+
+		book := audiobooker.Book{}
+		book.ParseFromPattern(pathTags)
+
+		// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+		if err := book.ParseFromEpub(config); err != nil {
+			return err
+		}
+
+		if err := config.SetOutputFilename(book); err != nil {
+			return err
+		}
+
+		// TODO find a better/cleaner/nicer way of handling extensions
+		if extension := config.OutputExtension(); strings.HasSuffix(config.OutputFile, extension+extension) {
+			config.OutputFile = strings.TrimSuffix(config.OutputFile, extension)
+		}
+
+		// output parsed metadata
+		for k, v := range pathTags {
+			fmt.Printf("%+15s: %s\n", k, v)
+		}
+		fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
+
+		// detect the silences and create the chapters from them
+		selections, err := book.ChapterBySilence(ctx, config, config.SourceFilesPath, silenceOpts)
+		if dryRun {
+			printMarkerSelections(selections)
+		}
+		if err != nil {
+			return err
+		}
+		// post-process and title the chapters
+		changes, err := book.FinalizeChapters(ctx, config)
+		if err != nil {
+			return err
+		}
+		printChapterChanges(changes)
+		printChapters(book.Chapters)
+
+		if dryRun {
+			if err := printTranscodePlan(ctx, config); err != nil {
+				return err
+			}
+			fmt.Println("dry-run flag was set, skipping conversion, but outputting meta")
+			return nil
+		}
+		log.Debugln(book)
+
+		// make output directory paths
+		if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
+			return err
+		}
+
+		if err := audiobooker.SplitSingleFile(ctx, &config); err != nil {
+			return err
+		}
+
+		if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
+			return err
+		}
+
+		// Generate metadata for book
+		if err := book.GenerateMetaTemplate(ctx, config); err != nil {
+			return err
+		}
+
+		// combine pre-transcode files
+		if err := audiobooker.Combine(ctx, config); err != nil {
+			return err
+		}
+
+		// Apply metadata to output file
+		if err := audiobooker.Bind(ctx, config, book); err != nil {
+			return err
+		}
+
+		notifyFinishedBook(book, processStart)
+		fmt.Println("fin.")
+
+		return nil
+	},
+}
+
+func init() {
+	bindCmd.AddCommand(bindSilenceCmd)
+	// define flags for this command
+	bindSilenceCmd.Flags().Int("chapters", 0, "target number of chapters, picks the strongest silences as chapter marks (0 uses every detected silence)")
+	bindSilenceCmd.Flags().Int("noise-db", -30, "noise floor (in dB) below which audio is considered silence")
+	bindSilenceCmd.Flags().Float64("min-silence", 2.5, "minimum length of silence (in seconds) to use as a chapter mark")
+	bindSilenceCmd.Flags().Float64("min-chapter-length", 1, "minimum chapter length in minutes")
+}
+
+// generateSilenceOpts configures and validates silence detection flags
+func generateSilenceOpts(flags *pflag.FlagSet) (audiobooker.SilenceOptions, error) {
+	opts := audiobooker.SilenceOptions{}
+
+	chapters, err := flags.GetInt("chapters")
+	if err != nil {
+		return opts, err
+	}
+	noiseDb, err := flags.GetInt("noise-db")
+	if err != nil {
+		return opts, err
+	}
+	minSilence, err := flags.GetFloat64("min-silence")
+	if err != nil {
+		return opts, err
+	}
+	minChapterLength, err := flags.GetFloat64("min-chapter-length")
+	if err != nil {
+		return opts, err
+	}
+
+	// validate selected options
+	if chapters < 0 {
+		return opts, errors.New("chapters must not be negative")
+	}
+	if noiseDb >= 0 {
+		return opts, errors.New("noise-db must be less than 0")
+	}
+	if minSilence <= 0 {
+		return opts, errors.New("min-silence must be greater than 0")
+	}
+	if minChapterLength < 0 {
+		return opts, errors.New("min-chapter-length must not be negative")
+	}
+
+	opts.Chapters = chapters
+	opts.NoiseDb = noiseDb
+	opts.MinSilence = minSilence
+	opts.MinChapterLengthMs = int64(minChapterLength * 60 * 1000)
+
+	return opts, nil
+}
@@ -4,6 +4,7 @@ Copyright © 2022 Chris Slamar chris@slamar.com
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cslamar/audiobooker/audiobooker"
 	log "github.com/sirupsen/logrus"
@@ -23,7 +24,9 @@ var splitChaptersCmd = &cobra.Command{
 
 First a static number (in minutes) can be passed in to make hard chapter marks at the specified duration.  Each mark will result in chapter metadata being created at those increments with the name "Chapter X" (where X in the index).
 
-The other way that split-chapters can be used is if the existing file already has metadata embedded.  Passing in the '--use-embedded' flag will use that metadata when creating the chapters for the new audiobook file.`,
+The other way that split-chapters can be used is if the existing file already has metadata embedded.  Passing in the '--use-embedded' flag will use that metadata when creating the chapters for the new audiobook file.  When the source is a directory of chaptered files, like one file per part, the chapters of every file are kept, and '--prefix-part-names' adds the name of each file to its chapter titles.
+
+Chapter marks kept in another tool can be used instead by passing a chapter list file with the '--chapters-file' flag.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Starting split chatper bind\n\n")
 		processStart := time.Now()
@@ -37,10 +40,21 @@ The other way that split-chapters can be used is if the existing file already ha
 		if err != nil {
 			return err
 		}
+		prefixPartNames, err := cmd.Flags().GetBool("prefix-part-names")
+		if err != nil {
+			return err
+		}
 		generateChapters, err := cmd.Flags().GetBool("generate-chapters")
 		if err != nil {
 			return err
 		}
+		chapterListFile, err := cmd.Flags().GetString("chapters-file")
+		if err != nil {
+			return err
+		}
+		if useEmbedded && chapterListFile != "" {
+			return errors.New("use-embedded and chapters-file can't be used together")
+		}
 		// create config struct and parse ENV variables for configs
 		config := audiobooker.Config{}
 		defer config.Cleanup()
@@ -49,16 +63,19 @@ The other way that split-chapters can be used is if the existing file already ha
 		}
 
 		config.ExternalChapters = useEmbedded
+		config.PrefixPartNames = prefixPartNames
+		config.ChapterListFile = chapterListFile
+		config.EmbedSourceFile = generateChapters
 
-		// watch for early terminations
-		go watchForTermSignals(&config)
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
 
 		// generate and validate configs
 		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
 			return err
 		}
 		// populate Config
-		if err := config.New(); err != nil {
+		if err := config.New(ctx); err != nil {
 			return err
 		}
 		pathTags, err := audiobooker.ParsePathTags(config.SourceFilesPath, config.PathPattern) // TODO change this to pass in just the config struct
@@ -68,13 +85,19 @@ The other way that split-chapters can be used is if the existing file already ha
 
 		book := audiobooker.Book{}
 		book.ParseFromPattern(pathTags)
+
+		// fill in missing metadata from an EPUB, keeping its table of contents for the chapter titles
+		if err := book.ParseFromEpub(config); err != nil {
+			return err
+		}
+
 		if err := config.SetOutputFilename(book); err != nil {
 			return err
 		}
 
 		// TODO find a better/cleaner/nicer way of handling extensions
-		if strings.HasSuffix(config.OutputFile, ".m4b.m4b") {
-			config.OutputFile = strings.TrimSuffix(config.OutputFile, ".m4b")
+		if extension := config.OutputExtension(); strings.HasSuffix(config.OutputFile, extension+extension) {
+			config.OutputFile = strings.TrimSuffix(config.OutputFile, extension)
 		}
 
 		// output parsed metadata
@@ -83,7 +106,40 @@ The other way that split-chapters can be used is if the existing file already ha
 		}
 		fmt.Printf("output filepath: %s\n\n", filepath.Join(config.OutputPath, config.OutputFile))
 
+		// use the chapters from the chapter list file instead of generating them
+		if config.ChapterListFile != "" {
+			if err := book.ChapterByList(ctx, config); err != nil {
+				return err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+		}
+
+		// extract embedded chapters if instructed
+		if config.ExternalChapters {
+			fmt.Println("extracting existing chapters metadata instead of generating static chapters")
+			if err := book.ExtractChapters(ctx, config); err != nil {
+				return err
+			}
+			changes, err := book.FinalizeChapters(ctx, config)
+			if err != nil {
+				return err
+			}
+			printChapterChanges(changes)
+			printChapters(book.Chapters)
+		}
+
 		if dryRun {
+			// generated chapters are embedded without transcoding
+			if !generateChapters {
+				if err := printTranscodePlan(ctx, config); err != nil {
+					return err
+				}
+			}
 			fmt.Println("dry-run flag was set, skipping conversion, but outputting meta")
 			return nil
 		}
@@ -92,12 +148,14 @@ The other way that split-chapters can be used is if the existing file already ha
 		// process the chapter split and generate a chapters metadata file only, no encoding
 		if generateChapters {
 			log.Infoln("Generating/Embedding static chapters and metadata")
-			if err := book.GenerateStaticChapters(config, chapterLength, config.SourceFilesPath); err != nil {
-				return err
+			if !config.ExternalChapters && config.ChapterListFile == "" {
+				if err := book.GenerateStaticChapters(ctx, config, chapterLength, config.SourceFilesPath); err != nil {
+					return err
+				}
 			}
 
 			// generate chapters metadata
-			if err := book.GenerateMetaTemplate(config); err != nil {
+			if err := book.GenerateMetaTemplate(ctx, config); err != nil {
 				log.Errorln(err)
 				return err
 			}
@@ -105,7 +163,7 @@ The other way that split-chapters can be used is if the existing file already ha
 			log.Debugln(book.Chapters)
 
 			// embed metadata
-			if err := audiobooker.Bind(config, book); err != nil {
+			if err := audiobooker.Bind(ctx, config, book); err != nil {
 				log.Errorln(err)
 				return err
 			}
@@ -113,30 +171,22 @@ The other way that split-chapters can be used is if the existing file already ha
 			return nil
 		}
 
-		// extract embedded chapters if instructed
-		if config.ExternalChapters {
-			fmt.Println("extracting exiting chapters metadata instead of generating static chapters")
-			if err := book.ExtractChapters(config); err != nil {
-				return err
-			}
-		}
-
 		// make output directory paths
 		if err := os.MkdirAll(config.OutputPath, 0755); err != nil {
 			return err
 		}
 
-		if err := audiobooker.SplitSingleFile(&config); err != nil {
+		if err := audiobooker.SplitSourceFiles(ctx, &config); err != nil {
 			return err
 		}
 
-		if err := audiobooker.TranscodeSourceFiles(&config); err != nil {
+		if err := audiobooker.TranscodeSourceFiles(ctx, &config); err != nil {
 			return err
 		}
 
-		if !config.ExternalChapters {
+		if !config.ExternalChapters && config.ChapterListFile == "" {
 			fmt.Println("generating static chapters based on specified chapter length")
-			if err := book.GenerateStaticChapters(config, chapterLength, ""); err != nil {
+			if err := book.GenerateStaticChapters(ctx, config, chapterLength, ""); err != nil {
 				return err
 			}
 		}
@@ -144,17 +194,17 @@ The other way that split-chapters can be used is if the existing file already ha
 		log.Debugln(book)
 
 		// Generate metadata for book
-		if err := book.GenerateMetaTemplate(config); err != nil {
+		if err := book.GenerateMetaTemplate(ctx, config); err != nil {
 			return err
 		}
 
 		// combine pre-transcode files
-		if err := audiobooker.Combine(config); err != nil {
+		if err := audiobooker.Combine(ctx, config); err != nil {
 			return err
 		}
 
 		// Apply metadata to output file
-		if err := audiobooker.Bind(config, book); err != nil {
+		if err := audiobooker.Bind(ctx, config, book); err != nil {
 			return err
 		}
 
@@ -170,5 +220,7 @@ func init() {
 	// define flags for this command
 	splitChaptersCmd.Flags().IntP("chapter-length", "c", 5, "chapter length in minutes")
 	splitChaptersCmd.Flags().Bool("use-embedded", false, "use existing embedded chapters")
+	splitChaptersCmd.Flags().Bool("prefix-part-names", false, "prefix embedded chapter titles with the name of the source file they came from (with use-embedded)")
+	splitChaptersCmd.Flags().String("chapters-file", "", "A chapter list file (audacity labels, cue, ffmetadata, json, mp4chaps, ogm, or \"HH:MM:SS Title\" lines) to use instead of generating chapters")
 	splitChaptersCmd.Flags().Bool("generate-chapters", false, "generate chapters and embed them in and existing .m4b audiobook (no transcoding required)")
 }
@@ -32,15 +32,15 @@ var bindTagCmd = &cobra.Command{
 			return err
 		}
 
-		// watch for early terminations
-		go watchForTermSignals(&config)
+		// cancelled by early termination signals, which kills any running ffmpeg processes
+		ctx := cmd.Context()
 
 		// generate and validate configs
 		if err := generateBindOpts(&config, cmd.Flags()); err != nil {
 			return err
 		}
 		// populate Config
-		if err := config.New(); err != nil {
+		if err := config.New(ctx); err != nil {
 			return err
 		}
 
@@ -23,12 +23,27 @@ var bindCmd = &cobra.Command{
 func init() {
 	RootCmd.AddCommand(bindCmd)
 	// define flags for this command
+	bindCmd.PersistentFlags().String("cache-dir", "", "A directory to keep transcoded files in, so re-runs reuse them instead of transcoding the same source files again")
+	bindCmd.PersistentFlags().String("chapter-language", "", "The language of generated chapter titles (de, en, es, fr)")
+	bindCmd.PersistentFlags().String("chapter-title-template", "", "The template for generated chapter titles, supports {chapter}, {n}, {n:3} (zero padded), {words}, {roman}, {file}, and {tag} (default \"{chapter} {n}\")")
+	bindCmd.PersistentFlags().String("chapter-titles", "", "A file of chapter titles, one per line, to rename the generated chapters with (supports {n} and {title} placeholders)")
+	bindCmd.PersistentFlags().String("epub", "", "An EPUB file whose table of contents titles the chapters, and whose metadata fills in what the path pattern doesn't (CUE sheets keep their own chapter titles)")
+	bindCmd.PersistentFlags().String("encoding-profile", "", "The encoding profile used when transcoding (he-aac-32k, high-quality-stereo-128k, spoken-mono-48k, spoken-mono-vbr) (default ffmpeg AAC defaults)")
+	bindCmd.PersistentFlags().StringSlice("export-chapters", nil, "Also write the chapters next to the output file in these formats (audacity, cue, ffmetadata, json, mp4chaps)")
+	bindCmd.PersistentFlags().Float64("loudness-target", 0, "Measure the loudness of each book and correct it to this integrated loudness in LUFS (e.g. -18)")
+	bindCmd.PersistentFlags().Bool("merge-duplicate-titles", false, "Merge adjacent chapters whose titles match, ignoring case and punctuation")
+	bindCmd.PersistentFlags().Duration("merge-shorter-than", 0, "Merge chapters shorter than this (e.g. 30s) into the chapter after them")
 	bindCmd.PersistentFlags().StringP("file-pattern", "f", "", "The output filename, can be a combination of literal values and patterns")
 	bindCmd.PersistentFlags().IntP("jobs", "j", 1, "The number of concurrent transcoding process to run for conversion (don't exceed your cpu count)")
 	bindCmd.PersistentFlags().StringP("output-directory", "o", "", "The output directory for the final directory, can be combination of absolute values and path patterns")
+	bindCmd.PersistentFlags().String("output-format", "", "The format of the bound book (m4b, mp3, opus) (default \"m4b\")")
 	bindCmd.PersistentFlags().StringP("path-pattern", "p", "", "The pattern for metadata picked up via paths")
+	bindCmd.PersistentFlags().String("progress", "", "How to show the progress of transcoding and binding (bar, json, none) (default \"bar\")")
 	bindCmd.PersistentFlags().String("scratch-files-path", "", "The location to generate the scratch directory")
 	bindCmd.PersistentFlags().StringP("source-files-path", "s", "", "The path to directory of source files (must match path-pattern for metadata to work)")
+	bindCmd.PersistentFlags().Bool("split-at-silence", false, "Move the splits of long chapters to the strongest nearby silence (requires split-longer-than)")
+	bindCmd.PersistentFlags().Duration("split-longer-than", 0, "Split chapters longer than this (e.g. 1h) into even parts")
+	bindCmd.PersistentFlags().Int("transcode-retries", 0, "Retry files that fail to transcode this many times, and keep transcoding the rest, instead of stopping at the first failure")
 	bindCmd.PersistentFlags().Bool("verbose-transcode", false, "Enable output of all ffmpeg commands/operations")
 	// Here you will define your flags and configuration settings.
 	//bindCmd.MarkFlagRequired("source-files-path")
@@ -65,6 +80,102 @@ func generateBindOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 		config.PathPattern = pathPattern
 	}
 
+	// get chapter title template and language
+	chapterTitleTemplate, err := flags.GetString("chapter-title-template")
+	if err != nil {
+		return err
+	} else if chapterTitleTemplate != "" {
+		config.ChapterTitleTemplate = chapterTitleTemplate
+	}
+	chapterLanguage, err := flags.GetString("chapter-language")
+	if err != nil {
+		return err
+	} else if chapterLanguage != "" {
+		config.ChapterLanguage = chapterLanguage
+	}
+
+	// get chapter post-processing options
+	mergeDuplicates, err := flags.GetBool("merge-duplicate-titles")
+	if err != nil {
+		return err
+	} else if mergeDuplicates {
+		config.MergeDuplicateTitles = true
+	}
+	mergeShorter, err := flags.GetDuration("merge-shorter-than")
+	if err != nil {
+		return err
+	} else if mergeShorter > 0 {
+		config.MinChapterLength = mergeShorter
+	}
+	splitLonger, err := flags.GetDuration("split-longer-than")
+	if err != nil {
+		return err
+	} else if splitLonger > 0 {
+		config.MaxChapterLength = splitLonger
+	}
+	splitAtSilence, err := flags.GetBool("split-at-silence")
+	if err != nil {
+		return err
+	} else if splitAtSilence {
+		config.SplitAtSilence = true
+	}
+
+	// get chapter titles file
+	chapterTitles, err := flags.GetString("chapter-titles")
+	if err != nil {
+		return err
+	} else if chapterTitles != "" {
+		config.ChapterTitlesFile = chapterTitles
+	}
+
+	// get EPUB file
+	epubFile, err := flags.GetString("epub")
+	if err != nil {
+		return err
+	} else if epubFile != "" {
+		config.EpubFile = epubFile
+	}
+
+	// get chapter export formats
+	exportFormats, err := flags.GetStringSlice("export-chapters")
+	if err != nil {
+		return err
+	} else if len(exportFormats) > 0 {
+		config.ExportChapterFormats = exportFormats
+	}
+
+	// get transcode cache directory
+	cacheDir, err := flags.GetString("cache-dir")
+	if err != nil {
+		return err
+	} else if cacheDir != "" {
+		config.CacheDir = cacheDir
+	}
+
+	// get encoding profile
+	encodingProfile, err := flags.GetString("encoding-profile")
+	if err != nil {
+		return err
+	} else if encodingProfile != "" {
+		config.EncodingProfile = encodingProfile
+	}
+
+	// get loudness target
+	loudnessTarget, err := flags.GetFloat64("loudness-target")
+	if err != nil {
+		return err
+	} else if loudnessTarget != 0 {
+		config.LoudnessTarget = loudnessTarget
+	}
+
+	// get output format
+	outputFormat, err := flags.GetString("output-format")
+	if err != nil {
+		return err
+	} else if outputFormat != "" {
+		config.OutputFormat = outputFormat
+	}
+
 	// get file pattern
 	filePatten, err := flags.GetString("file-pattern")
 	if err != nil {
@@ -73,6 +184,20 @@ func generateBindOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 		config.OutputFilePattern = filePatten
 	}
 
+	// get progress mode
+	progressMode, err := flags.GetString("progress")
+	if err != nil {
+		return err
+	}
+
+	// get transcode retries
+	transcodeRetries, err := flags.GetInt("transcode-retries")
+	if err != nil {
+		return err
+	} else if transcodeRetries != 0 {
+		config.TranscodeRetries = transcodeRetries
+	}
+
 	// get jobs count
 	jobs, err := flags.GetInt("jobs")
 	if err != nil {
@@ -112,10 +237,52 @@ func generateBindOpts(config *audiobooker.Config, flags *pflag.FlagSet) error {
 	if config.PathPattern == "" && pathPattern == "" {
 		return errors.New("path pattern must be defined")
 	}
+	// validate chapter language
+	if config.ChapterLanguage != "" {
+		if err := audiobooker.CheckChapterLanguage(config.ChapterLanguage); err != nil {
+			return err
+		}
+	}
+	// validate chapter post-processing options
+	if err := config.ValidateChapterProcessing(); err != nil {
+		return err
+	}
+	// validate chapter export formats
+	for _, format := range config.ExportChapterFormats {
+		if err := audiobooker.CheckChapterFormat(format); err != nil {
+			return err
+		}
+	}
+	// validate encoding profile
+	if config.EncodingProfile != "" {
+		if err := audiobooker.CheckEncodingProfile(config.EncodingProfile); err != nil {
+			return err
+		}
+	}
+	// validate loudness target
+	if config.LoudnessTarget != 0 {
+		if err := audiobooker.CheckLoudnessTarget(config.LoudnessTarget); err != nil {
+			return err
+		}
+	}
+	// validate output format
+	if config.OutputFormat != "" {
+		if err := audiobooker.CheckOutputFormat(config.OutputFormat); err != nil {
+			return err
+		}
+	}
 	// validate jobs
 	if config.Jobs <= 0 {
 		return errors.New("jobs must be greater than 0")
 	}
+	// validate transcode retries
+	if config.TranscodeRetries < 0 {
+		return errors.New("transcode-retries must not be negative")
+	}
+	// validate progress mode
+	if err := setProgressReporter(config, progressMode); err != nil {
+		return err
+	}
 
 	// validate output destination in config struct TODO find a place for this validation that isn't global
 	//if config.OutputFileDest == "" {
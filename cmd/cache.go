@@ -0,0 +1,133 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and prune the transcode cache",
+	Long: `The cache command, and its sub-commands, work with the transcode cache that bind and batch keep transcoded files in when given a cache directory.
+
+The cache directory is read from --cache-dir, or the CACHE_DIR environment variable.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+// cacheSizeCmd represents the cache size command
+var cacheSizeCmd = &cobra.Command{
+	Use:   "size",
+	Short: "Show the number of files in the transcode cache and their total size",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir, err := getCacheDir(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		count, size, err := audiobooker.CacheSize(cacheDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files, %s in %s\n", count, formatBytes(size), cacheDir)
+
+		return nil
+	},
+}
+
+// cachePruneCmd represents the cache prune command
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the least recently used files from the transcode cache",
+	Long: `Remove the files of the transcode cache that haven't been used for longer than --older-than, and the least recently used files until the cache is no bigger than --max-size-mb.
+
+Use --dry-run to list the files that would be removed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir, err := getCacheDir(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		options := audiobooker.CachePruneOptions{DryRun: dryRun}
+		if options.OlderThan, err = cmd.Flags().GetDuration("older-than"); err != nil {
+			return err
+		}
+		maxSizeMb, err := cmd.Flags().GetInt64("max-size-mb")
+		if err != nil {
+			return err
+		}
+		options.MaxSize = maxSizeMb * 1000 * 1000
+
+		// validate selected options
+		if options.OlderThan < 0 || options.MaxSize < 0 {
+			return errors.New("older-than and max-size-mb must not be negative")
+		}
+		if options.OlderThan == 0 && options.MaxSize == 0 {
+			return errors.New("older-than or max-size-mb must be set")
+		}
+
+		pruned, err := audiobooker.PruneCache(cacheDir, options)
+		if err != nil {
+			return err
+		}
+
+		var freed int64
+		for _, entry := range pruned {
+			freed += entry.Size
+			if dryRun {
+				fmt.Printf("%s (%s, last used %s)\n", entry.Path, formatBytes(entry.Size), entry.LastUsed.Format("2006-01-02 15:04"))
+			}
+		}
+		if dryRun {
+			fmt.Printf("dry-run flag was set, %d files, %s would be removed\n", len(pruned), formatBytes(freed))
+		} else {
+			fmt.Printf("removed %d files, %s\n", len(pruned), formatBytes(freed))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheSizeCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+
+	cacheCmd.PersistentFlags().String("cache-dir", "", "The transcode cache directory (defaults to $CACHE_DIR)")
+	cachePruneCmd.Flags().Int64("max-size-mb", 0, "Remove the least recently used files until the cache is no bigger than this many megabytes")
+	cachePruneCmd.Flags().Duration("older-than", 0, "Remove files that haven't been used for longer than this (e.g. 720h)")
+}
+
+// getCacheDir returns the cache directory of the flag, or the environment
+func getCacheDir(flags *pflag.FlagSet) (string, error) {
+	config := audiobooker.Config{}
+	if err := config.Parse(); err != nil {
+		return "", err
+	}
+
+	cacheDir, err := flags.GetString("cache-dir")
+	if err != nil {
+		return "", err
+	} else if cacheDir != "" {
+		config.CacheDir = cacheDir
+	}
+
+	if config.CacheDir == "" {
+		return "", errors.New("cache-dir must be set")
+	}
+
+	return config.CacheDir, nil
+}
+
+// formatBytes formats a size in bytes as megabytes
+func formatBytes(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/1e6)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"github.com/cslamar/audiobooker/audiobooker"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// exportChaptersCmd represents the export-chapters command
+var exportChaptersCmd = &cobra.Command{
+	Use:   "export-chapters",
+	Short: "Export the chapters embedded in an audiobook file to another format",
+	Long: `Export the chapters embedded in an m4b, m4a, or mp3 file for use in other tools.
+
+Supported formats:
+  audacity    Audacity label track, tab separated start and end seconds with the title
+  cue         CUE sheet referencing the input file, one TRACK per chapter
+  ffmetadata  ffmpeg metadata file with a [CHAPTER] section per chapter
+  json        JSON document with the title, start, end, and length of each chapter in milliseconds
+  mp4chaps    Nero/mp4chaps chapter list, one "HH:MM:SS.mmm Title" line per chapter
+
+The chapters are written to stdout unless an output file is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile, err := cmd.Flags().GetString("input")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		if err := audiobooker.CheckChapterFormat(format); err != nil {
+			return err
+		}
+
+		// parse ENV variables for the chapter title template and language of untitled chapters
+		config := audiobooker.Config{}
+		if err := config.Parse(); err != nil {
+			return err
+		}
+
+		book := audiobooker.Book{}
+		if err := book.ReadEmbedded(cmd.Context(), config, inputFile); err != nil {
+			return err
+		}
+		if len(book.Chapters) == 0 {
+			log.Warnf("no chapters found in %s", inputFile)
+		}
+
+		if outputFile == "" || outputFile == "-" {
+			return audiobooker.ExportChapters(os.Stdout, book, format, inputFile)
+		}
+
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return err
+		}
+		if err := audiobooker.ExportChapters(f, book, format, inputFile); err != nil {
+			f.Close()
+			return err
+		}
+
+		return f.Close()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(exportChaptersCmd)
+
+	exportChaptersCmd.Flags().StringP("format", "F", audiobooker.ChapterFormatMp4Chaps, "The format to export the chapters in (audacity, cue, ffmetadata, json, mp4chaps)")
+	exportChaptersCmd.Flags().StringP("input", "i", "", "The audiobook file to read the chapters from")
+	exportChaptersCmd.Flags().StringP("output", "o", "", "The file to write the chapters to (defaults to stdout)")
+
+	exportChaptersCmd.MarkFlagRequired("input")
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2023 Chris Slamar chris@slamar.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	"path/filepath"
+	"time"
+)
+
+// printChapters outputs the start time, length, and title of each chapter
+func printChapters(chapters []*audiobooker.Chapter) {
+	fmt.Printf("found %d chapters\n", len(chapters))
+	for _, chapter := range chapters {
+		start := time.Duration(chapter.StartMs) * time.Millisecond
+		length := time.Duration(chapter.LengthMs) * time.Millisecond
+		fmt.Printf("%+15s: %s [%s]\n", start, chapter.Title, length)
+	}
+	fmt.Println()
+}
+
+// printChapterChanges outputs the changes chapter post-processing made to the chapters
+func printChapterChanges(changes []audiobooker.ChapterChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("chapter post-processing made %d changes\n", len(changes))
+	for _, change := range changes {
+		fmt.Printf("%+18s: %s, %s\n", change.Step, change.Title, change.Description)
+	}
+	fmt.Println()
+}
+
+// printTranscodePlan outputs the measured loudness, and which source files will be stream copied and which re-encoded, and why
+func printTranscodePlan(ctx context.Context, config audiobooker.Config) error {
+	loudness, err := audiobooker.MeasureLoudness(ctx, config)
+	if err != nil {
+		return err
+	}
+	if loudness != nil {
+		fmt.Printf("loudness: %s\n\n", loudness)
+	}
+	plans, err := audiobooker.PlanTranscode(ctx, config, loudness)
+	if err != nil {
+		return err
+	}
+	copied := 0
+	for _, plan := range plans {
+		if plan.Copy {
+			copied++
+		}
+	}
+	fmt.Printf("transcode plan (%d copied, %d re-encoded)\n", copied, len(plans)-copied)
+	for _, plan := range plans {
+		if plan.Copy {
+			fmt.Printf("%+15s: %s\n", "copy", filepath.Base(plan.SourceFile))
+		} else {
+			fmt.Printf("%+15s: %s (%s)\n", "re-encode", filepath.Base(plan.SourceFile), plan.Reason)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// printMarkerSelections outputs which silence candidates were picked as chapter marks, and why the others were rejected
+func printMarkerSelections(selections []audiobooker.MarkerSelection) {
+	if len(selections) == 0 {
+		return
+	}
+	fmt.Printf("silence candidates (%d found)\n", len(selections))
+	for _, selection := range selections {
+		mark := time.Duration(selection.ParseEnd() * float64(time.Second)).Round(time.Millisecond)
+		status := "picked"
+		if !selection.Picked {
+			status = "rejected: " + selection.Reason
+		}
+		fmt.Printf("%+15s: %.2fs silence, %ddB deep, score %.2f - %s\n", mark, selection.Duration, selection.Depth, selection.Score, status)
+	}
+	fmt.Println()
+}
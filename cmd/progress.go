@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cslamar/audiobooker/audiobooker"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// progress output modes
+const (
+	progressModeBar  = "bar"
+	progressModeJson = "json"
+	progressModeNone = "none"
+)
+
+// progressBarWidth number of characters in the progress bar
+const progressBarWidth = 30
+
+// progressEvent JSON line emitted for each progress update
+type progressEvent struct {
+	Event            string  `json:"event"`
+	Stage            string  `json:"stage"`
+	File             string  `json:"file,omitempty"`
+	FileProcessedSec float64 `json:"file_processed_seconds"`
+	FileDurationSec  float64 `json:"file_duration_seconds"`
+	ProcessedSec     float64 `json:"processed_seconds"`
+	DurationSec      float64 `json:"duration_seconds"`
+	Percent          float64 `json:"percent"`
+	Speed            float64 `json:"speed"`
+	EtaSec           float64 `json:"eta_seconds"`
+	BytesWritten     int64   `json:"bytes_written"`
+	Done             bool    `json:"done"`
+	BookProcessedSec float64 `json:"book_processed_seconds"`
+	BookDurationSec  float64 `json:"book_duration_seconds"`
+	BookPercent      float64 `json:"book_percent"`
+	BookEtaSec       float64 `json:"book_eta_seconds"`
+	BatchBook        int     `json:"batch_book,omitempty"`
+	BatchBooks       int     `json:"batch_books,omitempty"`
+	BatchPercent     float64 `json:"batch_percent,omitempty"`
+	BatchEtaSec      float64 `json:"batch_eta_seconds,omitempty"`
+}
+
+// batchProgress position of the book being bound in a batch run, which the progress of each book is reported with
+type batchProgress struct {
+	books int
+	book  int
+	// start when the first progress of the batch was reported, books skipped before it don't count towards the speed
+	start time.Time
+	// startFraction how far through the batch the run was at start
+	startFraction float64
+}
+
+// activeBatch the batch being run, nil outside of batch runs
+var activeBatch *batchProgress
+
+// startBook moves the batch on to a book, number starts at 1
+func (b *batchProgress) startBook(number int) {
+	b.book = number
+}
+
+// wrap returns a reporter that fills in the batch totals of the progress before passing it on to reporter
+func (b *batchProgress) wrap(reporter audiobooker.ProgressReporter) audiobooker.ProgressReporter {
+	return audiobooker.ProgressReporterFunc(func(progress audiobooker.Progress) {
+		b.fill(&progress)
+		reporter.ReportProgress(progress)
+	})
+}
+
+// fill works out how far through the batch the run is from the books before this one and the progress of this one
+func (b *batchProgress) fill(progress *audiobooker.Progress) {
+	progress.BatchBook = b.book
+	progress.BatchBooks = b.books
+	if b.books <= 0 {
+		return
+	}
+
+	bookFraction := 0.0
+	if percent := progress.BookPercent(); percent >= 0 {
+		bookFraction = percent / 100
+	}
+	fraction := min(1, (float64(b.book-1)+bookFraction)/float64(b.books))
+	progress.BatchPercent = fraction * 100
+
+	if b.start.IsZero() {
+		b.start = time.Now()
+		b.startFraction = fraction
+		return
+	}
+	if done := fraction - b.startFraction; done > 0 && fraction < 1 {
+		progress.BatchETA = time.Duration(float64(time.Since(b.start)) * (1 - fraction) / done).Round(time.Second)
+	}
+}
+
+// newProgressReporter returns the reporter for the progress mode, nil when progress isn't shown
+func newProgressReporter(mode string, out io.Writer) (audiobooker.ProgressReporter, error) {
+	switch mode {
+	case "", progressModeBar:
+		return audiobooker.ProgressReporterFunc(func(progress audiobooker.Progress) {
+			printProgressBar(out, progress)
+		}), nil
+	case progressModeJson:
+		encoder := json.NewEncoder(out)
+		return audiobooker.ProgressReporterFunc(func(progress audiobooker.Progress) {
+			encoder.Encode(newProgressEvent(progress))
+		}), nil
+	case progressModeNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown progress mode %q, must be one of: %s, %s, %s", mode, progressModeBar, progressModeJson, progressModeNone)
+	}
+}
+
+// printProgressBar redraws the progress line of the stage, ending it when the stage is done
+func printProgressBar(out io.Writer, progress audiobooker.Progress) {
+	line := fmt.Sprintf("%-9s ", progress.Stage)
+	if percent := progress.Percent(); percent >= 0 {
+		filled := int(percent / 100 * progressBarWidth)
+		line += fmt.Sprintf("[%s%s] %3.0f%% %s/%s", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), percent,
+			progress.Processed.Round(time.Second), progress.Duration.Round(time.Second))
+	} else {
+		line += progress.Processed.Round(time.Second).String()
+	}
+	line += fmt.Sprintf(" %.1fx %s", progress.Speed, formatBytes(progress.BytesWritten))
+	if progress.ETA > 0 {
+		line += fmt.Sprintf(" ETA %s", progress.ETA)
+	}
+	if percent := progress.BookPercent(); percent >= 0 {
+		line += fmt.Sprintf(" | book %3.0f%%", percent)
+		if progress.BookETA > 0 {
+			line += fmt.Sprintf(" ETA %s", progress.BookETA)
+		}
+	}
+	if progress.BatchBooks > 0 {
+		line += fmt.Sprintf(" | batch %d/%d %3.0f%%", progress.BatchBook, progress.BatchBooks, progress.BatchPercent)
+		if progress.BatchETA > 0 {
+			line += fmt.Sprintf(" ETA %s", progress.BatchETA)
+		}
+	}
+
+	// pad over the remains of a longer previous line
+	fmt.Fprintf(out, "\r%-80s", line)
+	if progress.Done {
+		fmt.Fprintln(out)
+	}
+}
+
+// newProgressEvent converts the progress to its JSON event
+func newProgressEvent(progress audiobooker.Progress) progressEvent {
+	return progressEvent{
+		Event:            "progress",
+		Stage:            progress.Stage,
+		File:             progress.File,
+		FileProcessedSec: progress.FileProcessed.Seconds(),
+		FileDurationSec:  progress.FileDuration.Seconds(),
+		ProcessedSec:     progress.Processed.Seconds(),
+		DurationSec:      progress.Duration.Seconds(),
+		Percent:          progress.Percent(),
+		Speed:            progress.Speed,
+		EtaSec:           progress.ETA.Seconds(),
+		BytesWritten:     progress.BytesWritten,
+		Done:             progress.Done,
+		BookProcessedSec: progress.BookProcessed.Seconds(),
+		BookDurationSec:  progress.BookDuration.Seconds(),
+		BookPercent:      progress.BookPercent(),
+		BookEtaSec:       progress.BookETA.Seconds(),
+		BatchBook:        progress.BatchBook,
+		BatchBooks:       progress.BatchBooks,
+		BatchPercent:     progress.BatchPercent,
+		BatchEtaSec:      progress.BatchETA.Seconds(),
+	}
+}
+
+// setProgressReporter sets the progress reporter of the progress flag, the progress is written to stderr so it isn't mixed with the regular output, with the batch totals during batch runs
+func setProgressReporter(config *audiobooker.Config, mode string) error {
+	reporter, err := newProgressReporter(mode, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if reporter != nil && activeBatch != nil {
+		reporter = activeBatch.wrap(reporter)
+	}
+	config.Progress = reporter
+	return nil
+}
@@ -4,8 +4,8 @@ Copyright © 2022 Chris Slamar chris@slamar.com
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"github.com/cslamar/audiobooker/audiobooker"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
@@ -35,7 +35,13 @@ var RootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the RootCmd.
 func Execute() {
-	err := RootCmd.Execute()
+	// cancel the running command on early termination signals, so ffmpeg processes are killed and scratch files cleaned up
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := RootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		log.Warnln("got early termination signal.  Exiting!")
+	}
+	stop()
 	if err != nil {
 		notifyError(err)
 		os.Exit(1)
@@ -89,18 +95,3 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
-
-// watchForTermSignals background function for capturing premature term signals
-func watchForTermSignals(config *audiobooker.Config) {
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
-	select {
-	case <-sigterm:
-		log.Warnln("got early termination signal.  Exiting!")
-		if err := config.Cleanup(); err != nil {
-			log.Errorln("config cleanup errored, check for lingering scratch data!")
-			os.Exit(1)
-		}
-		os.Exit(0)
-	}
-}